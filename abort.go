@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// monacoAbortedEventType aborts the in-flight monaco runs of its keptn context
+var monacoAbortedEventType = "sh.keptn.event." + MonacoEvent + ".aborted"
+
+// inFlightRuns tracks the running deployments by keptn context so that they can be aborted
+type inFlightRuns struct {
+	mu     sync.Mutex
+	nextID int
+	runs   map[string]map[int]context.CancelFunc
+}
+
+func newInFlightRuns() *inFlightRuns {
+	return &inFlightRuns{runs: map[string]map[int]context.CancelFunc{}}
+}
+
+// runningDeployments are the monaco runs Abort can cancel
+var runningDeployments = newInFlightRuns()
+
+/**
+ * Registers a run of keptnContext and returns its context, which is cancelled when the run is aborted. done must be
+ * called once the run finished.
+ */
+func (r *inFlightRuns) Start(keptnContext string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextID
+	r.nextID++
+	if r.runs[keptnContext] == nil {
+		r.runs[keptnContext] = map[int]context.CancelFunc{}
+	}
+	r.runs[keptnContext][id] = cancel
+
+	return ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.runs[keptnContext], id)
+		if len(r.runs[keptnContext]) == 0 {
+			delete(r.runs, keptnContext)
+		}
+		cancel()
+	}
+}
+
+// Abort cancels all runs of keptnContext and returns how many there were
+func (r *inFlightRuns) Abort(keptnContext string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cancel := range r.runs[keptnContext] {
+		cancel()
+	}
+	return len(r.runs[keptnContext])
+}
+
+/**
+ * Cancels the monaco runs of the aborted sequence. The aborted runs report the abort in their own .finished event,
+ * so nothing is sent for the aborted event itself.
+ */
+func handleMonacoAbortedEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	var shkeptncontext string
+	event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
+
+	logger := newEventLogger(event)
+	if aborted := runningDeployments.Abort(shkeptncontext); aborted > 0 {
+		logger.Info(fmt.Sprintf("Aborting %d monaco run(s) of keptn context %s", aborted, shkeptncontext))
+	} else {
+		logger.Info(fmt.Sprintf("Ignoring %s, there is no monaco run of keptn context %s", event.Context.GetID(), shkeptncontext))
+	}
+	return nil
+}
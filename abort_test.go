@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestMonacoAbortedEventCancelsRun(t *testing.T) {
+	defer setupTestWorkDir(t, "touch started\nexec sleep 30", nil)()
+
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomingEvent.SetID("slow-deployment")
+	eventData := &MonacoStartedEventData{}
+	if err := incomingEvent.DataAs(eventData); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- HandleMonacoTriggeredEvent(myKeptn, *incomingEvent, eventData)
+	}()
+
+	// wait until monaco runs
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat("started"); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	abortEvent := incomingEvent.Clone()
+	abortEvent.SetType(monacoAbortedEventType)
+	abortEvent.SetID("abort-slow-deployment")
+	if err := processKeptnCloudEvent(context.Background(), abortEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the aborted run to be cancelled")
+	}
+	if monacoErr, ok := err.(*MonacoError); !ok || monacoErr.Kind != KindAborted {
+		t.Errorf("expected an aborted error, got %v", err)
+	}
+
+	finishedData := getFinishedEventData(t, myKeptn)
+	if finishedData.Status != keptnv2.StatusErrored || !finishedData.Monaco.Aborted || !strings.Contains(finishedData.Message, "aborted") {
+		t.Errorf("expected a .finished event indicating the abort, got %+v", finishedData)
+	}
+	if aborted := runningDeployments.Abort("08735340-6f9e-4b32-97ff-3b6c292bc50h"); aborted != 0 {
+		t.Errorf("expected the run to be unregistered, %d runs are left", aborted)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// environmentBreakers stop deploying to Dynatrace environments that keep failing, see ENVIRONMENT_BREAKER_THRESHOLD
+var environmentBreakers = newCircuitBreakers()
+
+/**
+ * Returns a KindCircuitOpen error while the breaker of the Dynatrace environment tenant is open, nil if monaco may
+ * deploy to it
+ */
+func checkEnvironmentBreaker(tenant string) *MonacoError {
+	if env.EnvironmentBreakerThreshold <= 0 {
+		return nil
+	}
+	breaker := environmentBreakers.Get(tenant)
+	if breaker.Allow(time.Now()) {
+		return nil
+	}
+	return newMonacoError(KindCircuitOpen, "deployments to the Dynatrace environment %s failed %d times in a row, retrying after %s",
+		tenant, env.EnvironmentBreakerThreshold, breaker.OpenUntil().Format(time.RFC3339))
+}
+
+/**
+ * Records the result of a monaco run against the Dynatrace environment tenant. Only failures pointing to the
+ * environment count, invalid monaco configurations and aborted runs don't.
+ */
+func recordEnvironmentResult(tenant string, monacoErr *MonacoError) {
+	if env.EnvironmentBreakerThreshold <= 0 {
+		return
+	}
+	if monacoErr != nil && !isEnvironmentFailure(monacoErr) {
+		return
+	}
+	if environmentBreakers.Get(tenant).Record(monacoErr == nil, time.Now(), env.EnvironmentBreakerThreshold, env.EnvironmentBreakerCooldown) {
+		log.Printf("Deployments to the Dynatrace environment %s failed %d times in a row, failing new deployments for %s", tenant, env.EnvironmentBreakerThreshold, env.EnvironmentBreakerCooldown)
+	}
+}
+
+// isEnvironmentFailure returns whether monacoErr is likely caused by the Dynatrace environment rather than the configuration
+func isEnvironmentFailure(monacoErr *MonacoError) bool {
+	switch monacoErr.Kind {
+	case KindTimeout:
+		return true
+	case KindExecution:
+		// monaco exits with 1 if it rejected the configuration
+		return monacoErr.ExitCode != 1
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestHandleMonacoTriggeredEventEnvironmentCircuitBreaker(t *testing.T) {
+	defer func(breakers *circuitBreakers, threshold int, cooldown time.Duration) {
+		environmentBreakers = breakers
+		env.EnvironmentBreakerThreshold = threshold
+		env.EnvironmentBreakerCooldown = cooldown
+	}(environmentBreakers, env.EnvironmentBreakerThreshold, env.EnvironmentBreakerCooldown)
+	environmentBreakers = newCircuitBreakers()
+	env.EnvironmentBreakerThreshold = 2
+	env.EnvironmentBreakerCooldown = 200 * time.Millisecond
+
+	defer setupTestWorkDir(t, "", nil)()
+	failing := true
+	runner := &fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+		if failing {
+			return MonacoRunResult{}, errors.New("connection reset by peer")
+		}
+		return MonacoRunResult{}, nil
+	}}
+	defer useMonacoRunner(runner)()
+
+	for i := 0; i < 2; i++ {
+		_, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+		var monacoErr *MonacoError
+		if !errors.As(err, &monacoErr) || monacoErr.Kind != KindExecution {
+			t.Fatalf("expected an execution error, got %v", err)
+		}
+	}
+
+	// the breaker is open, deployments fail without running monaco
+	runs := len(runner.runs)
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	var monacoErr *MonacoError
+	if !errors.As(err, &monacoErr) || monacoErr.Kind != KindCircuitOpen {
+		t.Fatalf("expected a circuit open error, got %v", err)
+	}
+	if len(runner.runs) != runs {
+		t.Errorf("expected monaco not to run while the circuit is open")
+	}
+	finishedData := getFinishedEventData(t, myKeptn)
+	if finishedData.Result != keptnv2.ResultFailed || !strings.Contains(finishedData.Message, "Circuit open") {
+		t.Errorf("expected a failed run with a circuit open message, got %s: %s", finishedData.Result, finishedData.Message)
+	}
+
+	// after the cooldown the environment recovered
+	time.Sleep(env.EnvironmentBreakerCooldown)
+	failing = false
+	for i := 0; i < 2; i++ {
+		myKeptn, err = runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+		if err != nil {
+			t.Fatalf("expected the deployment to run after the cooldown, got %v", err)
+		}
+		if finishedData := getFinishedEventData(t, myKeptn); finishedData.Result != keptnv2.ResultPass {
+			t.Errorf("expected a passed run, got %s: %s", finishedData.Result, finishedData.Message)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+)
+
+// eventSlots bounds how many events are processed at the same time, nil processes all of them (see MAX_CONCURRENT_EVENTS)
+var eventSlots *eventSemaphore
+
+// eventSemaphore hands out a fixed number of slots for in-flight events
+type eventSemaphore struct {
+	slots chan struct{}
+}
+
+func newEventSemaphore(size int) *eventSemaphore {
+	return &eventSemaphore{slots: make(chan struct{}, size)}
+}
+
+// TryAcquire takes a slot if one is free and returns whether it did
+func (s *eventSemaphore) TryAcquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire waits for a free slot, it returns the error of ctx if ctx is done first
+func (s *eventSemaphore) Acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire or TryAcquire
+func (s *eventSemaphore) Release() {
+	<-s.slots
+}
+
+// isConcurrencyLimitedEvent returns whether events of eventType take a slot of MAX_CONCURRENT_EVENTS: all handled
+// events except aborts, which have to get through to stop the runs holding the slots
+func isConcurrencyLimitedEvent(eventType string, handlers map[string]keptnEventHandler) bool {
+	_, handled := handlers[eventType]
+	return handled && eventType != monacoAbortedEventType
+}
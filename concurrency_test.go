@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// saturates MAX_CONCURRENT_EVENTS=1 with a running event, the returned function lets it finish
+func saturateEventSlots(t *testing.T, processed *int32) (cloudevents.Event, func()) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	eventHandlers = map[string]keptnEventHandler{
+		keptnv2.GetTriggeredEventType(MonacoEvent): func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			atomic.AddInt32(processed, 1)
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+		monacoAbortedEventType: func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			return nil
+		},
+	}
+	eventSlots = newEventSemaphore(1)
+
+	_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go processKeptnCloudEvent(context.Background(), *incomingEvent)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the first event to be processed")
+	}
+	return *incomingEvent, func() { close(release) }
+}
+
+func TestProcessKeptnCloudEventLimitsConcurrentEvents(t *testing.T) {
+	defer func(slots *eventSemaphore, handlers map[string]keptnEventHandler, reject bool) {
+		eventSlots, eventHandlers, env.RejectWhenBusy = slots, handlers, reject
+	}(eventSlots, eventHandlers, env.RejectWhenBusy)
+
+	t.Run("wait", func(t *testing.T) {
+		env.RejectWhenBusy = false
+		var processed int32
+		event, finish := saturateEventSlots(t, &processed)
+
+		done := make(chan error)
+		go func() { done <- processKeptnCloudEvent(context.Background(), event) }()
+		select {
+		case err := <-done:
+			t.Fatalf("expected the second event to wait for a free slot, it returned %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if atomic.LoadInt32(&processed) != 1 {
+			t.Errorf("expected only one event to be processed, got %d", processed)
+		}
+
+		finish()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the second event to be processed once the first one finished")
+		}
+		if atomic.LoadInt32(&processed) != 2 {
+			t.Errorf("expected both events to be processed, got %d", processed)
+		}
+	})
+
+	t.Run("reject when busy", func(t *testing.T) {
+		env.RejectWhenBusy = true
+		var processed int32
+		event, finish := saturateEventSlots(t, &processed)
+		defer finish()
+
+		err := processKeptnCloudEvent(context.Background(), event)
+		var result *cehttp.Result
+		if !errors.As(err, &result) || result.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected the event to be rejected with 503, got %v", err)
+		}
+		if atomic.LoadInt32(&processed) != 1 {
+			t.Errorf("expected the rejected event not to be processed, got %d events", processed)
+		}
+
+		// aborts get through to stop the runs holding the slots
+		event.SetType(monacoAbortedEventType)
+		if err := processKeptnCloudEvent(context.Background(), event); err != nil {
+			t.Errorf("expected aborts not to be limited, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// CloudEvent extension with the time (RFC 3339) by which the deployment has to be finished
+const deadlineExtension = "deadline"
+
+// eventDeadlineKey stores the deadline of the event in the context of a run to tell it apart from MONACO_TIMEOUT
+type eventDeadlineKey struct{}
+
+/**
+ * Returns the deadline extension of the event, the zero time if the event doesn't carry one
+ */
+func getEventDeadline(event cloudevents.Event) (time.Time, error) {
+	value, ok := event.Extensions()[deadlineExtension]
+	if !ok {
+		return time.Time{}, nil
+	}
+	deadline, err := types.ToTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s extension '%v', must be an RFC 3339 timestamp: %v", deadlineExtension, value, err)
+	}
+	return deadline, nil
+}
+
+/**
+ * Bounds all monaco executions of a run by the deadline of its event, in addition to MONACO_TIMEOUT.
+ * A zero deadline leaves runCtx unchanged.
+ */
+func withEventDeadline(runCtx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return runCtx, func() {}
+	}
+	ctx, cancel := context.WithDeadline(runCtx, deadline)
+	return context.WithValue(ctx, eventDeadlineKey{}, deadline), cancel
+}
+
+// eventDeadlineExceeded returns the deadline of the event if it is the one that expired ctx
+func eventDeadlineExceeded(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(eventDeadlineKey{}).(time.Time)
+	if !ok || time.Now().Before(deadline) {
+		return time.Time{}, false
+	}
+	return deadline, true
+}
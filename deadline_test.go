@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+/**
+ * runs HandleMonacoTriggeredEvent for the monaco.triggered test event with the given deadline extension
+ */
+func runMonacoTriggeredEventWithDeadline(t *testing.T, deadline interface{}) (*keptnv2.Keptn, error) {
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomingEvent.SetExtension(deadlineExtension, deadline)
+
+	eventData := &MonacoStartedEventData{}
+	if err := incomingEvent.DataAs(eventData); err != nil {
+		t.Fatal(err)
+	}
+	return myKeptn, HandleMonacoTriggeredEvent(myKeptn, *incomingEvent, eventData)
+}
+
+func TestHandleMonacoTriggeredEventHonorsDeadline(t *testing.T) {
+	defer setupTestWorkDir(t, "exec sleep 5", nil)()
+
+	start := time.Now()
+	myKeptn, err := runMonacoTriggeredEventWithDeadline(t, start.Add(200*time.Millisecond).Format(time.RFC3339Nano))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the run to be bounded by the deadline, took %s", elapsed)
+	}
+
+	var monacoErr *MonacoError
+	if !errors.As(err, &monacoErr) || monacoErr.Kind != KindTimeout {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if !strings.Contains(monacoErr.Error(), "deadline") {
+		t.Errorf("expected the error to mention the deadline of the event, got %v", monacoErr)
+	}
+
+	finishedData := getFinishedEventData(t, myKeptn)
+	if finishedData.Status != keptnv2.StatusErrored || finishedData.Result != keptnv2.ResultFailed {
+		t.Errorf("expected errored/fail, got %s/%s", finishedData.Status, finishedData.Result)
+	}
+}
+
+func TestHandleMonacoTriggeredEventHonorsDeadlineWhileWaitingForLock(t *testing.T) {
+	defer setupTestWorkDir(t, "touch ran", nil)()
+	defer func(timeout time.Duration) { env.DeploymentLockTimeout = timeout }(env.DeploymentLockTimeout)
+	env.DeploymentLockTimeout = time.Minute
+
+	// another deployment to the same project, stage and environment holds the lock
+	_, unlock, err := deploymentLocks.Lock(context.Background(), getDeploymentLockKey("sockshop", "dev", os.Getenv("DT_TENANT")), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	start := time.Now()
+	_, err = runMonacoTriggeredEventWithDeadline(t, start.Add(200*time.Millisecond).Format(time.RFC3339Nano))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected waiting for the lock to be bounded by the deadline, took %s", elapsed)
+	}
+	var monacoErr *MonacoError
+	if !errors.As(err, &monacoErr) || monacoErr.Kind != KindTimeout || !strings.Contains(monacoErr.Error(), "deadline") {
+		t.Fatalf("expected a timeout at the deadline of the event, got %v", err)
+	}
+	if _, err := os.Stat("ran"); err == nil {
+		t.Error("expected monaco not to run")
+	}
+}
+
+func TestHandleMonacoTriggeredEventRejectsDeadline(t *testing.T) {
+	tests := []struct {
+		name         string
+		deadline     string
+		expectedKind ErrorKind
+	}{
+		{name: "passed deadline", deadline: time.Now().Add(-time.Minute).Format(time.RFC3339), expectedKind: KindTimeout},
+		{name: "invalid deadline", deadline: "tomorrow", expectedKind: KindValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, "touch ran", nil)()
+
+			_, err := runMonacoTriggeredEventWithDeadline(t, tt.deadline)
+			var monacoErr *MonacoError
+			if !errors.As(err, &monacoErr) || monacoErr.Kind != tt.expectedKind {
+				t.Fatalf("expected a %s error, got %v", tt.expectedKind, err)
+			}
+			if _, err := os.Stat("ran"); err == nil {
+				t.Error("expected monaco not to run")
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// label of the .finished events of coalesced triggers, the ID of the triggered event whose run deployed them
+const batchedRunLabel = "monaco.batchedRun"
+
+// triggerBatch collects the triggers with the same deployment intent arriving within DEBOUNCE_WINDOW
+type triggerBatch struct {
+	// closed once the window passed, no triggers join afterwards
+	ready chan struct{}
+	// closed once the run of the last trigger finished
+	done chan struct{}
+	// ID of the last trigger of the batch, it runs monaco for all of them
+	runnerID string
+	size     int
+	// .finished event of the run, nil if none was sent
+	finished *MonacoFinishedEventData
+}
+
+// triggerBatches coalesces rapid successive triggers into a single run per deployment intent
+type triggerBatches struct {
+	mu      sync.Mutex
+	batches map[string]*triggerBatch
+}
+
+func newTriggerBatches() *triggerBatches {
+	return &triggerBatches{batches: map[string]*triggerBatch{}}
+}
+
+// triggers deployed together, see DEBOUNCE_WINDOW
+var debouncedTriggers = newTriggerBatches()
+
+// Join adds the trigger eventID to the open batch of key or opens a new one that closes after window
+func (b *triggerBatches) Join(key string, eventID string, window time.Duration) *triggerBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &triggerBatch{ready: make(chan struct{}), done: make(chan struct{})}
+		b.batches[key] = batch
+		time.AfterFunc(window, func() {
+			b.mu.Lock()
+			delete(b.batches, key)
+			b.mu.Unlock()
+			close(batch.ready)
+		})
+	}
+	batch.runnerID = eventID
+	batch.size++
+	return batch
+}
+
+/**
+ * Runs HandleMonacoTriggeredEvent for the last of the triggers with the same deployment intent (project, stage,
+ * service, config ref, image, labels and monaco.env, see getPayloadHash) that arrive within DEBOUNCE_WINDOW. The
+ * other triggers wait for that run and get a copy of its .finished event with the label monaco.batchedRun
+ * referencing it.
+ */
+func handleDebouncedMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *MonacoStartedEventData, window time.Duration) error {
+	if window <= 0 || len(data.Monaco.Stages) > 0 {
+		return HandleMonacoTriggeredEvent(myKeptn, incomingEvent, data)
+	}
+
+	// only triggers deploying the same are coalesced, the run deploys the payload of the last one for all of them
+	key := fmt.Sprintf("%s/%s/%s/%s", data.GetProject(), data.GetStage(), data.GetService(), getPayloadHash(data))
+	batch := debouncedTriggers.Join(key, incomingEvent.ID(), window)
+	<-batch.ready
+
+	if batch.runnerID == incomingEvent.ID() {
+		if batch.size > 1 {
+			log.Printf("Deploying %d triggers of %s with the run of event %s", batch.size, key, incomingEvent.ID())
+		}
+		recorder := &finishedEventRecorder{EventSender: myKeptn.EventSender}
+		myKeptn.EventSender = recorder
+		defer func() {
+			// also release the waiting triggers if the run panicked
+			myKeptn.EventSender = recorder.EventSender
+			batch.finished = recorder.finished
+			close(batch.done)
+		}()
+		return HandleMonacoTriggeredEvent(myKeptn, incomingEvent, data)
+	}
+
+	log.Printf("Event %s of %s is deployed by the run of event %s", incomingEvent.ID(), key, batch.runnerID)
+	data.EventData.Message = fmt.Sprintf("Coalesced into the run of event %s", batch.runnerID)
+	if _, err := myKeptn.SendTaskStartedEvent(data, eventSource); err != nil {
+		return err
+	}
+	<-batch.done
+
+	finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+		Status:  keptnv2.StatusErrored,
+		Result:  keptnv2.ResultFailed,
+		Message: fmt.Sprintf("The run of event %s didn't send a .finished event", batch.runnerID),
+	})
+	if batch.finished != nil {
+		copied := *batch.finished
+		finishedData = &copied
+		// the context attributes are taken from the coalesced trigger
+		finishedData.Project, finishedData.Stage, finishedData.Service = "", "", ""
+	}
+	labels := map[string]string{}
+	for key, value := range finishedData.Labels {
+		labels[key] = value
+	}
+	labels[batchedRunLabel] = batch.runnerID
+	finishedData.Labels = labels
+	_, err := myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+	return err
+}
+
+// finishedEventRecorder keeps the data of the last .finished event sent through it
+type finishedEventRecorder struct {
+	keptn.EventSender
+	finished *MonacoFinishedEventData
+}
+
+func (r *finishedEventRecorder) SendEvent(event cloudevents.Event) error {
+	if strings.HasSuffix(event.Type(), ".finished") {
+		finished := &MonacoFinishedEventData{}
+		if err := json.Unmarshal(event.Data(), finished); err == nil {
+			r.finished = finished
+		}
+	}
+	return r.EventSender.SendEvent(event)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func TestHandleMonacoEventCoalescesTriggersWithinDebounceWindow(t *testing.T) {
+	defer func(window time.Duration) { env.DebounceWindow = window }(env.DebounceWindow)
+	env.DebounceWindow = 200 * time.Millisecond
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+
+	triggerIDs := []string{}
+	eventSenders := []*fake.EventSender{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		incomingEvent.SetID(uuid.New().String())
+		triggerIDs = append(triggerIDs, incomingEvent.ID())
+		eventSenders = append(eventSenders, myKeptn.EventSender.(*fake.EventSender))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handleMonacoEvent(myKeptn, *incomingEvent); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+
+	deployments := 0
+	for _, args := range runner.runs {
+		if !args.Options.DryRun {
+			deployments++
+		}
+	}
+	if deployments != 1 {
+		t.Errorf("expected a single monaco deployment, got %d", deployments)
+	}
+
+	// every trigger is finished, the earlier ones reference the run of the last one
+	for i, eventSender := range eventSenders {
+		finished := 0
+		for _, event := range eventSender.SentEvents {
+			if event.Type() != keptnv2.GetFinishedEventType(MonacoEvent) {
+				continue
+			}
+			finished++
+			finishedData := &MonacoFinishedEventData{}
+			if err := event.DataAs(finishedData); err != nil {
+				t.Fatal(err)
+			}
+			if finishedData.Result != keptnv2.ResultPass || finishedData.Project != "sockshop" {
+				t.Errorf("expected trigger %d to pass for its project, got %s for %s", i, finishedData.Result, finishedData.Project)
+			}
+			triggeredID, _ := event.Context.GetExtension("triggeredid")
+			if triggeredID != triggerIDs[i] {
+				t.Errorf("expected the .finished event to reference trigger %s, got %v", triggerIDs[i], triggeredID)
+			}
+			expectedRun := ""
+			if i < 2 {
+				expectedRun = triggerIDs[2]
+			}
+			if run := finishedData.Labels[batchedRunLabel]; run != expectedRun {
+				t.Errorf("expected trigger %d to have the label %s=%q, got %q", i, batchedRunLabel, expectedRun, run)
+			}
+		}
+		if finished != 1 {
+			t.Errorf("expected one .finished event for trigger %d, got %d", i, finished)
+		}
+	}
+}
+
+func TestHandleMonacoEventDeploysEachServiceWithinDebounceWindow(t *testing.T) {
+	defer func(window time.Duration) { env.DebounceWindow = window }(env.DebounceWindow)
+	env.DebounceWindow = 200 * time.Millisecond
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+
+	var wg sync.WaitGroup
+	for _, service := range []string{"carts", "orders"} {
+		_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		incomingEvent.SetID(uuid.New().String())
+		data := &MonacoStartedEventData{}
+		if err := incomingEvent.DataAs(data); err != nil {
+			t.Fatal(err)
+		}
+		data.Service = service
+		if err := incomingEvent.SetData(cloudevents.ApplicationJSON, data); err != nil {
+			t.Fatal(err)
+		}
+		myKeptn, err := keptnv2.NewKeptn(incomingEvent, keptn.KeptnOpts{EventSender: &fake.EventSender{}, UseLocalFileSystem: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handleDebouncedMonacoTriggeredEvent(myKeptn, *incomingEvent, data, env.DebounceWindow); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+
+	deployed := map[string]int{}
+	for _, args := range runner.runs {
+		if !args.Options.DryRun {
+			deployed[args.Event.Service]++
+		}
+	}
+	if deployed["carts"] != 1 || deployed["orders"] != 1 {
+		t.Errorf("expected a deployment per service, got %v", deployed)
+	}
+}
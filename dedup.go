@@ -0,0 +1,237 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// processedEvents remembers the IDs of the latest events, nil processes all of them (see EVENT_ID_CACHE_SIZE)
+var processedEvents *eventIDCache
+
+/**
+ * eventIDCache is a bounded LRU set of event IDs, once it is full the least recently seen ID is forgotten
+ */
+type eventIDCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+func newEventIDCache(size int) *eventIDCache {
+	return &eventIDCache{size: size, order: list.New(), ids: map[string]*list.Element{}}
+}
+
+// Seen returns whether the event ID was seen before and remembers it
+func (c *eventIDCache) Seen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.ids[id]; ok {
+		c.order.MoveToFront(element)
+		return true
+	}
+	c.ids[id] = c.order.PushFront(id)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.ids, oldest.Value.(string))
+	}
+	return false
+}
+
+// Forget removes the event ID, so the event is processed again the next time it is seen
+func (c *eventIDCache) Forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.ids[id]; ok {
+		c.order.Remove(element)
+		delete(c.ids, id)
+	}
+}
+
+// deployedContents remembers when which content was deployed successfully, see CONTENT_DEDUP_WINDOW
+var deployedContents = newContentDeduplicator()
+
+type contentDeduplicator struct {
+	mu       sync.Mutex
+	deployed map[string]time.Time
+}
+
+func newContentDeduplicator() *contentDeduplicator {
+	return &contentDeduplicator{deployed: map[string]time.Time{}}
+}
+
+// DeployedWithin returns when the content with this hash was deployed if that was less than window ago
+func (d *contentDeduplicator) DeployedWithin(contentHash string, window time.Duration, now time.Time) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deployedAt, ok := d.deployed[contentHash]
+	if !ok || now.Sub(deployedAt) >= window {
+		return time.Time{}, false
+	}
+	return deployedAt, true
+}
+
+// Record stores the deployment of the content with this hash and forgets deployments older than window
+func (d *contentDeduplicator) Record(contentHash string, window time.Duration, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for hash, deployedAt := range d.deployed {
+		if now.Sub(deployedAt) >= window {
+			delete(d.deployed, hash)
+		}
+	}
+	d.deployed[contentHash] = now
+}
+
+/**
+ * Hashes what a monaco run deploys: project, stage, service, Dynatrace environment, the options selecting and
+ * templating the configs (monaco projects, environment group or environments, continueOnError, monaco.env) and the
+ * files in the monaco folder. Runs with the same hash deploy the same configuration.
+ */
+func getContentHash(keptnEvent *common.BaseKeptnEvent, tenant string, options common.MonacoCommandOptions, monacoFolder string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n%s\n", keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, tenant, options.Projects)
+	fmt.Fprintf(hash, "%s\n%s\n%t\n", options.Group, options.Environment, options.ContinueOnError)
+	hashMonacoEnv(hash, options.Env)
+	hashMonacoEnv(hash, options.EnvOverride)
+
+	err := filepath.Walk(monacoFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// the monaco.zip the files were extracted from is not hashed
+		if !info.Mode().IsRegular() || strings.HasSuffix(path, ".zip") {
+			return nil
+		}
+
+		relativePath, _ := filepath.Rel(monacoFolder, path)
+		fmt.Fprintf(hash, "%s\n", relativePath)
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashMonacoEnv writes the variables sorted by name, so the hash doesn't depend on the order of the map
+func hashMonacoEnv(hash io.Writer, variables map[string]string) {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s=%s\n", name, variables[name])
+	}
+	fmt.Fprintln(hash)
+}
+
+// deployedHashes remembers the content hash of the last successful deployment per project and stage, see SKIP_UNCHANGED
+var deployedHashes deployedHashStore = newMemoryDeployedHashStore()
+
+// deployedHashStore persists the content hash of the last successful deployment per project and stage
+type deployedHashStore interface {
+	// LastDeployed returns the hash of the last successful deployment to the stage, false if there was none
+	LastDeployed(project string, stage string) (string, bool, error)
+	Record(project string, stage string, contentHash string) error
+}
+
+// memoryDeployedHashStore keeps the hashes in memory, they are lost when the service restarts
+type memoryDeployedHashStore struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func newMemoryDeployedHashStore() *memoryDeployedHashStore {
+	return &memoryDeployedHashStore{hashes: map[string]string{}}
+}
+
+func (s *memoryDeployedHashStore) LastDeployed(project string, stage string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contentHash, ok := s.hashes[project+"/"+stage]
+	return contentHash, ok, nil
+}
+
+func (s *memoryDeployedHashStore) Record(project string, stage string, contentHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hashes[project+"/"+stage] = contentHash
+	return nil
+}
+
+// isUnchanged returns whether contentHash was the last content deployed successfully to the stage
+func isUnchanged(store deployedHashStore, keptnEvent *common.BaseKeptnEvent, contentHash string) bool {
+	lastHash, ok, err := store.LastDeployed(keptnEvent.Project, keptnEvent.Stage)
+	if err != nil {
+		log.Printf("Could not read the last deployed configuration of %s/%s, not skipping: %v", keptnEvent.Project, keptnEvent.Stage, err)
+		return false
+	}
+	return ok && lastHash == contentHash
+}
+
+// deployedPayloads remembers when which event payload was deployed successfully, see EVENT_PAYLOAD_DEDUP_WINDOW
+var deployedPayloads = newContentDeduplicator()
+
+// deploymentIntent is the part of a .triggered event that decides what a run deploys
+type deploymentIntent struct {
+	Project   string              `json:"project"`
+	Stage     string              `json:"stage"`
+	Service   string              `json:"service"`
+	ConfigRef string              `json:"configRef"`
+	Image     string              `json:"image"`
+	Labels    map[string]string   `json:"labels"`
+	Env       map[string]string   `json:"env"`
+	Action    *keptnv2.ActionInfo `json:"action"`
+}
+
+/**
+ * Hashes the deployment intent of an event: project, stage, service, config ref, image, labels, monaco.env and the
+ * remediation action. Events with different IDs but the same hash, e.g., of a re-triggered sequence, deploy the same.
+ */
+func getPayloadHash(data *MonacoStartedEventData) string {
+	image, _ := getImageAndTag(data.ConfigurationChange)
+	intent, _ := json.Marshal(deploymentIntent{
+		Project:   data.GetProject(),
+		Stage:     data.GetStage(),
+		Service:   data.GetService(),
+		ConfigRef: getConfigRef(data),
+		Image:     image,
+		Labels:    data.GetLabels(),
+		Env:       data.Monaco.Env,
+		Action:    data.Action,
+	})
+	hash := sha256.Sum256(intent)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// runs the monaco.triggered test event with the passed event id and returns its finished event
+func runMonacoTriggeredEventWithID(t *testing.T, eventID string) *MonacoFinishedEventData {
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomingEvent.SetID(eventID)
+
+	if err := handleMonacoEvent(myKeptn, *incomingEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	return getFinishedEventData(t, myKeptn)
+}
+
+func TestHandleMonacoTriggeredEventSkipsSameContent(t *testing.T) {
+	defer setupTestWorkDir(t, `echo "$@" >> args.log`, map[string]string{
+		"monaco-test/projects/sockshop/auto-tag/auto-tag.yaml": "config:\n  - tag: \"tag.json\"\n",
+	})()
+	defer func(window time.Duration) { env.ContentDedupWindow = window }(env.ContentDedupWindow)
+	env.ContentDedupWindow = time.Hour
+	defer func(original *contentDeduplicator) { deployedContents = original }(deployedContents)
+	deployedContents = newContentDeduplicator()
+
+	first := runMonacoTriggeredEventWithID(t, "first-event")
+	if first.Result != keptnv2.ResultPass || first.Monaco.Skipped {
+		t.Fatalf("expected the first run to deploy, got %s: %s", first.Result, first.Message)
+	}
+
+	second := runMonacoTriggeredEventWithID(t, "second-event")
+	if second.Result != keptnv2.ResultPass || !second.Monaco.Skipped {
+		t.Errorf("expected the second run with the same content to be skipped, got %s: %s", second.Result, second.Message)
+	}
+
+	args, _ := ioutil.ReadFile("args.log")
+	if runs := strings.Count(string(args), "\n"); runs != 2 {
+		t.Errorf("expected monaco to run only for the first event (dry run and deployment), got %d runs", runs)
+	}
+
+	// changed content is deployed again
+	ioutil.WriteFile("monaco-test/projects/sockshop/auto-tag/auto-tag.yaml", []byte("config:\n  - tag: \"other.json\"\n"), 0644)
+	third := runMonacoTriggeredEventWithID(t, "third-event")
+	if third.Monaco.Skipped {
+		t.Errorf("expected the run with changed content not to be skipped")
+	}
+}
+
+func TestHandleMonacoTriggeredEventSkipsUnchangedConfig(t *testing.T) {
+	defer setupTestWorkDir(t, `echo "$@" >> args.log`, map[string]string{
+		"monaco-test/projects/sockshop/auto-tag/auto-tag.yaml": "config:\n  - tag: \"tag.json\"\n",
+	})()
+	defer func(skipUnchanged bool) { env.SkipUnchanged = skipUnchanged }(env.SkipUnchanged)
+	env.SkipUnchanged = true
+	defer func(original deployedHashStore) { deployedHashes = original }(deployedHashes)
+	deployedHashes = newMemoryDeployedHashStore()
+
+	first := runMonacoTriggeredEventWithID(t, "first-event")
+	if first.Result != keptnv2.ResultPass || first.Monaco.Skipped {
+		t.Fatalf("expected the first run to deploy, got %s: %s", first.Result, first.Message)
+	}
+
+	second := runMonacoTriggeredEventWithID(t, "second-event")
+	if second.Result != keptnv2.ResultPass || !second.Monaco.Skipped || !strings.Contains(second.Message, "no changes") {
+		t.Errorf("expected the second run with the same config to be skipped, got %s: %s", second.Result, second.Message)
+	}
+
+	args, _ := ioutil.ReadFile("args.log")
+	if runs := strings.Count(string(args), "\n"); runs != 2 {
+		t.Errorf("expected monaco to run only for the first event (dry run and deployment), got %d runs", runs)
+	}
+
+	// changed config is deployed again
+	ioutil.WriteFile("monaco-test/projects/sockshop/auto-tag/auto-tag.yaml", []byte("config:\n  - tag: \"other.json\"\n"), 0644)
+	third := runMonacoTriggeredEventWithID(t, "third-event")
+	if third.Monaco.Skipped {
+		t.Errorf("expected the run with changed config not to be skipped")
+	}
+}
+
+func TestHandleMonacoTriggeredEventDeploysChangedLabels(t *testing.T) {
+	defer setupTestWorkDir(t, "", map[string]string{
+		"monaco-test/projects/sockshop/auto-tag/auto-tag.yaml": "config:\n  - tag: \"tag.json\"\n",
+	})()
+	defer func(skipUnchanged bool) { env.SkipUnchanged = skipUnchanged }(env.SkipUnchanged)
+	env.SkipUnchanged = true
+	defer func(original deployedHashStore) { deployedHashes = original }(deployedHashes)
+	deployedHashes = newMemoryDeployedHashStore()
+
+	runs := []struct {
+		labels          map[string]string
+		expectedSkipped bool
+	}{
+		{labels: map[string]string{}, expectedSkipped: false},
+		{labels: map[string]string{continueOnErrorLabel: "true"}, expectedSkipped: false},
+		{labels: map[string]string{continueOnErrorLabel: "true"}, expectedSkipped: true},
+	}
+	for i, run := range runs {
+		myKeptn, err := runMonacoTriggeredEventWithLabels(t, run.labels)
+		if err != nil {
+			t.Fatalf("unexpected error in run %d: %v", i, err)
+		}
+		if skipped := getFinishedEventData(t, myKeptn).Monaco.Skipped; skipped != run.expectedSkipped {
+			t.Errorf("expected run %d with the labels %v to be skipped=%t, got %t", i, run.labels, run.expectedSkipped, skipped)
+		}
+	}
+}
+
+func TestContentDeduplicatorWindow(t *testing.T) {
+	deduplicator := newContentDeduplicator()
+	now := time.Now()
+
+	deduplicator.Record("hash", time.Minute, now)
+	if _, ok := deduplicator.DeployedWithin("hash", time.Minute, now.Add(30*time.Second)); !ok {
+		t.Errorf("expected the content to be deduplicated within the window")
+	}
+	if _, ok := deduplicator.DeployedWithin("hash", time.Minute, now.Add(2*time.Minute)); ok {
+		t.Errorf("expected the content not to be deduplicated after the window")
+	}
+}
+
+func TestEventIDCacheEvictsLeastRecentlySeen(t *testing.T) {
+	cache := newEventIDCache(2)
+
+	for _, id := range []string{"a", "b"} {
+		if cache.Seen(id) {
+			t.Errorf("expected %s not to be seen before", id)
+		}
+	}
+	if !cache.Seen("a") {
+		t.Errorf("expected a to be seen")
+	}
+	// b is the least recently seen ID and is forgotten
+	cache.Seen("c")
+	if !cache.Seen("a") {
+		t.Errorf("expected a to be remembered")
+	}
+	if cache.Seen("b") {
+		t.Errorf("expected b to be forgotten")
+	}
+}
+
+func TestHandleMonacoTriggeredEventSkipsDuplicateEvent(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+	defer func(original *eventIDCache) { processedEvents = original }(processedEvents)
+	processedEvents = newEventIDCache(10)
+
+	first := runMonacoTriggeredEventWithID(t, "redelivered-event")
+	if first.Result != keptnv2.ResultPass || first.Monaco.Skipped {
+		t.Fatalf("expected the first delivery to be deployed, got %s: %s", first.Result, first.Message)
+	}
+	runs := len(runner.runs)
+
+	second := runMonacoTriggeredEventWithID(t, "redelivered-event")
+	if second.Result != keptnv2.ResultPass || !second.Monaco.Skipped || second.Message != "Duplicate event, skipped" {
+		t.Errorf("expected the duplicate to be skipped, got %s: %s", second.Result, second.Message)
+	}
+	if len(runner.runs) != runs {
+		t.Errorf("expected monaco to run only for the first delivery, got %d runs", len(runner.runs))
+	}
+}
+
+func TestHandleMonacoTriggeredEventProcessesDuplicateEventIfIDDedupIsDisabled(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+	defer func(original *eventIDCache) { processedEvents = original }(processedEvents)
+	processedEvents = newEventIDCache(10)
+	defer func(idDedup bool) { env.EventIDDedup = idDedup }(env.EventIDDedup)
+	env.EventIDDedup = false
+
+	runMonacoTriggeredEventWithID(t, "redelivered-event")
+	runs := len(runner.runs)
+
+	second := runMonacoTriggeredEventWithID(t, "redelivered-event")
+	if second.Result != keptnv2.ResultPass || second.Monaco.Skipped {
+		t.Errorf("expected the redelivered event to be deployed again, got %s: %s", second.Result, second.Message)
+	}
+	if len(runner.runs) != 2*runs {
+		t.Errorf("expected monaco to run for both deliveries, got %d runs", len(runner.runs))
+	}
+}
+
+func TestHandleMonacoTriggeredEventSkipsSamePayload(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+	defer func(window time.Duration) { env.EventPayloadDedupWindow = window }(env.EventPayloadDedupWindow)
+	env.EventPayloadDedupWindow = time.Hour
+	defer func(original *contentDeduplicator) { deployedPayloads = original }(deployedPayloads)
+	deployedPayloads = newContentDeduplicator()
+
+	first := runMonacoTriggeredEventWithID(t, "first-event")
+	if first.Result != keptnv2.ResultPass || first.Monaco.Skipped {
+		t.Fatalf("expected the first event to be deployed, got %s: %s", first.Result, first.Message)
+	}
+	runs := len(runner.runs)
+
+	second := runMonacoTriggeredEventWithID(t, "retriggered-event")
+	if second.Result != keptnv2.ResultPass || !second.Monaco.Skipped || !strings.HasPrefix(second.Message, "Duplicate event, an event with the same payload") {
+		t.Errorf("expected the event with the same payload to be skipped, got %s: %s", second.Result, second.Message)
+	}
+	if len(runner.runs) != runs {
+		t.Errorf("expected monaco to run only for the first event, got %d runs", len(runner.runs))
+	}
+
+	// a different intent is deployed
+	if _, err := runMonacoTriggeredEventWithLabels(t, map[string]string{configRefLabel: "release-1.2"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(runner.runs) != 2*runs {
+		t.Errorf("expected monaco to run for the event with another config ref, got %d runs", len(runner.runs))
+	}
+}
+
+func TestGetPayloadHash(t *testing.T) {
+	data := &MonacoStartedEventData{EventData: keptnv2.EventData{Project: "sockshop", Stage: "dev", Service: "carts", Labels: map[string]string{"a": "1", "b": "2"}}}
+	hash := getPayloadHash(data)
+
+	reordered := &MonacoStartedEventData{EventData: keptnv2.EventData{Project: "sockshop", Stage: "dev", Service: "carts", Labels: map[string]string{"b": "2", "a": "1"}, Message: "re-triggered"}}
+	if getPayloadHash(reordered) != hash {
+		t.Errorf("expected the hash to only depend on the deployment intent")
+	}
+
+	otherStage := &MonacoStartedEventData{EventData: keptnv2.EventData{Project: "sockshop", Stage: "prod", Service: "carts", Labels: map[string]string{"a": "1", "b": "2"}}}
+	if getPayloadHash(otherStage) == hash {
+		t.Errorf("expected another stage to change the hash")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// deepLinkData is available in DEEP_LINK_TEMPLATE
+type deepLinkData struct {
+	// URL of the Dynatrace environment without trailing slash, e.g., https://abc12345.live.dynatrace.com
+	Environment  string
+	KeptnContext string
+	Project      string
+	Stage        string
+	Service      string
+}
+
+func parseDeepLinkTemplate(linkTemplate string) (*template.Template, error) {
+	return template.New("deepLink").Option("missingkey=error").Parse(linkTemplate)
+}
+
+/**
+ * Returns the link to the Dynatrace environment a run deployed to, e.g., https://abc12345.live.dynatrace.com/#dashboards.
+ * Returns an empty link if linkTemplate is empty.
+ */
+func getDeepLink(linkTemplate string, tenant string, keptnEvent *common.BaseKeptnEvent) (string, error) {
+	if linkTemplate == "" {
+		return "", nil
+	}
+	tmpl, err := parseDeepLinkTemplate(linkTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	environment := strings.TrimRight(tenant, "/")
+	if !strings.Contains(environment, "://") {
+		environment = "https://" + environment
+	}
+
+	var link bytes.Buffer
+	err = tmpl.Execute(&link, deepLinkData{
+		Environment:  environment,
+		KeptnContext: keptnEvent.Context,
+		Project:      keptnEvent.Project,
+		Stage:        keptnEvent.Stage,
+		Service:      keptnEvent.Service,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := url.Parse(link.String()); err != nil {
+		return "", err
+	}
+	return link.String(), nil
+}
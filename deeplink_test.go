@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+func TestGetDeepLink(t *testing.T) {
+	keptnEvent := &common.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "my-context"}
+
+	tests := []struct {
+		name         string
+		linkTemplate string
+		tenant       string
+		expectedLink string
+	}{
+		{name: "default template", linkTemplate: "{{.Environment}}/#dashboards", tenant: "https://abc12345.live.dynatrace.com", expectedLink: "https://abc12345.live.dynatrace.com/#dashboards"},
+		{name: "trailing slash", linkTemplate: "{{.Environment}}/#dashboards", tenant: "https://abc12345.live.dynatrace.com/", expectedLink: "https://abc12345.live.dynatrace.com/#dashboards"},
+		{name: "managed environment", linkTemplate: "{{.Environment}}/#dashboards", tenant: "https://dynatrace.example.com/e/0a1b2c3d", expectedLink: "https://dynatrace.example.com/e/0a1b2c3d/#dashboards"},
+		{name: "tenant without scheme", linkTemplate: "{{.Environment}}/#dashboards", tenant: "abc12345.live.dynatrace.com", expectedLink: "https://abc12345.live.dynatrace.com/#dashboards"},
+		{name: "event data", linkTemplate: "{{.Environment}}/#dashboards;gf=all;filter=tag:keptn_project:{{.Project}}", tenant: "https://abc12345.live.dynatrace.com", expectedLink: "https://abc12345.live.dynatrace.com/#dashboards;gf=all;filter=tag:keptn_project:sockshop"},
+		{name: "disabled", linkTemplate: "", tenant: "https://abc12345.live.dynatrace.com", expectedLink: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := getDeepLink(tt.linkTemplate, tt.tenant, keptnEvent)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if link != tt.expectedLink {
+				t.Errorf("expected %s, got %s", tt.expectedLink, link)
+			}
+		})
+	}
+}
+
+func TestHandleMonacoTriggeredEventIncludesDeepLink(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	defer useMonacoRunner(&fakeRunner{})()
+
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if link := getFinishedEventData(t, myKeptn).Monaco.DeepLink; link != "https://abc12345.live.dynatrace.com/#dashboards" {
+		t.Errorf("expected a link to the dashboards of the test environment, got %s", link)
+	}
+}
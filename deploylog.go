@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// how often the reaper looks for files older than DEPLOY_LOG_MAX_AGE and OUTPUT_MAX_AGE
+const fileReapInterval = time.Hour
+
+// deployLogFileData is available in DEPLOY_LOG_FILE_TEMPLATE
+type deployLogFileData struct {
+	KeptnContext string
+	Project      string
+	Stage        string
+	Service      string
+}
+
+func parseDeployLogFileTemplate(fileTemplate string) (*template.Template, error) {
+	return template.New("deployLogFile").Option("missingkey=error").Parse(fileTemplate)
+}
+
+/**
+ * Returns the path of the deploy log file of a run, e.g., <DEPLOY_LOG_DIR>/<keptncontext>-<stage>.log.
+ * The rendered file name must stay within logDir.
+ */
+func getDeployLogPath(logDir string, fileTemplate string, keptnEvent *common.BaseKeptnEvent) (string, error) {
+	tmpl, err := parseDeployLogFileTemplate(fileTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var fileName bytes.Buffer
+	err = tmpl.Execute(&fileName, deployLogFileData{
+		KeptnContext: keptnEvent.Context,
+		Project:      keptnEvent.Project,
+		Stage:        keptnEvent.Stage,
+		Service:      keptnEvent.Service,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logPath := filepath.Join(logDir, fileName.String())
+	if !strings.HasPrefix(logPath, filepath.Clean(logDir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("deploy log file %s is outside of %s", fileName.String(), logDir)
+	}
+	return logPath, nil
+}
+
+/**
+ * Opens the deploy log file of a run for appending. Returns nil if DEPLOY_LOG_DIR is not set or the file can't be
+ * opened, the run itself is never failed because of its log file.
+ */
+func openDeployLog(keptnEvent *common.BaseKeptnEvent) *os.File {
+	if env.DeployLogDir == "" {
+		return nil
+	}
+
+	logPath, err := getDeployLogPath(env.DeployLogDir, env.DeployLogFileTemplate, keptnEvent)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(logPath), 0755)
+	}
+	if err != nil {
+		log.Printf("Could not create deploy log file for %s: %v", keptnEvent.Context, err)
+		return nil
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Could not open deploy log file %s: %v", logPath, err)
+		return nil
+	}
+	return logFile
+}
+
+// writeDeployLog appends a timestamped line to the log of the run, if there is one
+func writeDeployLog(logFile io.Writer, format string, a ...interface{}) {
+	if logFile == nil {
+		return
+	}
+	fmt.Fprintf(logFile, "%s %s\n", time.Now().UTC().Format(time.RFC3339), fmt.Sprintf(format, a...))
+}
+
+/**
+ * Removes all files below dir that were last modified before now - maxAge and returns how many were removed.
+ */
+func reapFiles(dir string, maxAge time.Duration, now time.Time) int {
+	reaped := 0
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if now.Sub(info.ModTime()) > maxAge {
+			if err := os.Remove(path); err != nil {
+				log.Printf("Could not remove %s: %v", path, err)
+				return nil
+			}
+			reaped++
+		}
+		return nil
+	})
+	return reaped
+}
+
+// startFileReaper periodically removes the files below dir older than maxAge, e.g., the deploy log files
+func startFileReaper(kind string, dir string, maxAge time.Duration) {
+	go func() {
+		for {
+			if reaped := reapFiles(dir, maxAge, time.Now()); reaped > 0 {
+				log.Printf("Removed %d %s files older than %s", reaped, kind, maxAge)
+			}
+			time.Sleep(fileReapInterval)
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+func TestHandleMonacoTriggeredEventWritesDeployLog(t *testing.T) {
+	defer setupTestWorkDir(t, `echo "applying configs of $KEPTN_PROJECT"`, nil)()
+
+	logDir, _ := ioutil.TempDir("", "monaco-service-logs")
+	defer os.RemoveAll(logDir)
+
+	defer func(logDir string) { env.DeployLogDir = logDir }(env.DeployLogDir)
+	env.DeployLogDir = logDir
+
+	runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+
+	content, err := ioutil.ReadFile(filepath.Join(logDir, "08735340-6f9e-4b32-97ff-3b6c292bc50h-dev.log"))
+	if err != nil {
+		t.Fatalf("expected the deploy log file to be written: %v", err)
+	}
+
+	for _, expected := range []string{
+		"Starting monaco run for sockshop.dev.carts (keptncontext 08735340-6f9e-4b32-97ff-3b6c292bc50h)",
+		"Monaco command: ./monaco",
+		"applying configs of sockshop",
+		"Successfully ran monaco",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected deploy log to contain %q, got:\n%s", expected, content)
+		}
+	}
+}
+
+func TestGetDeployLogPath(t *testing.T) {
+	keptnEvent := &common.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "my-context"}
+
+	logPath, err := getDeployLogPath("/var/log/monaco", "{{.Project}}/{{.KeptnContext}}.log", keptnEvent)
+	if err != nil || logPath != "/var/log/monaco/sockshop/my-context.log" {
+		t.Errorf("expected /var/log/monaco/sockshop/my-context.log, got %s (%v)", logPath, err)
+	}
+
+	if _, err := getDeployLogPath("/var/log/monaco", "../{{.KeptnContext}}.log", keptnEvent); err == nil {
+		t.Errorf("expected an error for a deploy log outside of the log directory")
+	}
+}
+
+func TestReapDeployLogs(t *testing.T) {
+	logDir, _ := ioutil.TempDir("", "monaco-service-logs")
+	defer os.RemoveAll(logDir)
+
+	now := time.Now()
+	oldLog := filepath.Join(logDir, "old.log")
+	newLog := filepath.Join(logDir, "new.log")
+	ioutil.WriteFile(oldLog, []byte("old"), 0644)
+	ioutil.WriteFile(newLog, []byte("new"), 0644)
+	os.Chtimes(oldLog, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+
+	if reaped := reapFiles(logDir, 24*time.Hour, now); reaped != 1 {
+		t.Errorf("expected 1 reaped deploy log, got %d", reaped)
+	}
+	if common.FileExists(oldLog) {
+		t.Errorf("expected %s to be removed", oldLog)
+	}
+	if !common.FileExists(newLog) {
+		t.Errorf("expected %s to be kept", newLog)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// ErrorKind classifies why a monaco run could not be completed
+type ErrorKind int
+
+const (
+	// KindValidation indicates an invalid monaco or service configuration
+	KindValidation ErrorKind = iota
+	// KindFetch indicates that credentials or monaco files could not be retrieved
+	KindFetch
+	// KindExecution indicates that monaco itself failed
+	KindExecution
+	// KindTimeout indicates that monaco did not finish in time
+	KindTimeout
+	// KindAborted indicates that the run was aborted via sh.keptn.event.monaco.aborted
+	KindAborted
+	// KindCircuitOpen indicates that the Dynatrace environment kept failing and is not deployed to until its cooldown passed
+	KindCircuitOpen
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindValidation:
+		return "validation"
+	case KindFetch:
+		return "fetch"
+	case KindExecution:
+		return "execution"
+	case KindTimeout:
+		return "timeout"
+	case KindAborted:
+		return "aborted"
+	case KindCircuitOpen:
+		return "circuit open"
+	}
+	return "unknown"
+}
+
+// MonacoError is returned by HandleMonacoTriggeredEvent whenever a monaco run failed
+type MonacoError struct {
+	Kind ErrorKind
+	Err  error
+	// per config results of runs with monaco.continueOnError
+	ConfigResults *common.MonacoConfigResults
+	// rendered deployment manifest of runs that executed monaco, see ATTACH_MANIFEST
+	Manifest *common.DeploymentManifest
+	// existence check of the deployed configs of runs with monaco.verify
+	Verification *common.MonacoVerificationResult
+	// summary and duration of runs that executed monaco
+	Summary  *common.MonacoSummary
+	Duration time.Duration
+	// exit code of the monaco process, 0 if monaco didn't exit with an error code
+	ExitCode int
+	// redacted output of the failed monaco run, searched for known failures together with Err
+	Output string
+}
+
+// monacoExitCodeLabel is the label of the .finished event holding the exit code of a failed monaco process
+const monacoExitCodeLabel = "monaco.exitCode"
+
+/**
+ * Returns why monaco exited with code: 1 means that monaco rejected or couldn't apply the configuration, other codes
+ * point to the environment monaco runs in or the connection to Dynatrace
+ */
+func getMonacoExitReason(code int) string {
+	switch code {
+	case 1:
+		return "invalid monaco configuration"
+	case 126:
+		return "the monaco executable can't be executed"
+	case 127:
+		return "the monaco executable was not found"
+	case 137:
+		return "monaco was killed, e.g., because it ran out of memory"
+	}
+	return "the Dynatrace environment could not be reached or monaco failed unexpectedly"
+}
+
+func newMonacoError(kind ErrorKind, format string, a ...interface{}) *MonacoError {
+	return &MonacoError{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+func (e *MonacoError) Error() string {
+	return fmt.Sprintf("%s error: %v", e.Kind, e.Err)
+}
+
+func (e *MonacoError) Unwrap() error {
+	return e.Err
+}
+
+// FinishedEventData derives status, result and message of the .finished event from the error kind
+func (e *MonacoError) FinishedEventData() *keptnv2.EventData {
+	finishedData := &keptnv2.EventData{
+		Status: keptnv2.StatusErrored,
+		Result: keptnv2.ResultFailed,
+	}
+
+	switch e.Kind {
+	case KindValidation:
+		finishedData.Message = fmt.Sprintf("Invalid monaco configuration: %v", e.Err)
+	case KindFetch:
+		finishedData.Message = fmt.Sprintf("Failed to fetch monaco prerequisites: %v", e.Err)
+	case KindExecution:
+		// monaco was executed but could not apply the configuration
+		finishedData.Status = keptnv2.StatusSucceeded
+		finishedData.Message = fmt.Sprintf("Monaco failed: %v", e.Err)
+		if e.ExitCode > 0 {
+			finishedData.Message = fmt.Sprintf("Monaco failed with exit code %d (%s): %v", e.ExitCode, getMonacoExitReason(e.ExitCode), e.Err)
+			finishedData.Labels = map[string]string{monacoExitCodeLabel: strconv.Itoa(e.ExitCode)}
+		}
+	case KindTimeout:
+		finishedData.Message = fmt.Sprintf("Monaco did not finish in time: %v", e.Err)
+	case KindAborted:
+		finishedData.Message = fmt.Sprintf("Monaco run was aborted: %v", e.Err)
+	case KindCircuitOpen:
+		finishedData.Message = fmt.Sprintf("Circuit open, monaco was not run: %v", e.Err)
+	default:
+		finishedData.Message = e.Err.Error()
+	}
+	if hint := getRemediationHint(e.Err.Error() + "\n" + e.Output); hint != "" {
+		if finishedData.Labels == nil {
+			finishedData.Labels = map[string]string{}
+		}
+		finishedData.Labels[monacoRemediationHintLabel] = hint
+	}
+	return finishedData
+}
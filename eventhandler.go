@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// MonacoArgs are the inputs of a single monaco execution
+type MonacoArgs struct {
+	Credentials *common.DTCredentials
+	Event       *common.BaseKeptnEvent
+	Options     common.MonacoCommandOptions
+}
+
+// MonacoRunResult is the outcome of a single monaco execution
+type MonacoRunResult struct {
+	// combined stdout and stderr of monaco
+	Output string
+}
+
+// MonacoRunner executes monaco, HandleMonacoTriggeredEvent runs the dry run and the deployment through it
+type MonacoRunner interface {
+	Run(ctx context.Context, args MonacoArgs) (MonacoRunResult, error)
+}
+
+// monacoRunner executes monaco for all handled events, tests replace it with a fake
+var monacoRunner MonacoRunner = execRunner{}
+
+// execRunner runs the monaco executable
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, args MonacoArgs) (MonacoRunResult, error) {
+	output, err := common.ExecuteMonaco(ctx, args.Credentials, args.Event, args.Options)
+	return MonacoRunResult{Output: output}, err
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"os"
+	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
@@ -21,8 +25,9 @@ import (
 
 // GenericLogKeptnCloudEventHandler is a generic handler for Keptn Cloud Events that logs the CloudEvent
 func GenericLogKeptnCloudEventHandler(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
-	log.Printf("Handling %s Event: %s", incomingEvent.Type(), incomingEvent.Context.GetID())
-	log.Printf("CloudEvent %T: %v", data, data)
+	logger := newEventLogger(incomingEvent)
+	logger.Info(fmt.Sprintf("Handling %s Event: %s", incomingEvent.Type(), incomingEvent.Context.GetID()))
+	logger.Info(fmt.Sprintf("CloudEvent %T: %v", data, data))
 
 	return nil
 }
@@ -30,7 +35,7 @@ func GenericLogKeptnCloudEventHandler(myKeptn *keptnv2.Keptn, incomingEvent clou
 // HandleConfigureMonitoringTriggeredEvent handles configure-monitoring.triggered events
 // TODO: add in your handler code
 func HandleConfigureMonitoringTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.ConfigureMonitoringTriggeredEventData) error {
-	log.Printf("Handling configure-monitoring.triggered Event: %s", incomingEvent.Context.GetID())
+	newEventLogger(incomingEvent).Info(fmt.Sprintf("Handling configure-monitoring.triggered Event: %s", incomingEvent.Context.GetID()))
 
 	return nil
 }
@@ -38,10 +43,49 @@ func HandleConfigureMonitoringTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEve
 // HandleConfigureMonitoringTriggeredEvent handles configure-monitoring.triggered events
 // TODO: add in your handler code
 func HandleMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *MonacoStartedEventData) error {
-	fmt.Printf("Handling monaco.triggered Event: %s", incomingEvent.Context.GetID())
+	logger := newEventLogger(incomingEvent)
+	logger.Info(fmt.Sprintf("Handling monaco.triggered Event: %s", incomingEvent.Context.GetID()))
+	ctx, span := startEventSpan(&incomingEvent, "HandleMonacoTriggeredEvent")
+	defer span.End()
+	phases := &phaseTracer{ctx: ctx}
+	defer phases.End()
+
+	if len(data.Monaco.Stages) > 0 {
+		return handlePromotion(myKeptn, incomingEvent, data)
+	}
+
+	// other instances of the service are responsible for the stages that aren't in HANDLED_STAGES
+	if !isHandledStage(data.GetStage(), env.HandledStages) {
+		logger.Info(fmt.Sprintf("Skipping event %s, stage %s is not handled by this instance", incomingEvent.Context.GetID(), data.GetStage()))
+		finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+			Status:  keptnv2.StatusSucceeded,
+			Result:  keptnv2.ResultPass,
+			Message: fmt.Sprintf("Stage %s is not handled by this instance, skipped", data.GetStage()),
+		})
+		finishedData.Monaco.Skipped = true
+		_, err := myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+		return err
+	}
+
+	// re-triggered events with the same intent as a recent successful deployment are skipped even if their IDs differ
+	payloadHash := ""
+	if env.EventPayloadDedupWindow > 0 {
+		payloadHash = getPayloadHash(data)
+		if deployedAt, ok := deployedPayloads.DeployedWithin(payloadHash, env.EventPayloadDedupWindow, time.Now()); ok {
+			logger.Info(fmt.Sprintf("Skipping event %s, an event with the same payload was deployed at %s", incomingEvent.Context.GetID(), deployedAt.Format(time.RFC3339)))
+			finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+				Status:  keptnv2.StatusSucceeded,
+				Result:  keptnv2.ResultPass,
+				Message: fmt.Sprintf("Duplicate event, an event with the same payload was deployed at %s", deployedAt.Format(time.RFC3339)),
+			})
+			finishedData.Monaco.Skipped = true
+			_, err := myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+			return err
+		}
+	}
 
 	data.EventData.Message = "Starting to query for Monaco Projects"
-	_, err := myKeptn.SendTaskStartedEvent(data, ServiceName)
+	_, err := myKeptn.SendTaskStartedEvent(data, eventSource)
 
 	if err != nil {
 		return err
@@ -50,8 +94,11 @@ func HandleMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevent
 	var shkeptncontext string
 	incomingEvent.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
 
-	fmt.Sprintf("Handling Configuration Changed Event: %s", incomingEvent.Context.GetID())
-	fmt.Sprintf("Processing sh.keptn.event.configuration.change for %s.%s.%s", data.EventData.GetProject(), data.EventData.GetStage(), data.EventData.GetService())
+	// events without team extension use the default monaco files and credentials
+	var team string
+	incomingEvent.Context.ExtensionAs(teamExtension, &team)
+
+	logger.Info(fmt.Sprintf("Processing sh.keptn.event.monaco.triggered for %s.%s.%s", data.EventData.GetProject(), data.EventData.GetStage(), data.EventData.GetService()))
 
 	keptnEvent := &common.BaseKeptnEvent{}
 	keptnEvent.Project = data.EventData.GetProject()
@@ -59,8 +106,51 @@ func HandleMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevent
 	keptnEvent.Service = data.EventData.GetService()
 	keptnEvent.Labels = data.EventData.GetLabels()
 	keptnEvent.Context = shkeptncontext
+	keptnEvent.ConfigRef = getConfigRef(data)
+	keptnEvent.Image, keptnEvent.Tag = getImageAndTag(data.ConfigurationChange)
+	keptnEvent.Team = team
+
+	// sh.keptn.event.monaco.aborted for the keptn context cancels monaco
+	runCtx, runDone := runningDeployments.Start(keptnEvent.Context)
+	defer runDone()
+
+	// the deadline extension of the event bounds the run in addition to MONACO_TIMEOUT
+	deadline, err := getEventDeadline(incomingEvent)
+	if err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindTimeout, "the deadline %s of the event has already passed", deadline.Format(time.RFC3339)))
+	}
+	runCtx, cancelDeadline := withEventDeadline(runCtx, deadline)
+	defer cancelDeadline()
+
+	// mark the run as in progress until the .finished event was sent
+	removeInProgressMarker := writeInProgressMarker(incomingEvent, keptnEvent)
+	defer removeInProgressMarker()
+
+	// the full log of the run for external log shippers and the config repo (UPLOAD_LOGS)
+	deployLog := openDeployLog(keptnEvent)
+	if deployLog != nil {
+		defer deployLog.Close()
+	}
+	runLog, uploadedLog := newRunLog(deployLog, env.UploadLogs)
+	// whatever ends the run, including validation errors and skipped runs, its log is uploaded
+	defer uploadRunLog(keptnEvent, uploadedLog)
+	writeDeployLog(runLog, "Starting monaco run for %s.%s.%s (keptncontext %s)", keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, keptnEvent.Context)
+
+	if err := common.ValidateConfigRef(keptnEvent); err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+	}
+	if err := common.ValidateTeam(keptnEvent.Team); err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+	}
 
-	monacoConfigFile, _ := common.GetMonacoConfig(keptnEvent)
+	phases.Start("fetch")
+	monacoConfigFile, err := common.GetMonacoConfig(keptnEvent)
+	if errors.Is(err, common.ErrInvalidMonacoConfig) {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+	}
 	dtCreds := ""
 	if monacoConfigFile != nil {
 		// implementing https://github.com/keptn-contrib/dynatrace-sli-service/issues/90
@@ -72,6 +162,14 @@ func HandleMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevent
 		monacoConfigFile.DtCreds = "dynatrace"
 	}
 
+	// remediation actions deploy the monaco projects they are mapped to
+	if data.Action != nil {
+		monacoConfigFile.Projects = getRemediationActionProjects(data.Action.Action, env.RemediationActions)
+		if len(monacoConfigFile.Projects) == 0 {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "no monaco projects are mapped to the remediation action '%s'", data.Action.Action))
+		}
+	}
+
 	//
 	// Adding DtCreds as a label so users know which DtCreds was used
 	if data.EventData.Labels == nil {
@@ -79,38 +177,554 @@ func HandleMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevent
 	}
 	data.EventData.Labels["DtCreds"] = monacoConfigFile.DtCreds
 
-	dtCredentials, err := getDynatraceCredentials(dtCreds, data.Project)
+	var dtCredentials *common.DTCredentials
+	if data.Monaco.EnvironmentURL != "" {
+		// the event selects the Dynatrace environment, the monaco files get a generated environments file or manifest
+		var monacoErr *MonacoError
+		dtCredentials, monacoErr = getEventDynatraceCredentials(data.Monaco, data.Project, keptnEvent.Team, strings.Split(env.EnvironmentURLAllowedDomains, ","))
+		if monacoErr != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, monacoErr)
+		}
+		data.EventData.Labels["DtCreds"] = data.Monaco.TokenSecretRef
+	} else {
+		// the environments matching a pattern are only known from the manifest, their credentials are checked after
+		// the pattern was expanded
+		environment := keptnEvent.Labels[environmentLabel]
+		if common.IsEnvironmentPattern(environment) {
+			environment = ""
+		}
+		dtCredentials, err = getDynatraceCredentials(dtCreds, data.Project, keptnEvent.Team, environment)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindFetch, "failed to fetch Dynatrace credentials: %w", err))
+		}
+	}
+	keptnEvent.Tenant = dtCredentials.Tenant
 
+	// fail fast instead of deploying to a Dynatrace environment that keeps failing
+	if monacoErr := checkEnvironmentBreaker(dtCredentials.Tenant); monacoErr != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, monacoErr)
+	}
+
+	// only one deployment per project, stage and Dynatrace environment at a time, others queue up
+	lockCtx, unlock, err := deploymentLocks.Lock(runCtx, getDeploymentLockKey(keptnEvent.Project, keptnEvent.Stage, dtCredentials.Tenant), env.DeploymentLockTimeout)
 	if err != nil {
-		// fmt.Println("Failed to fetch Dynatrace credentials: " + err.Error())
-		finishedData := &keptnv2.EventData{
-			Status:  keptnv2.StatusErrored,
-			Result:  keptnv2.ResultFailed,
-			Message: fmt.Sprintf("Failed to fetch Dynatrace credentials: %v", err.Error()),
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, classifyLockError(runCtx, err))
+	}
+	defer unlock()
+	// a lost lock cancels the run, another deployment may be running already
+	runCtx = lockCtx
+
+	// protect smaller Dynatrace environments from too many parallel deployments
+	if concurrency := getEnvironmentConcurrency(dtCredentials.Tier, env.EnvironmentTierConcurrency, env.EnvironmentConcurrency); concurrency > 0 {
+		release, err := environmentSlots.Acquire(runCtx, dtCredentials.Tenant, concurrency, env.DeploymentLockTimeout)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, classifyLockError(runCtx, err))
 		}
-		_, err = myKeptn.SendTaskFinishedEvent(finishedData, ServiceName)
-		return err
+		defer release()
 	}
 
 	// Prepare the folder structure for monaco (create base + shkeptncontext temp folder, copy files, get monaco.zip, extract and copy to temp)
 	err = common.PrepareFiles(keptnEvent)
 	if err != nil {
-		// fmt.Println(fmt.Sprintf("Error preparing monaco files: %s", err.Error()))
-		finishedData := &keptnv2.EventData{
-			Status:  keptnv2.StatusErrored,
-			Result:  keptnv2.ResultFailed,
-			Message: fmt.Sprintf("Error preparing monaco files: %s", err.Error()),
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindFetch, "error preparing monaco files: %w", err))
+	}
+	defer cleanupTempFolder(keptnEvent, logger)
+	if err := common.MergeBaseConfigDirs(keptnEvent, env.BaseConfigDirs); err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindFetch, "error merging the base config directories: %w", err))
+	}
+	phases.Start("validate")
+
+	// only deploy the config types allowed by monaco.conf.yaml
+	var skippedTypes []string
+	if len(monacoConfigFile.AllowedTypes) > 0 {
+		if env.MonacoVersion != common.MonacoCLIVersion1 {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "allowedTypes in %s requires MONACO_CLI_VERSION=%s", common.MonacoConfigFilename, common.MonacoCLIVersion1))
+		}
+		skippedTypes, err = common.FilterMonacoConfigTypes(common.GetMonacoFolder(keptnEvent)+"/"+common.MonacoProjectsSubfolder, monacoConfigFile.AllowedTypes)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "could not filter the monaco config types: %w", err))
+		}
+		for _, skippedType := range skippedTypes {
+			logger.Info(fmt.Sprintf("Skipping %s, its config type is not in allowedTypes", skippedType))
+			writeDeployLog(runLog, "Skipping %s, its config type is not in allowedTypes", skippedType)
+		}
+	}
+
+	// never deploy configs containing leaked credentials
+	if env.SecretScan {
+		if monacoErr := scanForLeakedSecrets(keptnEvent); monacoErr != nil {
+			writeDeployLog(runLog, "Monaco run aborted: %v", monacoErr)
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, monacoErr)
+		}
+	}
+
+	// fill in the Keptn values of the run, e.g., $PROJECT or $IMAGE
+	unknownPlaceholders, err := common.ReplaceMonacoPlaceholders(common.GetMonacoFolder(keptnEvent), keptnEvent)
+	if err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "could not replace the placeholders in the monaco files: %w", err))
+	}
+	if len(unknownPlaceholders) > 0 {
+		logger.Info(fmt.Sprintf("Leaving unknown placeholders in the monaco files intact: %s", strings.Join(unknownPlaceholders, ", ")))
+		writeDeployLog(runLog, "Leaving unknown placeholders in the monaco files intact: %s", strings.Join(unknownPlaceholders, ", "))
+	}
+
+	// never start a deployment that monaco would abort halfway because of a broken yaml file
+	yamlProblems, err := common.ValidateMonacoYAML(common.GetMonacoFolder(keptnEvent))
+	if err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "could not validate the monaco files: %w", err))
+	}
+	if len(yamlProblems) > 0 {
+		writeDeployLog(runLog, "Monaco run aborted, invalid yaml files: %s", strings.Join(yamlProblems, "; "))
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "invalid yaml files: %s", strings.Join(yamlProblems, "; ")))
+	}
+
+	phases.End()
+
+	// stay within the rate limit of the Dynatrace environment, the wait is bounded like a monaco execution
+	throttleCtx, cancelThrottle := newMonacoContext(runCtx)
+	throttleErr := throttleDeployment(throttleCtx, dtCredentials)
+	cancelThrottle()
+	if throttleErr != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, throttleErr)
+	}
+
+	monacoOptions := common.MonacoCommandOptions{
+		TokenDelivery: env.TokenDelivery,
+		CLIVersion:    env.MonacoVersion,
+		SchemaMirror:  env.MonacoSchemaMirror,
+		User:          monacoUser,
+	}
+	verboseString := os.Getenv("MONACO_VERBOSE_MODE")
+	if verboseString == "" {
+		verboseString = "true"
+	}
+	monacoOptions.Verbose, _ = strconv.ParseBool(verboseString)
+	monacoOptions.Env, monacoOptions.EnvOverride, err = getMonacoEnv(data.Monaco.Env, env.MonacoEnvAllowed, env.MonacoEnvAllowOverride)
+	if err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+	}
+	if data.Action != nil {
+		// monaco files can read the action and its parameters, e.g., the new alerting threshold
+		if monacoOptions.Env == nil {
+			monacoOptions.Env = map[string]string{}
+		}
+		monacoOptions.Env["KEPTN_ACTION"] = data.Action.Action
+		monacoOptions.Env["KEPTN_ACTION_VALUE"] = getActionValue(data.Action.Value)
+	}
+	monacoOptions.Group = keptnEvent.Labels[groupLabel]
+	monacoOptions.Environment = keptnEvent.Labels[environmentLabel]
+	if monacoOptions.Group != "" && monacoOptions.Environment != "" {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "the labels %s and %s can't be set at the same time", groupLabel, environmentLabel))
+	}
+	if (monacoOptions.Group != "" || monacoOptions.Environment != "") && env.MonacoVersion != common.MonacoCLIVersion2 {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "the labels %s and %s require MONACO_CLI_VERSION=%s", groupLabel, environmentLabel, common.MonacoCLIVersion2))
+	}
+	if _, ok := keptnEvent.Labels[projectSubsetLabel]; ok && env.MonacoVersion != common.MonacoCLIVersion2 {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "the label %s requires MONACO_CLI_VERSION=%s", projectSubsetLabel, common.MonacoCLIVersion2))
+	}
+	monacoOptions.ContinueOnError, _ = strconv.ParseBool(keptnEvent.Labels[continueOnErrorLabel])
+	pinnedVersion, err := common.GetPinnedMonacoVersion(keptnEvent, keptnEvent.Labels[versionLabel])
+	if err != nil {
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+	}
+	if pinnedVersion != "" {
+		monacoOptions.Executable, err = common.GetMonacoVersionExecutable(env.MonacoVersionPath, pinnedVersion)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
 		}
-		_, err = myKeptn.SendTaskFinishedEvent(finishedData, ServiceName)
+		writeDeployLog(runLog, "Running monaco %s (%s)", pinnedVersion, monacoOptions.Executable)
+	}
+	if accountDeploy, _ := strconv.ParseBool(keptnEvent.Labels[accountDeployLabel]); accountDeploy {
+		if env.MonacoVersion != common.MonacoCLIVersion2 {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "the label %s requires MONACO_CLI_VERSION=%s", accountDeployLabel, common.MonacoCLIVersion2))
+		}
+		if monacoOptions.Group != "" || monacoOptions.Environment != "" {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "the label %s can't be combined with %s or %s", accountDeployLabel, groupLabel, environmentLabel))
+		}
+		accountConfigs, err := common.FindAccountConfigs(common.GetMonacoFolder(keptnEvent))
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+		}
+		monacoOptions.Account, err = common.GetAccountCredentials(env.AccountCredentialsSecret)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindFetch, "failed to fetch account credentials: %w", err))
+		}
+		writeDeployLog(runLog, "Deploying the account configs %s", strings.Join(accountConfigs, ", "))
+	}
+	monacoOptions.SecretPatterns = secretPatterns
+	if runLog != nil {
+		monacoOptions.Log = runLog
+	}
+
+	var projectGroups [][]string
+	if env.MonacoVersion == common.MonacoCLIVersion2 {
+		// the manifest defines the projects, only restrict them if monaco.conf.yaml lists some explicitly
+		monacoOptions.ManifestPath, err = common.FindMonacoManifest(keptnEvent)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+		}
+		if len(monacoConfigFile.Projects) > 0 {
+			monacoOptions.Projects = common.GenerateMonacoProjectStringFromMonacoConfig(monacoConfigFile, keptnEvent)
+		}
+		// the event can narrow the deployment down to some projects of the manifest
+		if subset, ok := keptnEvent.Labels[projectSubsetLabel]; ok {
+			projects, err := common.ValidateProjectSubset(monacoOptions.ManifestPath, subset)
+			if err != nil {
+				return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "invalid label %s: %w", projectSubsetLabel, err))
+			}
+			monacoOptions.Projects = strings.Join(projects, ",")
+		}
+		// a pattern like prod-* deploys to all matching environments of the manifest
+		if common.IsEnvironmentPattern(monacoOptions.Environment) {
+			environments, err := common.ExpandEnvironmentPattern(monacoOptions.ManifestPath, monacoOptions.Environment)
+			if err != nil {
+				return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "invalid label %s: %w", environmentLabel, err))
+			}
+			if data.Monaco.EnvironmentURL == "" {
+				dtCredentials, err = getEnvironmentsCredentials(dtCreds, data.Project, keptnEvent.Team, environments)
+				if err != nil {
+					return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindFetch, "failed to fetch Dynatrace credentials: %w", err))
+				}
+				keptnEvent.Tenant = dtCredentials.Tenant
+			}
+			writeDeployLog(runLog, "Deploying to the environments %s matching %s", strings.Join(environments, ", "), monacoOptions.Environment)
+			monacoOptions.Environment = strings.Join(environments, ",")
+		}
+	} else {
+		// make sure projects referenced by the deployed ones are deployed as well
+		projects, warnings, err := common.ResolveProjectDependencies(common.GetMonacoFolder(keptnEvent)+"/"+common.MonacoProjectsSubfolder, common.GetMonacoProjects(monacoConfigFile, keptnEvent), env.CrossProjectDeps)
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+		}
+		for _, warning := range warnings {
+			logger.Info("Warning: " + warning)
+			writeDeployLog(runLog, "Warning: %s", warning)
+			sendWarningLogEvent(myKeptn, warning)
+		}
+		monacoOptions.Projects = strings.Join(projects, ", ")
+
+		// projects that don't reference each other can be deployed by separate monaco runs in parallel
+		if env.MaxParallelDeployments > 1 && len(projects) > 1 {
+			projectGroups, err = common.GroupIndependentProjects(common.GetMonacoFolder(keptnEvent)+"/"+common.MonacoProjectsSubfolder, projects)
+			if err != nil {
+				return sendMonacoErrorFinishedEvent(myKeptn, logger, &MonacoError{Kind: KindValidation, Err: err})
+			}
+		}
+	}
+	if data.Monaco.EnvironmentURL != "" {
+		if env.MonacoVersion == common.MonacoCLIVersion2 {
+			monacoOptions.ManifestPath, err = common.WriteEnvironmentManifest(monacoOptions.ManifestPath, dtCredentials.Tenant)
+		} else {
+			monacoOptions.EnvironmentsFile, err = common.WriteEnvironmentsFile(common.GetMonacoFolder(keptnEvent), keptnEvent.Stage, dtCredentials.Tenant)
+		}
+		if err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindValidation, "could not generate the environment of %s: %w", dtCredentials.Tenant, err))
+		}
+		writeDeployLog(runLog, "Deploying to the environment %s of the event", dtCredentials.Tenant)
+	}
+
+	if monacoOptions.SchemaMirror != "" {
+		if err := checkSchemaMirror(monacoOptions.SchemaMirror); err != nil {
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, newMonacoError(KindFetch, "schema mirror %s is not reachable: %w", monacoOptions.SchemaMirror, err))
+		}
+	}
+
+	// skip runs deploying the same content as a recent successful run or as the last deployment to the stage
+	contentHash := ""
+	if env.ContentDedupWindow > 0 || env.SkipUnchanged {
+		contentHash, err = getContentHash(keptnEvent, dtCredentials.Tenant, monacoOptions, common.GetMonacoFolder(keptnEvent))
+		if err != nil {
+			logger.Error(fmt.Sprintf("Could not hash the monaco files, not deduplicating: %v", err))
+			contentHash = ""
+		}
+	}
+	if contentHash != "" && env.SkipUnchanged && isUnchanged(deployedHashes, keptnEvent, contentHash) {
+		writeDeployLog(runLog, "Skipped monaco run, the configuration did not change since the last deployment")
+		finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+			Status:  keptnv2.StatusSucceeded,
+			Result:  keptnv2.ResultPass,
+			Message: fmt.Sprintf("Skipped monaco, no changes since the last deployment to %s", keptnEvent.Stage),
+		})
+		finishedData.Monaco.Skipped = true
+		_, err = myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
 		return err
 	}
+	if contentHash != "" && env.ContentDedupWindow > 0 {
+		if deployedAt, ok := deployedContents.DeployedWithin(contentHash, env.ContentDedupWindow, time.Now()); ok {
+			writeDeployLog(runLog, "Skipped monaco run, the same configuration was deployed at %s", deployedAt.Format(time.RFC3339))
+			finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+				Status:  keptnv2.StatusSucceeded,
+				Result:  keptnv2.ResultPass,
+				Message: fmt.Sprintf("Skipped monaco, the same configuration was deployed at %s", deployedAt.Format(time.RFC3339)),
+			})
+			finishedData.Monaco.Skipped = true
+			_, err = myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+			return err
+		}
+	}
+
+	var manifest *common.DeploymentManifest
+	if env.AttachManifest {
+		manifest, err = common.RenderDeploymentManifest(dtCredentials, keptnEvent, monacoOptions, secretPatterns)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Could not render the deployment manifest, not attaching it: %v", err))
+		}
+	}
+
+	// production stages only get a plan until the deployment is approved, any stage if only a dry run is requested
+	approved, _ := strconv.ParseBool(keptnEvent.Labels[approvedLabel])
+	dryRun, _ := strconv.ParseBool(keptnEvent.Labels[dryRunLabel])
+	if dryRun || (!approved && isProductionStage(keptnEvent.Stage, env.ProdStages)) {
+		phases.Start("execute")
+		status := startStatusReporter(myKeptn, monacoOptions.Projects, env.StatusInterval)
+		defer status.Stop()
+		plan, monacoErr := planMonaco(runCtx, monacoRunner, dtCredentials, keptnEvent, monacoOptions, status)
+		status.Stop()
+		recordEnvironmentResult(dtCredentials.Tenant, monacoErr)
+		if monacoErr != nil {
+			monacoErr.Manifest = manifest
+			writeDeployLog(runLog, "Monaco plan failed: %v", monacoErr)
+			return sendMonacoErrorFinishedEvent(myKeptn, logger, monacoErr)
+		}
+		changes := common.ParseMonacoPlan(plan)
 
-	// generate projects string for monaco
-	monacoProjects := common.GenerateMonacoProjectStringFromMonacoConfig(monacoConfigFile, keptnEvent)
+		var finishedData *MonacoFinishedEventData
+		if dryRun {
+			writeDeployLog(runLog, "Only planned the deployment to stage %s (%s=true)", keptnEvent.Stage, dryRunLabel)
+			finishedData = newMonacoFinishedEventData(&keptnv2.EventData{
+				Status:  keptnv2.StatusSucceeded,
+				Result:  keptnv2.ResultPass,
+				Message: fmt.Sprintf("Monaco dry run for stage %s planned %d config changes, nothing was applied", keptnEvent.Stage, len(changes)),
+			})
+		} else {
+			writeDeployLog(runLog, "Holding the deployment to production stage %s until it is approved", keptnEvent.Stage)
+			finishedData = newMonacoFinishedEventData(&keptnv2.EventData{
+				Status:  keptnv2.StatusSucceeded,
+				Result:  keptnv2.ResultWarning,
+				Message: fmt.Sprintf("Monaco configuration for production stage %s was planned but not applied, trigger the deployment again with the label %s=true to apply it", keptnEvent.Stage, approvedLabel),
+			})
+			finishedData.Monaco.AwaitingApproval = true
+		}
+		finishedData.Monaco.Plan = plan
+		finishedData.Monaco.Changes = changes
+		finishedData.Monaco.Manifest = manifest
+		_, err = myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+		return err
+	}
 
 	// test and apply monaco configuration
-	err = callMonaco(dtCredentials, keptnEvent, monacoProjects)
+	phases.Start("execute")
+	deploymentStart := time.Now()
+	status := startStatusReporter(myKeptn, monacoOptions.Projects, env.StatusInterval)
+	defer status.Stop()
+	var deploymentOutput string
+	var monacoErr *MonacoError
+	if len(projectGroups) > 1 {
+		deploymentOutput, monacoErr = callMonacoInParallel(runCtx, logger, monacoRunner, dtCredentials, keptnEvent, monacoOptions, status, projectGroups, env.MaxParallelDeployments)
+	} else {
+		deploymentOutput, monacoErr = callMonaco(runCtx, logger, monacoRunner, dtCredentials, keptnEvent, monacoOptions, status)
+	}
+	status.Stop()
+	recordEnvironmentResult(dtCredentials.Tenant, monacoErr)
+
+	// with continueOnError the run only passes if every config was deployed
+	var configResults *common.MonacoConfigResults
+	if monacoOptions.ContinueOnError && (monacoErr == nil || monacoErr.Kind == KindExecution) {
+		configResults = common.ParseMonacoConfigResults(deploymentOutput)
+		if configResults.Failed > 0 {
+			monacoErr = newMonacoError(KindExecution, "%d of %d configs failed to deploy: %s", configResults.Failed, configResults.Failed+configResults.Succeeded, strings.Join(configResults.FailedConfigs, ", "))
+		}
+		if monacoErr != nil {
+			monacoErr.ConfigResults = configResults
+		}
+	}
+
+	// check that the deployed configs actually exist in Dynatrace
+	var verification *common.MonacoVerificationResult
+	if verify, _ := strconv.ParseBool(keptnEvent.Labels[verifyLabel]); verify && monacoErr == nil {
+		verification, err = common.VerifyDeployedEntities(dtCredentials, common.ParseDeployedEntities(deploymentOutput))
+		if err != nil {
+			monacoErr = newMonacoError(KindFetch, "verification of the deployed configs failed: %w", err)
+		} else if len(verification.Missing) > 0 {
+			monacoErr = newMonacoError(KindExecution, "%d deployed configs don't exist in Dynatrace: %s", len(verification.Missing), strings.Join(verification.Missing, ", "))
+			monacoErr.Verification = verification
+		}
+	}
+
+	deploymentResult := keptnv2.ResultPass
+	if monacoErr != nil {
+		deploymentResult = keptnv2.ResultFailed
+	}
+	summary := common.ParseMonacoSummary(deploymentOutput)
+	if summary.Environment == "" {
+		summary.Environment = getDynatraceEnvironmentName(dtCredentials.Tenant)
+	}
+
+	telemetry := deploymentTelemetry{
+		Project:  keptnEvent.Project,
+		Stage:    keptnEvent.Stage,
+		Tenant:   dtCredentials.Tenant,
+		Result:   string(deploymentResult),
+		Start:    deploymentStart,
+		Duration: time.Since(deploymentStart),
+	}
+
+	if monacoErr != nil {
+		exportDeploymentTelemetry(telemetry)
+		monacoErr.Summary = summary
+		monacoErr.Duration = telemetry.Duration
+		monacoErr.Manifest = manifest
+		writeDeployLog(runLog, "Monaco run failed: %v", monacoErr)
+		return sendMonacoErrorFinishedEvent(myKeptn, logger, monacoErr)
+	}
+	writeDeployLog(runLog, "Successfully ran monaco")
+
+	// the export is only informative, the deployment passes even if it fails
+	exported := 0
+	if env.ExportAfterDeploy {
+		exported, err = exportDeployedConfigs(runCtx, monacoRunner, dtCredentials, keptnEvent, monacoOptions)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Could not export the deployed configs of %s/%s: %v", keptnEvent.Project, keptnEvent.Stage, err))
+		}
+	}
+	if contentHash != "" && env.ContentDedupWindow > 0 {
+		deployedContents.Record(contentHash, env.ContentDedupWindow, time.Now())
+	}
+	if payloadHash != "" {
+		deployedPayloads.Record(payloadHash, env.EventPayloadDedupWindow, time.Now())
+	}
+	if contentHash != "" && env.SkipUnchanged {
+		if err := deployedHashes.Record(keptnEvent.Project, keptnEvent.Stage, contentHash); err != nil {
+			logger.Error(fmt.Sprintf("Could not record the deployed configuration of %s/%s: %v", keptnEvent.Project, keptnEvent.Stage, err))
+		}
+	}
+
+	outcome := getMonacoOutcome(deploymentOutput)
+	telemetry.Outcome = outcome
+	exportDeploymentTelemetry(telemetry)
+
+	finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+		Status:  keptnv2.StatusSucceeded,
+		Result:  keptnv2.ResultPass,
+		Message: "Successfully ran monaco!",
+	})
+	if outcome == MonacoOutcomeNoChanges {
+		finishedData.Message = "Successfully ran monaco, the configuration was already up-to-date"
+		finishedData.Result = keptnv2.ResultType(env.NoChangeResult)
+	} else if len(projectGroups) > 1 {
+		finishedData.Message = fmt.Sprintf("Successfully ran monaco for the projects %s in %d parallel deployments!", monacoOptions.Projects, len(projectGroups))
+	}
+	// recognized warnings of a successful run, e.g., about deprecated config types, are reported with the result warning
+	if warnings := common.ParseMonacoWarnings(deploymentOutput, warningPatterns); len(warnings) > 0 {
+		writeDeployLog(runLog, "Monaco reported %d warnings", len(warnings))
+		finishedData.Result = keptnv2.ResultWarning
+		finishedData.Message = fmt.Sprintf("Successfully ran monaco with %d warnings: %s", len(warnings), strings.Join(warnings, "; "))
+		finishedData.Monaco.Warnings = warnings
+		sendWarningLogEvent(myKeptn, finishedData.Message)
+	}
+	finishedData.Monaco.KeptnContext = keptnEvent.Context
+	finishedData.Monaco.Outcome = outcome
+	if keptnEvent.Commit != "" {
+		// the config revision that was applied, for auditability
+		finishedData.Labels = map[string]string{appliedCommitLabel: keptnEvent.Commit}
+	}
+	finishedData.Monaco.DeepLink, err = getDeepLink(env.DeepLinkTemplate, dtCredentials.Tenant, keptnEvent)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Could not create the link to the Dynatrace environment: %v", err))
+	}
+	finishedData.Monaco.Configs = configResults
+	finishedData.Monaco.Manifest = manifest
+	finishedData.Monaco.SkippedTypes = skippedTypes
+	finishedData.Monaco.Verification = verification
+	finishedData.Monaco.Exported = exported
+	if env.AttachOutput {
+		if err := setMonacoOutputLabel(myKeptn, &finishedData.EventData, deploymentOutput); err != nil {
+			logger.Error(fmt.Sprintf("Could not attach the monaco output: %v", err))
+		}
+	}
+	setMonacoSummary(&finishedData.Monaco, summary, telemetry.Duration)
+	applyFinishedMessageTemplate(myKeptn, finishedData, telemetry.Duration)
+	_, err = myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+
+	return err
+}
+
+// getImageAndTag returns the image of a deployment and its tag, e.g., docker.io/keptnexamples/carts:0.12.1 and 0.12.1
+func getImageAndTag(configurationChange keptnv2.ConfigurationChange) (string, string) {
+	image, _ := configurationChange.Values["image"].(string)
+	if separator := strings.LastIndex(image, ":"); separator > strings.LastIndex(image, "/") {
+		return image, image[separator+1:]
+	}
+	return image, ""
+}
+
+// label deploying all configs that can be deployed instead of aborting on the first failing one
+const continueOnErrorLabel = "monaco.continueOnError"
+
+// label deploying the account resources (users, groups, policies) of the manifest instead of environment configs
+const accountDeployLabel = "monaco.accountDeploy"
+
+// label selecting a pre-installed monaco release, overrides the .monaco-version file of the monaco files
+const versionLabel = "monaco.version"
+
+// label approving the deployment to a production stage, see PROD_STAGES
+const approvedLabel = "monaco.approved"
+
+// label only planning the deployment: monaco runs in dry-run mode and the .finished event lists the config changes
+const dryRunLabel = "monaco.dryRun"
 
+// isProductionStage returns whether deployments to stage need to be approved
+func isProductionStage(stage string, prodStages []string) bool {
+	for _, prodStage := range prodStages {
+		if strings.TrimSpace(prodStage) == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// isHandledStage returns whether this instance deploys to stage, all stages are handled if handledStages is empty
+func isHandledStage(stage string, handledStages []string) bool {
+	if len(handledStages) == 0 {
+		return true
+	}
+	for _, handledStage := range handledStages {
+		if strings.TrimSpace(handledStage) == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// label checking after the deployment that the configs monaco created or updated exist in Dynatrace
+const verifyLabel = "monaco.verify"
+
+// labels selecting the environment group or the single environment of the monaco v2 manifest to deploy to
+const groupLabel = "monaco.group"
+const environmentLabel = "monaco.environment"
+
+// label selecting a comma separated subset of the projects of the monaco v2 manifest, passed as --project flags
+const projectSubsetLabel = "monaco.projectSubset"
+
+// label of the .finished event naming the git commit of the deployed monaco files
+const appliedCommitLabel = "monaco.appliedCommit"
+
+// label selecting the git branch or tag the monaco files are fetched from
+const configRefLabel = "monaco.configRef"
+
+// getConfigRef returns the git branch or tag requested by the event, empty for the default branch
+func getConfigRef(data *MonacoStartedEventData) string {
+	if configRef := data.Labels[configRefLabel]; configRef != "" {
+		return configRef
+	}
+	return data.GitBranch
+}
+
+// CloudEvent extension routing the event to the monaco files and Dynatrace environment of a team
+const teamExtension = "team"
+
+// cleanupTempFolder removes the temp folder of the run unless MONACO_KEEP_TEMP_DIR is set
+func cleanupTempFolder(keptnEvent *common.BaseKeptnEvent, logger Logger) {
 	keeptempString := os.Getenv("MONACO_KEEP_TEMP_DIR")
 	if keeptempString == "" {
 		keeptempString = "true"
@@ -118,33 +732,71 @@ func HandleMonacoTriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevent
 	keeptemp, _ := strconv.ParseBool(keeptempString)
 
 	if keeptemp {
-		fmt.Sprintf("Not deleting temp folder (MONACO_KEEP_TEMP_DIR=true) for %s", keptnEvent.Context)
+		logger.Info(fmt.Sprintf("Not deleting temp folder (MONACO_KEEP_TEMP_DIR=true) for %s", keptnEvent.Context))
 	} else {
 		// Clean up: remove temp folder for Context
-		err = common.DeleteTempFolderForKeptnContext(keptnEvent)
-		fmt.Sprintf("Delete temp folder for %s", keptnEvent.Context)
+		common.DeleteTempFolderForKeptnContext(keptnEvent)
+		logger.Info(fmt.Sprintf("Delete temp folder for %s", keptnEvent.Context))
 	}
+}
 
-	finishedData := &keptnv2.EventData{
-		Status:  keptnv2.StatusSucceeded,
-		Result:  keptnv2.ResultPass,
-		Message: "Successfully ran monaco!",
+// sendMonacoErrorFinishedEvent reports the failed monaco run via a .finished event and returns the MonacoError,
+// unless the event could not be sent at all
+func sendMonacoErrorFinishedEvent(myKeptn *keptnv2.Keptn, logger Logger, monacoErr *MonacoError) error {
+	logger.Error(fmt.Sprintf("Monaco run failed: %v", monacoErr))
+	finishedData := newMonacoFinishedEventData(monacoErr.FinishedEventData())
+	finishedData.Monaco.Configs = monacoErr.ConfigResults
+	finishedData.Monaco.Manifest = monacoErr.Manifest
+	finishedData.Monaco.Verification = monacoErr.Verification
+	finishedData.Monaco.Aborted = monacoErr.Kind == KindAborted
+	if env.AttachOutput {
+		if err := setMonacoOutputLabel(myKeptn, &finishedData.EventData, monacoErr.Output); err != nil {
+			logger.Error(fmt.Sprintf("Could not attach the monaco output: %v", err))
+		}
+	}
+	if monacoErr.Summary != nil {
+		setMonacoSummary(&finishedData.Monaco, monacoErr.Summary, monacoErr.Duration)
 	}
-	_, err = myKeptn.SendTaskFinishedEvent(finishedData, ServiceName)
+	sendErrorLogEvent(myKeptn, finishedData.Message)
+	applyFinishedMessageTemplate(myKeptn, finishedData, monacoErr.Duration)
+	_, err := myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+	if err != nil {
+		return err
+	}
+	return monacoErr
+}
 
-	return nil
+// setMonacoSummary adds the machine-readable result of the monaco run to the .finished event
+func setMonacoSummary(result *MonacoResult, summary *common.MonacoSummary, duration time.Duration) {
+	result.ConfigsApplied = summary.ConfigsApplied
+	result.ConfigsFailed = summary.ConfigsFailed
+	result.Environment = summary.Environment
+	result.Duration = duration.Round(time.Millisecond).String()
 }
 
-func getDynatraceCredentials(secretName string, project string) (*common.DTCredentials, error) {
+/**
+ * Returns the credentials of the first of the candidate secrets that exists. Secrets with credentials per monaco
+ * environment must have credentials for environment.
+ */
+func getDynatraceCredentials(secretName string, project string, team string, environment string) (*common.DTCredentials, error) {
 
-	secretNames := []string{secretName, fmt.Sprintf("dynatrace-credentials-%s", project), "dynatrace-credentials", "dynatrace"}
+	secretNames := []string{secretName}
+	if team != "" {
+		// the Dynatrace environment of the team
+		secretNames = append(secretNames, fmt.Sprintf("dynatrace-credentials-team-%s", team))
+	}
+	secretNames = append(secretNames, fmt.Sprintf("dynatrace-credentials-%s", project), "dynatrace-credentials", "dynatrace")
 
 	for _, secret := range secretNames {
 		if secret == "" {
 			continue
 		}
 
-		dtCredentials, err := common.GetDTCredentials(secret)
+		dtCredentials, err := common.GetDTCredentialsForEnvironment(secret, environment)
+		if errors.Is(err, common.ErrNoEnvironmentCredentials) {
+			// never fall back to the credentials of another environment
+			return nil, err
+		}
 
 		/* if err != nil {
 			fmt.Println("Error retrieving secret '%s': %v", secret, err)
@@ -160,31 +812,297 @@ func getDynatraceCredentials(secretName string, project string) (*common.DTCrede
 	return nil, errors.New("Could not find any Dynatrace specific secrets with the following names: " + strings.Join(secretNames, ","))
 }
 
-func callMonaco(dtCredentials *common.DTCredentials, keptnEvent *common.BaseKeptnEvent, projects string) error {
+/**
+ * Returns the credentials of the environments an environment pattern matched. They are looked up per environment, so
+ * no environment is deployed with the credentials of another one, and fail if one of them has no credentials. A single
+ * monaco run only gets one token, so all environments must have the same credentials.
+ */
+func getEnvironmentsCredentials(secretName string, project string, team string, environments []string) (*common.DTCredentials, error) {
+	var credentials *common.DTCredentials
+	for _, environment := range environments {
+		environmentCredentials, err := getDynatraceCredentials(secretName, project, team, environment)
+		if err != nil {
+			return nil, err
+		}
+		if credentials == nil {
+			credentials = environmentCredentials
+		} else if *environmentCredentials != *credentials {
+			return nil, fmt.Errorf("the environments %s have different Dynatrace credentials, deploy them with separate events", strings.Join(environments, ", "))
+		}
+	}
+	return credentials, nil
+}
 
-	// Get Env-Variables on whether we should first do a dry run and whether we should do verbose
-	verboseString := os.Getenv("MONACO_VERBOSE_MODE")
-	if verboseString == "" {
-		verboseString = "true"
+/**
+ * Returns the credentials for the environment URL of the event, the token is read from its tokenSecretRef. The URL
+ * is only trusted if it is below one of allowedDomains, so events can't send the token elsewhere.
+ */
+func getEventDynatraceCredentials(parameters MonacoParameters, project string, team string, allowedDomains []string) (*common.DTCredentials, *MonacoError) {
+	if parameters.TokenSecretRef == "" {
+		return nil, newMonacoError(KindValidation, "monaco.environmentUrl requires monaco.tokenSecretRef")
+	}
+	if !isProjectTokenSecret(parameters.TokenSecretRef, project, team) {
+		return nil, newMonacoError(KindValidation, "monaco.tokenSecretRef '%s' is not a secret of project %s, must be dynatrace-credentials-%s, dynatrace-credentials-%s-<name> or the secret of the team", parameters.TokenSecretRef, project, project, project)
+	}
+	if len(allowedDomains) == 1 && strings.TrimSpace(allowedDomains[0]) == "" {
+		allowedDomains = nil
+	}
+	environmentURL, err := common.ValidateEnvironmentURL(parameters.EnvironmentURL, allowedDomains)
+	if err != nil {
+		return nil, &MonacoError{Kind: KindValidation, Err: err}
+	}
+	token, err := common.GetDTAPIToken(parameters.TokenSecretRef)
+	if err != nil {
+		return nil, newMonacoError(KindFetch, "failed to fetch Dynatrace credentials: %w", err)
+	}
+	return &common.DTCredentials{Tenant: environmentURL, ApiToken: token}, nil
+}
+
+/**
+ * Events may only reference the secrets of their own project or team, just like the credentials looked up by
+ * getDynatraceCredentials: dynatrace-credentials-<project>, dynatrace-credentials-<project>-<name> and
+ * dynatrace-credentials-team-<team>
+ */
+func isProjectTokenSecret(secretName string, project string, team string) bool {
+	projectSecret := fmt.Sprintf("dynatrace-credentials-%s", project)
+	if project != "" && (secretName == projectSecret || strings.HasPrefix(secretName, projectSecret+"-")) {
+		return true
 	}
+	return team != "" && secretName == fmt.Sprintf("dynatrace-credentials-team-%s", team)
+}
+
+// variables set by the service that can't be overridden via monaco.env unless listed in MONACO_ENV_ALLOW_OVERRIDE
+var protectedMonacoEnv = []string{"DT_API_TOKEN", "DT_API_TOKEN_FILE", "DT_ENVIRONMENT_URL", "MONACO_SCHEMA_MIRROR"}
+
+// variables monaco.env can never set, even if MONACO_ENV_ALLOWED allows them: they redirect the traffic of monaco
+// (and with it the API token), change what is executed or replace the account credentials
+var deniedMonacoEnv = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY", "PATH", "HOME", "SSL_CERT_FILE", "SSL_CERT_DIR",
+	common.AccountUUIDKey, common.AccountClientIDKey, common.AccountClientSecretKey}
+
+// prefixes of variables monaco.env can never set, e.g., LD_PRELOAD
+var deniedMonacoEnvPrefixes = []string{"LD_", "DYLD_"}
+
+// prefix of the variables describing the Keptn event, they are never overridden
+const keptnMonacoEnvPrefix = "KEPTN_"
+
+var monacoEnvNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+/**
+ * Validates the environment variables requested via monaco.env: names must be valid and listed in allowed (entries
+ * ending with * are prefixes), protected variables may only be overridden if allowOverride lists them. Returns the
+ * variables for the monaco templates and the overrides of protected variables separately.
+ */
+func getMonacoEnv(requested map[string]string, allowed []string, allowOverride []string) (map[string]string, map[string]string, error) {
+	if len(requested) == 0 {
+		return nil, nil, nil
+	}
+
+	monacoEnv := map[string]string{}
+	overrides := map[string]string{}
+	for name, value := range requested {
+		if !monacoEnvNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid monaco.env variable name '%s'", name)
+		}
+		if strings.HasPrefix(name, keptnMonacoEnvPrefix) {
+			return nil, nil, fmt.Errorf("monaco.env must not set %s, variables starting with %s are reserved", name, keptnMonacoEnvPrefix)
+		}
+		if isDeniedMonacoEnv(name) {
+			return nil, nil, fmt.Errorf("monaco.env must not set %s", name)
+		}
+		if containsString(protectedMonacoEnv, name) {
+			if !containsString(allowOverride, name) {
+				return nil, nil, fmt.Errorf("monaco.env must not override %s unless it is listed in MONACO_ENV_ALLOW_OVERRIDE", name)
+			}
+			overrides[name] = value
+			continue
+		}
+		if !isAllowedMonacoEnv(name, allowed) {
+			return nil, nil, fmt.Errorf("monaco.env must not set %s unless it is allowed by MONACO_ENV_ALLOWED", name)
+		}
+		monacoEnv[name] = value
+	}
+	return monacoEnv, overrides, nil
+}
+
+func isDeniedMonacoEnv(name string) bool {
+	upperName := strings.ToUpper(name)
+	if containsString(deniedMonacoEnv, upperName) {
+		return true
+	}
+	for _, prefix := range deniedMonacoEnvPrefixes {
+		if strings.HasPrefix(upperName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedMonacoEnv(name string, allowed []string) bool {
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if entry == name || (strings.HasSuffix(entry, "*") && strings.HasPrefix(name, strings.TrimSuffix(entry, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getActionValue formats the value of a remediation action: strings as they are, everything else as JSON
+func getActionValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if stringValue, ok := value.(string); ok {
+		return stringValue
+	}
+	jsonValue, _ := json.Marshal(value)
+	return string(jsonValue)
+}
+
+// pattern matching the output of monaco runs without changes, configured via NO_CHANGES_PATTERN
+var noChangesPattern = common.DefaultNoChangesPattern
+
+// getMonacoOutcome classifies the output of a successful deployment
+func getMonacoOutcome(deploymentOutput string) string {
+	if noChangesPattern.MatchString(deploymentOutput) {
+		return MonacoOutcomeNoChanges
+	}
+	return MonacoOutcomeDeployed
+}
+
+// patterns matching warnings in the output of successful monaco runs, configured via WARNING_PATTERNS, none by default
+var warningPatterns []*regexp.Regexp
+
+// OS user and group monaco runs as, configured via MONACO_UID and MONACO_GID
+var monacoUser *common.MonacoUser
+
+// patterns used to detect hardcoded secrets in monaco files, configured via SECRET_PATTERNS
+var secretPatterns = common.DefaultSecretPatterns
+
+func scanForLeakedSecrets(keptnEvent *common.BaseKeptnEvent) *MonacoError {
+	findings, err := common.FindLeakedSecrets(common.GetMonacoFolder(keptnEvent), secretPatterns)
+	if err != nil {
+		return newMonacoError(KindFetch, "could not scan monaco files for secrets: %w", err)
+	}
+	if len(findings) > 0 {
+		locations := []string{}
+		for _, finding := range findings {
+			locations = append(locations, finding.String())
+		}
+		return newMonacoError(KindValidation, "found hardcoded secrets, remove them from the monaco files before deploying: %s", strings.Join(locations, ", "))
+	}
+	return nil
+}
+
+/**
+ * Runs the dry run (unless MONACO_DRYRUN=false) and the deployment with runner, returns the output of the deployment
+ */
+func callMonaco(runCtx context.Context, logger Logger, runner MonacoRunner, dtCredentials *common.DTCredentials, keptnEvent *common.BaseKeptnEvent, options common.MonacoCommandOptions, status *statusReporter) (string, *MonacoError) {
+
+	// Get Env-Variable on whether we should first do a dry run
 	dryrunString := os.Getenv("MONACO_DRYRUN")
 	if dryrunString == "" {
 		dryrunString = "true"
 	}
 
-	verbose, _ := strconv.ParseBool(verboseString)
 	dryrun, _ := strconv.ParseBool(dryrunString)
 
+	ctx, cancel := newMonacoContext(runCtx)
+	defer cancel()
+
 	if dryrun {
 		// Dry Run to test configuration structure
-		err := common.ExecuteMonaco(dtCredentials, keptnEvent, projects, verbose, true)
-		if err != nil {
-			return err
+		status.SetPhase("dry run")
+		options.DryRun = true
+		result, err := runner.Run(ctx, MonacoArgs{Credentials: dtCredentials, Event: keptnEvent, Options: options})
+		if err != nil && options.ContinueOnError && ctx.Err() == nil {
+			// the failing configs are reported by the deployment
+			logger.Info(fmt.Sprintf("Monaco dry run failed, continuing with the deployment (monaco.continueOnError): %v", err))
+		} else if err != nil {
+			monacoErr := classifyMonacoExecutionError(ctx, "dry run", err)
+			monacoErr.Output = redactMonacoOutput(result.Output, dtCredentials, options)
+			return "", monacoErr
 		}
 	}
 
 	// Apply configuration
-	err := common.ExecuteMonaco(dtCredentials, keptnEvent, projects, verbose, false)
+	status.SetPhase("deployment")
+	options.DryRun = false
+	result, err := runner.Run(ctx, MonacoArgs{Credentials: dtCredentials, Event: keptnEvent, Options: options})
+	output := redactMonacoOutput(result.Output, dtCredentials, options)
+	if err != nil {
+		monacoErr := classifyMonacoExecutionError(ctx, "deployment", err)
+		monacoErr.Output = output
+		return output, monacoErr
+	}
 
-	return err
+	return output, nil
+}
+
+/**
+ * Only runs monaco in dry-run mode and returns its output as the plan of the deployment
+ */
+func planMonaco(runCtx context.Context, runner MonacoRunner, dtCredentials *common.DTCredentials, keptnEvent *common.BaseKeptnEvent, options common.MonacoCommandOptions, status *statusReporter) (string, *MonacoError) {
+	ctx, cancel := newMonacoContext(runCtx)
+	defer cancel()
+
+	status.SetPhase("dry run")
+	options.DryRun = true
+	result, err := runner.Run(ctx, MonacoArgs{Credentials: dtCredentials, Event: keptnEvent, Options: options})
+	output := redactMonacoOutput(result.Output, dtCredentials, options)
+	if err != nil {
+		monacoErr := classifyMonacoExecutionError(ctx, "dry run", err)
+		monacoErr.Output = output
+		return output, monacoErr
+	}
+	return output, nil
+}
+
+// redactMonacoOutput masks secrets in the output of any runner before it is attached to events
+func redactMonacoOutput(output string, dtCredentials *common.DTCredentials, options common.MonacoCommandOptions) string {
+	return common.RedactSecrets(output, options.SecretPatterns, dtCredentials.ApiToken, options.Account.Secret())
+}
+
+// newMonacoContext returns the context of a monaco run, it is cancelled after MONACO_TIMEOUT or when runCtx is
+func newMonacoContext(runCtx context.Context) (context.Context, context.CancelFunc) {
+	if env.MonacoTimeout > 0 {
+		return context.WithTimeout(runCtx, env.MonacoTimeout)
+	}
+	return context.WithCancel(runCtx)
+}
+
+// classifyLockError reports waiting for a deployment lock that ended with the run, e.g., at the deadline of its event,
+// like a monaco execution, any other failure as timeout
+func classifyLockError(runCtx context.Context, err error) *MonacoError {
+	if runCtx.Err() != nil {
+		return classifyMonacoExecutionError(runCtx, "deployment", err)
+	}
+	return &MonacoError{Kind: KindTimeout, Err: err}
+}
+
+func classifyMonacoExecutionError(ctx context.Context, phase string, err error) *MonacoError {
+	if ctx.Err() == context.DeadlineExceeded {
+		if deadline, ok := eventDeadlineExceeded(ctx); ok {
+			return newMonacoError(KindTimeout, "monaco %s didn't finish before the deadline %s of the event: %w", phase, deadline.Format(time.RFC3339), err)
+		}
+		return newMonacoError(KindTimeout, "monaco %s exceeded the timeout of %s: %w", phase, env.MonacoTimeout, err)
+	}
+	if ctx.Err() == context.Canceled {
+		return newMonacoError(KindAborted, "monaco %s was cancelled: %w", phase, err)
+	}
+	monacoErr := newMonacoError(KindExecution, "monaco %s failed: %w", phase, err)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		monacoErr.ExitCode = exitErr.ExitCode()
+	}
+	return monacoErr
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+/**
+ * brokerEventSender sends .finished events to the event broker configured via EVENT_BROKER_URL and all other
+ * events to the Keptn default
+ */
+type brokerEventSender struct {
+	broker   keptn.EventSender
+	fallback keptn.EventSender
+}
+
+func (s *brokerEventSender) SendEvent(event cloudevents.Event) error {
+	if strings.HasSuffix(event.Type(), ".finished") {
+		return s.broker.SendEvent(event)
+	}
+	return s.fallback.SendEvent(event)
+}
+
+/**
+ * Returns the event sender posting .finished events to brokerURL, other events are sent via fallback or the Keptn
+ * default if fallback is nil. Returns fallback if brokerURL is empty.
+ */
+func newEventSender(brokerURL string, fallback keptn.EventSender) (keptn.EventSender, error) {
+	if brokerURL == "" {
+		return fallback, nil
+	}
+
+	broker, err := keptnv2.NewHTTPEventSender(brokerURL)
+	if err != nil {
+		return nil, err
+	}
+	if fallback == nil {
+		fallback, err = keptnv2.NewHTTPEventSender(keptnv2.DefaultHTTPEventEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &brokerEventSender{broker: broker, fallback: fallback}, nil
+}
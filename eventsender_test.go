@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func TestFinishedEventsAreSentToEventBroker(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+
+	var mu sync.Mutex
+	receivedTypes := []string{}
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		event := struct {
+			Type string `json:"type"`
+		}{}
+		json.Unmarshal(body, &event)
+
+		mu.Lock()
+		receivedTypes = append(receivedTypes, event.Type)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer broker.Close()
+
+	defaultSender := &fake.EventSender{}
+	eventSender, err := newEventSender(broker.URL, defaultSender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { keptnOptions.EventSender = nil }()
+	keptnOptions.EventSender = eventSender
+
+	_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(receivedTypes) != 1 || receivedTypes[0] != keptnv2.GetFinishedEventType(MonacoEvent) {
+		t.Errorf("expected the broker to receive the finished event, got %v", receivedTypes)
+	}
+	if err := defaultSender.AssertSentEventTypes([]string{keptnv2.GetStartedEventType(MonacoEvent)}); err != nil {
+		t.Errorf("expected the other events to be sent to the Keptn default: %v", err)
+	}
+}
+
+func TestNewEventSenderWithoutBroker(t *testing.T) {
+	defaultSender := &fake.EventSender{}
+	eventSender, err := newEventSender("", defaultSender)
+	if err != nil || eventSender != defaultSender {
+		t.Errorf("expected the Keptn default without EVENT_BROKER_URL, got %v (%v)", eventSender, err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+/**
+ * Downloads the configs of the environments that were deployed to with monaco download and writes them to
+ * dynatrace/export/<environment>/ of the service in the config repo, so that the actual state of Dynatrace can be
+ * compared with the deployed configs. Returns the number of files written.
+ */
+func exportDeployedConfigs(runCtx context.Context, runner MonacoRunner, dtCredentials *common.DTCredentials, keptnEvent *common.BaseKeptnEvent, options common.MonacoCommandOptions) (int, error) {
+	if options.CLIVersion != common.MonacoCLIVersion2 {
+		return 0, fmt.Errorf("configs can only be exported with monaco %s", common.MonacoCLIVersion2)
+	}
+	if options.Account != nil {
+		return 0, fmt.Errorf("account resources can't be exported")
+	}
+
+	environments := strings.Split(options.Environment, ",")
+	if options.Environment == "" {
+		var err error
+		environments, err = common.GetManifestEnvironments(options.ManifestPath, options.Group)
+		if err != nil {
+			return 0, err
+		}
+		if len(environments) == 0 {
+			return 0, fmt.Errorf("the %s defines no environments to export", common.MonacoManifestFilename)
+		}
+	}
+
+	exportDir := filepath.Join(common.GetMonacoFolder(keptnEvent), common.MonacoExportSubfolder)
+	options.DryRun = false
+	options.ContinueOnError = false
+	options.Group = ""
+	for _, environment := range environments {
+		options.Environment = environment
+		options.ExportDir = filepath.Join(exportDir, environment)
+
+		ctx, cancel := newMonacoContext(runCtx)
+		result, err := runner.Run(ctx, MonacoArgs{Credentials: dtCredentials, Event: keptnEvent, Options: options})
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("monaco download of environment %s failed: %v\n%s", environment, err, redactMonacoOutput(result.Output, dtCredentials, options))
+		}
+	}
+
+	resources, err := common.CollectExportedResources(exportDir)
+	if err != nil {
+		return 0, err
+	}
+	if len(resources) == 0 {
+		log.Printf("Monaco exported no configs for %s/%s", keptnEvent.Project, keptnEvent.Stage)
+		return 0, nil
+	}
+	if err := resourceWriter.WriteResources(keptnEvent, resources); err != nil {
+		return 0, fmt.Errorf("could not write the exported configs to the config repo: %v", err)
+	}
+	return len(resources), nil
+}
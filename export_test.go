@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// fakeResourceWriter records the resources written to the config repo
+type fakeResourceWriter struct {
+	mu      sync.Mutex
+	written map[string]string
+}
+
+func (w *fakeResourceWriter) WriteResources(keptnEvent *common.BaseKeptnEvent, resources map[string]string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.written == nil {
+		w.written = map[string]string{}
+	}
+	for resourceURI, content := range resources {
+		w.written[resourceURI] = content
+	}
+	return nil
+}
+
+// replaces resourceWriter by writer, the returned function restores it
+func useResourceWriter(writer ResourceWriter) func() {
+	original := resourceWriter
+	resourceWriter = writer
+	return func() { resourceWriter = original }
+}
+
+func TestHandleMonacoTriggeredEventExportsDeployedConfigs(t *testing.T) {
+	defer setupTestWorkDir(t, "", map[string]string{"monaco-test/manifest.yaml": `manifestVersion: 1.0
+projects:
+  - name: sockshop
+environmentGroups:
+  - name: default
+    environments:
+      - name: dev-env
+        url:
+          value: https://abc12345.live.dynatrace.com
+`})()
+	defer func(version string, export bool) { env.MonacoVersion, env.ExportAfterDeploy = version, export }(env.MonacoVersion, env.ExportAfterDeploy)
+	env.MonacoVersion = common.MonacoCLIVersion2
+	env.ExportAfterDeploy = true
+
+	runner := &fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+		if args.Options.ExportDir == "" {
+			return MonacoRunResult{}, nil
+		}
+		// monaco download writes a project per environment
+		dashboards := filepath.Join(args.Options.ExportDir, "project", "dashboard")
+		os.MkdirAll(dashboards, 0700)
+		ioutil.WriteFile(filepath.Join(dashboards, "config.yaml"), []byte("configs: []\n"), 0600)
+		return MonacoRunResult{}, nil
+	}}
+	defer useMonacoRunner(runner)()
+	writer := &fakeResourceWriter{}
+	defer useResourceWriter(writer)()
+
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(runner.runs) != 3 {
+		t.Fatalf("expected the dry run, the deployment and the export, got %d runs", len(runner.runs))
+	}
+	export := runner.runs[2].Options
+	if export.Environment != "dev-env" || export.DryRun || export.ExportDir == "" {
+		t.Errorf("expected monaco to download the configs of dev-env, got %+v", export)
+	}
+
+	resourceURIs := []string{}
+	for resourceURI := range writer.written {
+		resourceURIs = append(resourceURIs, resourceURI)
+	}
+	sort.Strings(resourceURIs)
+	if expected := []string{"dynatrace/export/dev-env/project/dashboard/config.yaml"}; !reflect.DeepEqual(resourceURIs, expected) {
+		t.Errorf("expected the exported configs %v to be written back, got %v", expected, resourceURIs)
+	}
+
+	finished := getFinishedEventData(t, myKeptn)
+	if finished.Result != "pass" || finished.Monaco.Exported != 1 {
+		t.Errorf("expected a passed deployment with 1 exported file, got result %s and %d exported files", finished.Result, finished.Monaco.Exported)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"text/template"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// finishedMessageData is available in FINISHED_MESSAGE_TEMPLATE
+type finishedMessageData struct {
+	KeptnContext string
+	Project      string
+	Stage        string
+	Service      string
+	Status       string
+	Result       string
+	// the message the service would send without a template, e.g., Successfully ran monaco!
+	Message string
+	// how long monaco ran, e.g., 1.5s; empty if monaco did not run
+	Duration string
+}
+
+func parseFinishedMessageTemplate(messageTemplate string) (*template.Template, error) {
+	return template.New("finishedMessage").Option("missingkey=error").Parse(messageTemplate)
+}
+
+/**
+ * Returns the message of a .finished event rendered from messageTemplate.
+ * Returns the default message of data if messageTemplate is empty or cannot be rendered.
+ */
+func renderFinishedMessage(messageTemplate string, data finishedMessageData) string {
+	if messageTemplate == "" {
+		return data.Message
+	}
+	tmpl, err := parseFinishedMessageTemplate(messageTemplate)
+	if err != nil {
+		log.Printf("Invalid FINISHED_MESSAGE_TEMPLATE, using the default message: %v", err)
+		return data.Message
+	}
+
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, data); err != nil {
+		log.Printf("Could not render FINISHED_MESSAGE_TEMPLATE, using the default message: %v", err)
+		return data.Message
+	}
+	return message.String()
+}
+
+// applyFinishedMessageTemplate replaces the message of finishedData with FINISHED_MESSAGE_TEMPLATE rendered for the event handled by myKeptn
+func applyFinishedMessageTemplate(myKeptn *keptnv2.Keptn, finishedData *MonacoFinishedEventData, duration time.Duration) {
+	data := finishedMessageData{
+		KeptnContext: myKeptn.KeptnContext,
+		Status:       string(finishedData.Status),
+		Result:       string(finishedData.Result),
+		Message:      finishedData.Message,
+	}
+	if myKeptn.Event != nil {
+		data.Project = myKeptn.Event.GetProject()
+		data.Stage = myKeptn.Event.GetStage()
+		data.Service = myKeptn.Event.GetService()
+	}
+	if duration > 0 {
+		data.Duration = duration.Round(time.Millisecond).String()
+	}
+	finishedData.Message = renderFinishedMessage(env.FinishedMessageTemplate, data)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderFinishedMessage(t *testing.T) {
+	data := finishedMessageData{Project: "sockshop", Stage: "dev", Service: "carts", Result: "pass", Message: "Successfully ran monaco!", Duration: "1.5s"}
+
+	tests := []struct {
+		name            string
+		messageTemplate string
+		expectedMessage string
+	}{
+		{name: "custom template", messageTemplate: "{{.Project}}/{{.Stage}}: monaco {{.Result}} after {{.Duration}}", expectedMessage: "sockshop/dev: monaco pass after 1.5s"},
+		{name: "default message", messageTemplate: "[{{.Service}}] {{.Message}}", expectedMessage: "[carts] Successfully ran monaco!"},
+		{name: "unset", messageTemplate: "", expectedMessage: "Successfully ran monaco!"},
+		{name: "invalid template", messageTemplate: "{{.Project", expectedMessage: "Successfully ran monaco!"},
+		{name: "unknown field", messageTemplate: "{{.Tenant}}", expectedMessage: "Successfully ran monaco!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if message := renderFinishedMessage(tt.messageTemplate, data); message != tt.expectedMessage {
+				t.Errorf("expected %s, got %s", tt.expectedMessage, message)
+			}
+		})
+	}
+}
+
+func TestHandleMonacoTriggeredEventRendersFinishedMessage(t *testing.T) {
+	defer func(messageTemplate string) { env.FinishedMessageTemplate = messageTemplate }(env.FinishedMessageTemplate)
+	env.FinishedMessageTemplate = "{{.Project}}/{{.Stage}}/{{.Service}}: {{.Result}} ({{.Message}})"
+	defer setupTestWorkDir(t, "", nil)()
+	defer useMonacoRunner(&fakeRunner{})()
+
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	finishedData := getFinishedEventData(t, myKeptn)
+	expected := finishedData.Project + "/" + finishedData.Stage + "/" + finishedData.Service + ": pass (Successfully ran monaco!)"
+	if finishedData.Message != expected {
+		t.Errorf("expected %s, got %s", expected, finishedData.Message)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// sliProviderName is the sliProvider of the sh.keptn.event.get-sli.triggered events answered by the monaco-service
+const sliProviderName = "monaco"
+
+func handleGetSLIEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	eventData := &keptnv2.GetSLITriggeredEventData{}
+	if err := parseKeptnCloudEventPayload(event, eventData); err != nil {
+		return err
+	}
+
+	// other SLI providers answer the events that aren't meant for monaco
+	if eventData.GetSLI.SLIProvider != sliProviderName {
+		log.Printf("Ignoring %s, the SLI provider is '%s'", event.Context.GetID(), eventData.GetSLI.SLIProvider)
+		return nil
+	}
+
+	return HandleGetSLITriggeredEvent(myKeptn, event, eventData)
+}
+
+/**
+ * Handles sh.keptn.event.get-sli.triggered: queries the requested SLIs defined in dynatrace/sli.yaml from the
+ * Dynatrace environment of the project and sends them with sh.keptn.event.get-sli.finished
+ */
+func HandleGetSLITriggeredEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.GetSLITriggeredEventData) error {
+	_, err := myKeptn.SendTaskStartedEvent(&keptnv2.GetSLIStartedEventData{EventData: data.EventData}, eventSource)
+	if err != nil {
+		return err
+	}
+
+	var shkeptncontext string
+	incomingEvent.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
+	var team string
+	incomingEvent.Context.ExtensionAs(teamExtension, &team)
+
+	log.Printf("Processing sh.keptn.event.get-sli.triggered for %s.%s.%s", data.GetProject(), data.GetStage(), data.GetService())
+
+	keptnEvent := &common.BaseKeptnEvent{}
+	keptnEvent.Project = data.GetProject()
+	keptnEvent.Stage = data.GetStage()
+	keptnEvent.Service = data.GetService()
+	keptnEvent.Labels = data.GetLabels()
+	keptnEvent.Context = shkeptncontext
+	keptnEvent.Team = team
+
+	indicatorValues, err := getSLIValues(keptnEvent, data.GetSLI)
+	finishedData := &keptnv2.GetSLIFinishedEventData{
+		EventData: keptnv2.EventData{
+			Status: keptnv2.StatusSucceeded,
+			Result: keptnv2.ResultPass,
+		},
+		GetSLI: keptnv2.GetSLIFinished{
+			Start:           data.GetSLI.Start,
+			End:             data.GetSLI.End,
+			IndicatorValues: indicatorValues,
+		},
+	}
+	if err != nil {
+		log.Printf("Could not get the SLIs: %v", err)
+		finishedData.Status = keptnv2.StatusErrored
+		finishedData.Result = keptnv2.ResultFailed
+		finishedData.Message = fmt.Sprintf("Could not get the SLIs: %v", err)
+	} else {
+		for _, indicatorValue := range indicatorValues {
+			if !indicatorValue.Success {
+				finishedData.Result = keptnv2.ResultFailed
+				finishedData.Message = "Not all SLIs could be retrieved"
+			}
+		}
+	}
+
+	_, err = myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+	return err
+}
+
+/**
+ * Queries the requested indicators between the start and end of getSLI. Indicators that aren't defined or whose
+ * query fails are returned as unsuccessful, errors are only returned if no indicator can be queried at all.
+ */
+func getSLIValues(keptnEvent *common.BaseKeptnEvent, getSLI keptnv2.GetSLI) ([]*keptnv2.SLIResult, error) {
+	start, err := time.Parse(time.RFC3339, getSLI.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start %s: %v", getSLI.Start, err)
+	}
+	end, err := time.Parse(time.RFC3339, getSLI.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end %s: %v", getSLI.End, err)
+	}
+
+	sliConfig, err := common.GetSLIConfig(keptnEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	dtCreds := "dynatrace"
+	monacoConfigFile, err := common.GetMonacoConfig(keptnEvent)
+	if err != nil {
+		return nil, err
+	}
+	if monacoConfigFile != nil && monacoConfigFile.DtCreds != "" {
+		dtCreds = common.ReplaceKeptnPlaceholders(monacoConfigFile.DtCreds, keptnEvent)
+	}
+	dtCredentials, err := getDynatraceCredentials(dtCreds, keptnEvent.Project, keptnEvent.Team, keptnEvent.Labels[environmentLabel])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Dynatrace credentials: %w", err)
+	}
+
+	indicatorValues := []*keptnv2.SLIResult{}
+	for _, indicator := range getSLI.Indicators {
+		result := &keptnv2.SLIResult{Metric: indicator}
+		query, ok := sliConfig.Indicators[indicator]
+		if !ok {
+			result.Message = fmt.Sprintf("SLI %s is not defined in %s", indicator, common.SLIFilename)
+		} else if value, err := common.QueryDynatraceMetric(dtCredentials, query, start, end); err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Value = value
+			result.Success = true
+		}
+		indicatorValues = append(indicatorValues, result)
+	}
+	return indicatorValues, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+const testSLIConfig = `spec_version: '1.0'
+indicators:
+  response_time_p95: "metricSelector=builtin:service.response.time:percentile(95)&entitySelector=tag(keptn_service:$SERVICE)"
+  error_rate: builtin:service.errors.total.rate:avg
+`
+
+func TestHandleGetSLITriggeredEvent(t *testing.T) {
+	mock := startMockDynatrace(t)
+	defer mock.Close()
+	mock.addMetric("builtin:service.response.time:percentile(95)", 312.5)
+	mock.addMetric("builtin:service.errors.total.rate:avg", 0.2)
+
+	defer setupTestWorkDir(t, "", map[string]string{"dynatrace/sli.yaml": testSLIConfig})()
+	os.Setenv("DT_TENANT", mock.URL)
+
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/get-sli.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handleGetSLIEvent(myKeptn, *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	finishedData := getGetSLIFinishedEventData(t, myKeptn)
+	if finishedData.GetSLI.Start != "2021-03-04T10:20:00.000Z" || finishedData.GetSLI.End != "2021-03-04T10:30:00.000Z" {
+		t.Errorf("expected the timeframe of the triggered event, got %s - %s", finishedData.GetSLI.Start, finishedData.GetSLI.End)
+	}
+	// throughput is not defined in sli.yaml
+	if finishedData.Result != keptnv2.ResultFailed {
+		t.Errorf("expected the result to fail as not all SLIs could be retrieved, got %s", finishedData.Result)
+	}
+
+	expected := map[string]float64{"response_time_p95": 312.5, "error_rate": 0.2}
+	if len(finishedData.GetSLI.IndicatorValues) != 3 {
+		t.Fatalf("expected 3 indicator values, got %d", len(finishedData.GetSLI.IndicatorValues))
+	}
+	for _, indicatorValue := range finishedData.GetSLI.IndicatorValues {
+		value, ok := expected[indicatorValue.Metric]
+		if !ok {
+			if indicatorValue.Success {
+				t.Errorf("expected %s to fail as it is not defined", indicatorValue.Metric)
+			}
+			continue
+		}
+		if !indicatorValue.Success || indicatorValue.Value != value {
+			t.Errorf("expected %s to be %v, got %v (%s)", indicatorValue.Metric, value, indicatorValue.Value, indicatorValue.Message)
+		}
+	}
+}
+
+func TestHandleGetSLIEventIgnoresOtherProviders(t *testing.T) {
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/get-sli.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventData := &keptnv2.GetSLITriggeredEventData{}
+	incomingEvent.DataAs(eventData)
+	eventData.GetSLI.SLIProvider = "prometheus"
+	incomingEvent.SetData("application/json", eventData)
+
+	if err := handleGetSLIEvent(myKeptn, *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sent := len(myKeptn.EventSender.(*fake.EventSender).SentEvents); sent != 0 {
+		t.Errorf("expected no events for another SLI provider, got %d", sent)
+	}
+}
+
+func getGetSLIFinishedEventData(t *testing.T, myKeptn *keptnv2.Keptn) *keptnv2.GetSLIFinishedEventData {
+	for _, event := range myKeptn.EventSender.(*fake.EventSender).SentEvents {
+		if event.Type() == keptnv2.GetFinishedEventType(keptnv2.GetSLITaskName) {
+			finishedData := &keptnv2.GetSLIFinishedEventData{}
+			if err := event.DataAs(finishedData); err != nil {
+				t.Fatal(err)
+			}
+			return finishedData
+		}
+	}
+	t.Fatalf("no get-sli.finished event sent")
+	return nil
+}
@@ -3,12 +3,21 @@ module github.com/keptn-sandbox/monaco-service
 go 1.13
 
 require (
+	github.com/alicebob/miniredis/v2 v2.23.0
+	github.com/cloudevents/sdk-go/protocol/nats/v2 v2.3.1
 	github.com/cloudevents/sdk-go/v2 v2.3.1
 	github.com/go-openapi/jsonreference v0.19.3 // indirect
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/google/uuid v1.2.0
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/keptn/go-utils v0.8.0
-	github.com/onsi/ginkgo v1.12.0 // indirect
-	github.com/onsi/gomega v1.9.0 // indirect
+	github.com/nats-io/nats-server/v2 v2.1.9
+	github.com/nats-io/nats.go v1.10.0
+	github.com/prometheus/client_golang v1.9.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/apimachinery v0.17.2
 	k8s.io/client-go v0.17.2
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// ReadinessStatus is returned by the /ready endpoint
+type ReadinessStatus struct {
+	Status      string `json:"status"`
+	FailedCheck string `json:"failedCheck,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+/**
+ * Verifies that the monaco binary and the pinned versions installed at MONACO_VERSION_PATH are executable
+ */
+func checkMonacoExecutable() error {
+	if err := checkExecutable(common.MonacoExecutable); err != nil {
+		return err
+	}
+
+	pinned, err := filepath.Glob(strings.ReplaceAll(env.MonacoVersionPath, common.MonacoVersionPlaceholder, "*"))
+	if err != nil {
+		return fmt.Errorf("invalid MONACO_VERSION_PATH %s: %v", env.MonacoVersionPath, err)
+	}
+	for _, executable := range pinned {
+		if err := checkExecutable(executable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+/**
+ * Verifies that the Keptn configuration service responds to a HEAD request
+ */
+func checkConfigurationService() error {
+	configurationServiceURL := common.GetConfigurationServiceURL()
+	if !strings.HasPrefix(configurationServiceURL, "http://") && !strings.HasPrefix(configurationServiceURL, "https://") {
+		configurationServiceURL = "http://" + configurationServiceURL
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Head(configurationServiceURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s responded with status %d", configurationServiceURL, resp.StatusCode)
+	}
+	return nil
+}
+
+/**
+ * Verifies that the schema mirror is reachable: a mirror URL has to respond, a cache directory has to exist
+ */
+func checkSchemaMirror(mirror string) error {
+	if !strings.HasPrefix(mirror, "http://") && !strings.HasPrefix(mirror, "https://") {
+		info, err := os.Stat(mirror)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", mirror)
+		}
+		return nil
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Head(mirror)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s responded with status %d", mirror, resp.StatusCode)
+	}
+	return nil
+}
+
+/**
+ * Serves /ready: returns 200 if the service can run monaco, otherwise 503 naming the failed check
+ */
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	status := ReadinessStatus{Status: "ready"}
+
+	if err := checkMonacoExecutable(); err != nil {
+		status = ReadinessStatus{Status: "not ready", FailedCheck: "monaco", Error: err.Error()}
+	} else if !common.RunLocal {
+		if err := checkConfigurationService(); err != nil {
+			status = ReadinessStatus{Status: "not ready", FailedCheck: "configuration-service", Error: err.Error()}
+		}
+	}
+	if status.FailedCheck == "" && env.MonacoSchemaMirror != "" {
+		if err := checkSchemaMirror(env.MonacoSchemaMirror); err != nil {
+			status = ReadinessStatus{Status: "not ready", FailedCheck: "schema-mirror", Error: err.Error()}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.FailedCheck != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func getReadiness(t *testing.T) (int, ReadinessStatus) {
+	recorder := httptest.NewRecorder()
+	handleReady(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	status := ReadinessStatus{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("could not parse readiness response: %v", err)
+	}
+	return recorder.Code, status
+}
+
+func TestReadyEndpointHealthy(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+
+	code, status := getReadiness(t)
+	if code != http.StatusOK || status.Status != "ready" {
+		t.Errorf("expected 200/ready, got %d/%v", code, status)
+	}
+}
+
+func TestReadyEndpointMissingMonacoBinary(t *testing.T) {
+	workDir, _ := ioutil.TempDir("", "monaco-service-test")
+	defer os.RemoveAll(workDir)
+	originalDir, _ := os.Getwd()
+	os.Chdir(workDir)
+	defer os.Chdir(originalDir)
+
+	code, status := getReadiness(t)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+	if status.FailedCheck != "monaco" {
+		t.Errorf("expected the monaco check to fail, got %v", status)
+	}
+}
+
+func TestReadyEndpointPinnedMonacoVersionNotExecutable(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+	defer func(path string) { env.MonacoVersionPath = path }(env.MonacoVersionPath)
+	env.MonacoVersionPath = "./monaco-$VERSION"
+	ioutil.WriteFile("monaco-v1.5.0", []byte("#!/bin/sh\nexit 0\n"), 0755)
+	ioutil.WriteFile("monaco-v1.6.0", []byte("#!/bin/sh\nexit 0\n"), 0644)
+
+	code, status := getReadiness(t)
+	if code != http.StatusServiceUnavailable || status.FailedCheck != "monaco" {
+		t.Errorf("expected 503 with the monaco check failed, got %d/%v", code, status)
+	}
+	if !strings.Contains(status.Error, "monaco-v1.6.0") {
+		t.Errorf("expected the error to name the pinned executable, got %s", status.Error)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const historyBackendNone = "none"
+const historyBackendFile = "file"
+
+// deploymentRecord is one entry of the deployment history, written for every monaco .finished event
+type deploymentRecord struct {
+	KeptnContext  string    `json:"keptnContext"`
+	Project       string    `json:"project"`
+	Stage         string    `json:"stage"`
+	Service       string    `json:"service"`
+	Status        string    `json:"status"`
+	Result        string    `json:"result"`
+	Timestamp     time.Time `json:"timestamp"`
+	AppliedCommit string    `json:"appliedCommit,omitempty"`
+}
+
+// historyBackend persists the deployment history, HISTORY_BACKEND selects the implementation
+type historyBackend interface {
+	Append(record deploymentRecord) error
+}
+
+/**
+ * Returns the history backend configured by HISTORY_BACKEND and HISTORY_FILE, nil for none
+ */
+func newHistoryBackend(backend string, file string) (historyBackend, error) {
+	switch backend {
+	case historyBackendNone, "":
+		return nil, nil
+	case historyBackendFile:
+		if file == "" {
+			return nil, fmt.Errorf("HISTORY_BACKEND=%s requires HISTORY_FILE", historyBackendFile)
+		}
+		return &fileHistoryBackend{path: file}, nil
+	default:
+		return nil, fmt.Errorf("unsupported history backend '%s', must be one of %s, %s", backend, historyBackendNone, historyBackendFile)
+	}
+}
+
+// fileHistoryBackend appends one JSON record per line to a file
+type fileHistoryBackend struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (b *fileHistoryBackend) Append(record deploymentRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	file, err := os.OpenFile(b.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/**
+ * historyEventSender records every monaco .finished event it sends in the deployment history. Recording never
+ * fails the event, errors are only logged.
+ */
+type historyEventSender struct {
+	sender  keptn.EventSender
+	history historyBackend
+}
+
+func (s *historyEventSender) SendEvent(event cloudevents.Event) error {
+	err := s.sender.SendEvent(event)
+	if event.Type() == keptnv2.GetFinishedEventType(MonacoEvent) {
+		if recordErr := s.history.Append(newDeploymentRecord(event)); recordErr != nil {
+			log.Printf("Could not record the deployment of %s in the history: %v", event.Context.GetID(), recordErr)
+		}
+	}
+	return err
+}
+
+/**
+ * Returns sender recording the deployments in history, sender is the Keptn default if nil. Returns sender if
+ * there is no history.
+ */
+func newHistoryEventSender(sender keptn.EventSender, history historyBackend) (keptn.EventSender, error) {
+	if history == nil {
+		return sender, nil
+	}
+	if sender == nil {
+		var err error
+		sender, err = keptnv2.NewHTTPEventSender(keptnv2.DefaultHTTPEventEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &historyEventSender{sender: sender, history: history}, nil
+}
+
+// newDeploymentRecord describes the run the .finished event reports
+func newDeploymentRecord(event cloudevents.Event) deploymentRecord {
+	record := deploymentRecord{Timestamp: event.Time()}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	event.Context.ExtensionAs("shkeptncontext", &record.KeptnContext)
+
+	finishedData := &keptnv2.EventData{}
+	if err := event.DataAs(finishedData); err == nil {
+		record.Project = finishedData.Project
+		record.Stage = finishedData.Stage
+		record.Service = finishedData.Service
+		record.Status = string(finishedData.Status)
+		record.Result = string(finishedData.Result)
+		record.AppliedCommit = finishedData.Labels[appliedCommitLabel]
+	}
+	return record
+}
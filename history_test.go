@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func TestDeploymentHistoryIsAppendedToFile(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+
+	historyDir, err := ioutil.TempDir("", "monaco-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(historyDir)
+	historyFile := filepath.Join(historyDir, "history.jsonl")
+	history, err := newHistoryBackend(historyBackendFile, historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventSender, err := newHistoryEventSender(&fake.EventSender{}, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { keptnOptions.EventSender = nil }()
+	keptnOptions.EventSender = eventSender
+
+	for _, eventID := range []string{"history-event-1", "history-event-2"} {
+		_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		incomingEvent.SetID(eventID)
+		if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	file, err := os.Open(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records := []deploymentRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := deploymentRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid history record %s: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected a record per finished event, got %+v", records)
+	}
+	for _, record := range records {
+		if record.KeptnContext != "08735340-6f9e-4b32-97ff-3b6c292bc50h" || record.Project != "sockshop" || record.Stage != "dev" || record.Result != "pass" || record.AppliedCommit != "local" || record.Timestamp.IsZero() {
+			t.Errorf("unexpected history record %+v", record)
+		}
+	}
+}
+
+func TestNewHistoryBackend(t *testing.T) {
+	if history, err := newHistoryBackend(historyBackendNone, ""); history != nil || err != nil {
+		t.Errorf("expected no history for %s, got %v (%v)", historyBackendNone, history, err)
+	}
+	if _, err := newHistoryBackend(historyBackendFile, ""); err == nil {
+		t.Error("expected an error for the file backend without HISTORY_FILE")
+	}
+	if _, err := newHistoryBackend("postgres", ""); err == nil {
+		t.Error("expected an error for an unsupported backend")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// types of the CloudEvents announcing that an instance of the service started or stopped, see EMIT_LIFECYCLE_EVENTS
+const serviceStartedEventType = "sh.keptn.event." + ServiceName + ".started"
+const serviceStoppedEventType = "sh.keptn.event." + ServiceName + ".stopped"
+
+// LifecycleEventData is the payload of the started and stopped events
+type LifecycleEventData struct {
+	// host name of the instance, the pod name when running in Kubernetes
+	Instance string `json:"instance"`
+	BuildInfo
+}
+
+// newLifecycleEventSender returns the sender of the lifecycle events, an empty endpoint uses the Keptn default
+func newLifecycleEventSender(endpoint string) (keptn.EventSender, error) {
+	return keptnv2.NewHTTPEventSender(endpoint)
+}
+
+// sendLifecycleEvent announces the start or stop of this instance with an event of eventType
+func sendLifecycleEvent(sender keptn.EventSender, eventType string) error {
+	instance, _ := os.Hostname()
+
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.New().String())
+	event.SetType(eventType)
+	event.SetSource(eventSource)
+	event.SetTime(time.Now())
+	if err := event.SetData(cloudevents.ApplicationJSON, LifecycleEventData{Instance: instance, BuildInfo: getBuildInfo()}); err != nil {
+		return err
+	}
+	return sender.SendEvent(event)
+}
+
+// withShutdownSignal returns a context that is cancelled when the service is asked to stop via SIGTERM or SIGINT
+func withShutdownSignal(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendLifecycleEventPostsStartedEvent(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		event := map[string]interface{}{}
+		json.Unmarshal(body, &event)
+		received <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer endpoint.Close()
+
+	sender, err := newLifecycleEventSender(endpoint.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendLifecycleEvent(sender, serviceStartedEventType); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	event := <-received
+	if event["type"] != "sh.keptn.event.monaco-service.started" {
+		t.Errorf("expected a sh.keptn.event.monaco-service.started event, got %v", event["type"])
+	}
+	if event["source"] != eventSource {
+		t.Errorf("expected source %s, got %v", eventSource, event["source"])
+	}
+	if event["id"] == nil || event["id"] == "" {
+		t.Error("expected the event to have an id")
+	}
+	data, _ := event["data"].(map[string]interface{})
+	if data == nil || data["instance"] == nil {
+		t.Errorf("expected the data to name the instance, got %v", event["data"])
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// deploymentLocker locks a key for one deployment at a time
+type deploymentLocker interface {
+	// Lock waits at most timeout for the key to become free (0 waits forever) and returns the function releasing it.
+	// It stops waiting once ctx is done, e.g., when the run is aborted or the deadline of its event passes. The
+	// returned context derives from ctx and is cancelled if the lock is lost while it is held.
+	Lock(ctx context.Context, key string, timeout time.Duration) (context.Context, func(), error)
+}
+
+// deploymentLocks ensures that only one monaco deployment per project, stage and Dynatrace environment runs at a time,
+// across replicas if DEPLOYMENT_LOCK_REDIS_URL is set
+var deploymentLocks deploymentLocker = newKeyedMutex()
+
+type keyLock struct {
+	ch      chan struct{}
+	holders int
+}
+
+// keyedMutex is an in-memory mutex per key, callers of the same key queue up until the key is free
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*keyLock{}}
+}
+
+func getDeploymentLockKey(project string, stage string, environment string) string {
+	return fmt.Sprintf("%s/%s/%s", project, stage, environment)
+}
+
+// Lock waits at most timeout for the key to become free (0 waits forever) and returns the function releasing it
+func (m *keyedMutex) Lock(ctx context.Context, key string, timeout time.Duration) (context.Context, func(), error) {
+	m.mu.Lock()
+	lock, ok := m.locks[key]
+	if !ok {
+		lock = &keyLock{ch: make(chan struct{}, 1)}
+		m.locks[key] = lock
+	}
+	lock.holders++
+	m.mu.Unlock()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case lock.ch <- struct{}{}:
+		return ctx, func() {
+			<-lock.ch
+			m.release(key, lock)
+		}, nil
+	case <-timeoutCh:
+		m.release(key, lock)
+		return nil, nil, fmt.Errorf("timed out after %s waiting for another deployment of %s to finish", timeout, key)
+	case <-ctx.Done():
+		m.release(key, lock)
+		return nil, nil, fmt.Errorf("stopped waiting for another deployment of %s to finish: %w", key, ctx.Err())
+	}
+}
+
+// release drops the key once nobody holds or waits for it anymore
+func (m *keyedMutex) release(key string, lock *keyLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock.holders--
+	if lock.holders == 0 {
+		delete(m.locks, key)
+	}
+}
+
+// environmentSlots limits how many deployments run in parallel against one Dynatrace environment
+var environmentSlots = newKeyedSemaphore()
+
+// keyedSemaphore allows up to limit callers per key at a time, others queue up until a slot is free
+type keyedSemaphore struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newKeyedSemaphore() *keyedSemaphore {
+	return &keyedSemaphore{slots: map[string]chan struct{}{}}
+}
+
+/**
+ * Acquire waits at most timeout (0 waits forever) or until ctx is done for one of the limit slots of the key and
+ * returns the function releasing it. If the limit of a key changes, callers still holding a slot of the previous
+ * limit are not counted.
+ */
+func (s *keyedSemaphore) Acquire(ctx context.Context, key string, limit int, timeout time.Duration) (func(), error) {
+	s.mu.Lock()
+	slots, ok := s.slots[key]
+	if !ok || cap(slots) != limit {
+		slots = make(chan struct{}, limit)
+		s.slots[key] = slots
+	}
+	s.mu.Unlock()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-timeoutCh:
+		return nil, fmt.Errorf("timed out after %s waiting for one of the %d deployment slots of %s", timeout, limit, key)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("stopped waiting for one of the %d deployment slots of %s: %w", limit, key, ctx.Err())
+	}
+}
+
+/**
+ * Returns how many deployments may run in parallel against an environment of the passed tier:
+ * its limit in ENVIRONMENT_TIER_CONCURRENCY, or ENVIRONMENT_CONCURRENCY if the tier is unknown. 0 means unlimited.
+ */
+func getEnvironmentConcurrency(tier string, tierConcurrency map[string]int, defaultConcurrency int) int {
+	if concurrency, ok := tierConcurrency[tier]; ok && tier != "" {
+		return concurrency
+	}
+	return defaultConcurrency
+}
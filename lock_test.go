@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexLockTimeout(t *testing.T) {
+	locks := newKeyedMutex()
+
+	_, unlock, err := locks.Lock(context.Background(), "sockshop/dev/env", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, err := locks.Lock(context.Background(), "sockshop/dev/env", 50*time.Millisecond); err == nil {
+		t.Errorf("expected the second lock of the same key to time out")
+	}
+
+	_, unlockOther, err := locks.Lock(context.Background(), "sockshop/prod/env", 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("expected a different key not to be blocked: %v", err)
+	} else {
+		unlockOther()
+	}
+
+	unlock()
+	_, unlock, err = locks.Lock(context.Background(), "sockshop/dev/env", 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("expected the key to be free again: %v", err)
+	} else {
+		unlock()
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("expected all keys to be released, got %d", len(locks.locks))
+	}
+}
+
+func TestKeyedSemaphoreLimit(t *testing.T) {
+	slots := newKeyedSemaphore()
+
+	release1, err := slots.Acquire(context.Background(), "https://abc12345.live.dynatrace.com", 2, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release2, err := slots.Acquire(context.Background(), "https://abc12345.live.dynatrace.com", 2, time.Second)
+	if err != nil {
+		t.Fatalf("expected a second slot: %v", err)
+	}
+	if _, err := slots.Acquire(context.Background(), "https://abc12345.live.dynatrace.com", 2, 50*time.Millisecond); err == nil {
+		t.Errorf("expected the third deployment to time out")
+	}
+
+	release1()
+	release3, err := slots.Acquire(context.Background(), "https://abc12345.live.dynatrace.com", 2, 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("expected a slot to be free again: %v", err)
+	} else {
+		release3()
+	}
+	release2()
+}
+
+func TestGetEnvironmentConcurrency(t *testing.T) {
+	tierConcurrency := map[string]int{"small": 1, "large": 4}
+
+	if concurrency := getEnvironmentConcurrency("large", tierConcurrency, 2); concurrency != 4 {
+		t.Errorf("expected the limit of the tier, got %d", concurrency)
+	}
+	if concurrency := getEnvironmentConcurrency("medium", tierConcurrency, 2); concurrency != 2 {
+		t.Errorf("expected the default limit for an unknown tier, got %d", concurrency)
+	}
+	if concurrency := getEnvironmentConcurrency("", tierConcurrency, 0); concurrency != 0 {
+		t.Errorf("expected no limit without a tier, got %d", concurrency)
+	}
+}
+
+func TestHandleMonacoTriggeredEventLimitsConcurrencyPerEnvironmentTier(t *testing.T) {
+	defer setupTestWorkDir(t, "echo start >> runs.log; sleep 0.2; echo end >> runs.log", nil)()
+	os.Setenv("DT_TIER", "small")
+	defer os.Unsetenv("DT_TIER")
+	defer func(tierConcurrency map[string]int) { env.EnvironmentTierConcurrency = tierConcurrency }(env.EnvironmentTierConcurrency)
+	env.EnvironmentTierConcurrency = map[string]int{"small": 1, "large": 4}
+
+	// different stages don't share the deployment lock, only the environment
+	var wg sync.WaitGroup
+	for _, stage := range []string{"dev", "staging"} {
+		wg.Add(1)
+		go func(stage string) {
+			defer wg.Done()
+			myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			eventData := &MonacoStartedEventData{}
+			incomingEvent.DataAs(eventData)
+			eventData.Stage = stage
+			if err := HandleMonacoTriggeredEvent(myKeptn, *incomingEvent, eventData); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(stage)
+	}
+	wg.Wait()
+
+	runs, _ := ioutil.ReadFile("runs.log")
+	lines := strings.Fields(string(runs))
+	if len(lines) != 8 {
+		t.Fatalf("expected two dry runs and two deployments, got %v", lines)
+	}
+	for i, line := range lines {
+		if (i%2 == 0 && line != "start") || (i%2 == 1 && line != "end") {
+			t.Fatalf("expected at most one deployment to the small environment at a time, got %v", lines)
+		}
+	}
+}
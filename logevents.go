@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// Keptn log events surfacing errors and warnings of an integration in the Keptn logs view
+const keptnErrorLogEventType = "sh.keptn.log.error"
+const keptnWarningLogEventType = "sh.keptn.log.warning"
+
+// LogEventData is the payload of the sh.keptn.log.error and sh.keptn.log.warning events
+type LogEventData struct {
+	Message       string `json:"message"`
+	IntegrationID string `json:"integrationid"`
+	Task          string `json:"task,omitempty"`
+	KeptnContext  string `json:"keptncontext,omitempty"`
+	TriggeredID   string `json:"triggeredid,omitempty"`
+	Project       string `json:"project,omitempty"`
+	Stage         string `json:"stage,omitempty"`
+	Service       string `json:"service,omitempty"`
+}
+
+// sendErrorLogEvent reports an error of the run handled by myKeptn, see sendLogEvent
+func sendErrorLogEvent(myKeptn *keptnv2.Keptn, message string) {
+	sendLogEvent(myKeptn, keptnErrorLogEventType, message)
+}
+
+// sendWarningLogEvent reports a warning of the run handled by myKeptn, see sendLogEvent
+func sendWarningLogEvent(myKeptn *keptnv2.Keptn, message string) {
+	sendLogEvent(myKeptn, keptnWarningLogEventType, message)
+}
+
+/**
+ * Sends a log event of eventType for the .triggered event handled by myKeptn if EMIT_KEPTN_LOG_EVENTS is enabled.
+ * Failing to send it is only logged, the .finished event is what the sequence depends on.
+ */
+func sendLogEvent(myKeptn *keptnv2.Keptn, eventType string, message string) {
+	if !env.EmitKeptnLogEvents || myKeptn.CloudEvent == nil {
+		return
+	}
+
+	var shkeptncontext string
+	myKeptn.CloudEvent.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
+
+	logEvent := cloudevents.NewEvent()
+	logEvent.SetID(uuid.New().String())
+	logEvent.SetType(eventType)
+	logEvent.SetSource(eventSource)
+	logEvent.SetTime(time.Now())
+	logEvent.SetExtension("shkeptncontext", shkeptncontext)
+	logEvent.SetExtension("triggeredid", myKeptn.CloudEvent.ID())
+	err := logEvent.SetData(cloudevents.ApplicationJSON, LogEventData{
+		Message:      message,
+		Task:         MonacoEvent,
+		KeptnContext: shkeptncontext,
+		TriggeredID:  myKeptn.CloudEvent.ID(),
+		Project:      myKeptn.Event.GetProject(),
+		Stage:        myKeptn.Event.GetStage(),
+		Service:      myKeptn.Event.GetService(),
+	})
+	if err == nil {
+		err = myKeptn.EventSender.SendEvent(logEvent)
+	}
+	if err != nil {
+		log.Printf("Could not send %s event: %v", eventType, err)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+)
+
+// Logger receives the messages the event handlers log about an event
+type Logger interface {
+	Info(message string)
+	Error(message string)
+}
+
+// newEventLogger returns the logger for the messages about event, the Keptn logger unless tests replace it
+var newEventLogger = func(event cloudevents.Event) Logger {
+	var shkeptncontext string
+	event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
+	return keptn.NewLogger(shkeptncontext, event.Context.GetID(), ServiceName)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// recordingLogger keeps the messages logged by the event handlers
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Info(message string) {
+	l.record("INFO", message)
+}
+
+func (l *recordingLogger) Error(message string) {
+	l.record("ERROR", message)
+}
+
+func (l *recordingLogger) record(level string, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf("%s %s", level, message))
+}
+
+// Contains returns whether a message of level containing text was logged
+func (l *recordingLogger) Contains(level string, text string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, message := range l.messages {
+		if strings.HasPrefix(message, level+" ") && strings.Contains(message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaces the logger of all events by logger, the returned function restores the Keptn logger
+func useLogger(logger Logger) func() {
+	original := newEventLogger
+	newEventLogger = func(event cloudevents.Event) Logger { return logger }
+	return func() { newEventLogger = original }
+}
+
+func TestProcessKeptnCloudEventLogsUnhandledEvents(t *testing.T) {
+	logger := &recordingLogger{}
+	defer useLogger(logger)()
+
+	_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomingEvent.SetType("sh.keptn.event.unknown.triggered")
+
+	if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !logger.Contains("ERROR", "Unhandled Keptn Cloud Event: sh.keptn.event.unknown.triggered") {
+		t.Errorf("expected the unhandled event to be logged as error, got %v", logger.messages)
+	}
+}
+
+func TestProcessKeptnCloudEventLogsIgnoredDeployments(t *testing.T) {
+	logger := &recordingLogger{}
+	defer useLogger(logger)()
+
+	_, incomingEvent, err := initializeTestObjects("test-events/deployment.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomingEvent.SetData(cloudevents.ApplicationJSON, map[string]interface{}{
+		"project":    "sockshop",
+		"stage":      "dev",
+		"service":    "carts",
+		"deployment": map[string]string{"deploymentstrategy": "blue_green_service"},
+	})
+
+	if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !logger.Contains("INFO", fmt.Sprintf("Ignoring %s, it is not a monaco deployment", incomingEvent.ID())) {
+		t.Errorf("expected the ignored deployment to be logged, got %v", logger.messages)
+	}
+}
+
+func TestHandleMonacoTriggeredEventLogsThroughEventLogger(t *testing.T) {
+	defer setupTestWorkDir(t, "echo 'invalid config'; exit 1", nil)()
+	logger := &recordingLogger{}
+	defer useLogger(logger)()
+
+	if _, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json"); err == nil {
+		t.Fatal("expected the monaco run to fail")
+	}
+	if !logger.Contains("INFO", "Processing sh.keptn.event.monaco.triggered for sockshop.") {
+		t.Errorf("expected the run to be logged, got %v", logger.messages)
+	}
+	if !logger.Contains("ERROR", "Monaco run failed") {
+		t.Errorf("expected the failed run to be logged as error, got %v", logger.messages)
+	}
+}
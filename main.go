@@ -2,36 +2,325 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
+	"mime"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
 	"github.com/kelseyhightower/envconfig"
 	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
 )
 
 var keptnOptions = keptn.KeptnOpts{}
+var env envConfig
 
 type envConfig struct {
-	// Port on which to listen for cloudevents
+	// Port on which to listen for cloudevents (and /ready and /metrics)
 	Port int `envconfig:"RCV_PORT" default:"8080"`
 	// Path to which cloudevents are sent
 	Path string `envconfig:"RCV_PATH" default:"/"`
+	// Paths to which cloudevents are sent (comma separated), replaces RCV_PATH if set
+	Paths []string `envconfig:"RCV_PATHS" default:""`
+	// Source of the sent CloudEvents, e.g., to tell several instances apart
+	CESource string `envconfig:"CE_SOURCE" default:"monaco-service"`
+	// Token authenticating requests to /replay, empty disables the endpoint
+	ReplayToken string `envconfig:"REPLAY_TOKEN" default:""`
+	// How cloudevents are received: http (from the distributor) or nats
+	Transport string `envconfig:"TRANSPORT" default:"http"`
+	// NATS server and subject to subscribe to when TRANSPORT is nats
+	NATSURL     string `envconfig:"NATS_URL" default:"nats://keptn-nats-cluster:4222"`
+	NATSSubject string `envconfig:"NATS_SUBJECT" default:"sh.keptn.>"`
 	// Whether we are running locally (e.g., for testing) or on production
 	Env string `envconfig:"ENV" default:"local"`
-	// URL of the Keptn configuration service (this is where we can fetch files from the config repo)
+	// URL of the Keptn configuration service (this is where we can fetch files from the config repo), may reference env vars, e.g., http://$HOSTNAME:8080
 	ConfigurationServiceUrl string `envconfig:"CONFIGURATION_SERVICE" default:""`
+	// Where the monaco files are fetched from: keptn (configuration service) or http (RESOURCE_HTTP_URL)
+	ResourceSource string `envconfig:"RESOURCE_SOURCE" default:"keptn"`
+	// Base URL of the http resource source, may contain Keptn placeholders such as $PROJECT or $STAGE
+	ResourceHTTPURL string `envconfig:"RESOURCE_HTTP_URL" default:""`
+	// Directory the monaco files are mounted to (e.g., from a ConfigMap), if it exists they are deployed instead of fetched
+	ConfigMountPath string `envconfig:"CONFIG_MOUNT_PATH" default:""`
+	// Directories with shared monaco files (e.g., monaco-common) overlaid with the monaco files of the project before deploying
+	BaseConfigDirs []string `envconfig:"BASE_CONFIG_DIRS" default:""`
+	// How often reads from the configuration service are retried after network errors and 5xx responses, 0 disables retries
+	FetchMaxRetries int `envconfig:"FETCH_MAX_RETRIES" default:"3"`
+	// How long the fetched monaco files of a project, stage, service and config ref are reused, 0 disables the cache
+	ResourceCacheTTL time.Duration `envconfig:"RESOURCE_CACHE_TTL" default:"0s"`
+	// Maximum number of resource sets in the cache, the one expiring first is dropped for a new one
+	ResourceCacheSize int `envconfig:"RESOURCE_CACHE_SIZE" default:"100"`
+	// Event broker the .finished events are sent to instead of the Keptn default, empty uses the Keptn default
+	EventBrokerURL string `envconfig:"EVENT_BROKER_URL" default:""`
+	// Send sh.keptn.event.monaco-service.started on startup and .stopped on graceful shutdown
+	EmitLifecycleEvents bool `envconfig:"EMIT_LIFECYCLE_EVENTS" default:"false"`
+	// Endpoint the lifecycle events are sent to, empty uses the Keptn default
+	LifecycleEventsURL string `envconfig:"LIFECYCLE_EVENTS_URL" default:""`
+	// How the Dynatrace API token is handed over to monaco: env (DT_API_TOKEN) or file (DT_API_TOKEN_FILE)
+	TokenDelivery string `envconfig:"TOKEN_DELIVERY" default:"env"`
+	// Monaco CLI to use: v1 (environments.yaml + projects folder) or v2 (monaco deploy manifest.yaml)
+	MonacoVersion string `envconfig:"MONACO_CLI_VERSION" default:"v1"`
+	// URL monaco is downloaded from on startup if the image ships without it, $VERSION is replaced by MONACO_VERSION
+	MonacoDownloadURL string `envconfig:"MONACO_DOWNLOAD_URL" default:""`
+	// Release of monaco that is downloaded, e.g., v1.5.0
+	MonacoReleaseVersion string `envconfig:"MONACO_VERSION" default:""`
+	// Hex encoded SHA-256 checksum the downloaded monaco has to match
+	MonacoDownloadSHA256 string `envconfig:"MONACO_DOWNLOAD_SHA256" default:""`
+	// URL of a mirror or directory of a pre-downloaded cache monaco gets API schemas from, e.g., when air-gapped
+	MonacoSchemaMirror string `envconfig:"MONACO_SCHEMA_MIRROR" default:""`
+	// How to deal with configs referencing monaco projects that are not deployed: include (like monaco itself) or fail
+	CrossProjectDeps string `envconfig:"CROSS_PROJECT_DEPS" default:"include"`
+	// Maximum number of monaco runs deploying independent projects of an event in parallel, 1 deploys all projects in one run
+	MaxParallelDeployments int `envconfig:"MAX_PARALLEL_DEPLOYMENTS" default:"1"`
+	// Maximum time a single monaco execution may take, 0 disables the timeout
+	MonacoTimeout time.Duration `envconfig:"MONACO_TIMEOUT" default:"30m"`
+	// Maximum time a deployment waits for another deployment to the same project, stage and environment, 0 waits forever
+	DeploymentLockTimeout time.Duration `envconfig:"DEPLOYMENT_LOCK_TIMEOUT" default:"10m"`
+	// Redis server sharing the deployment locks between replicas (e.g., redis://redis:6379/0), empty locks in memory
+	DeploymentLockRedisURL string `envconfig:"DEPLOYMENT_LOCK_REDIS_URL" default:""`
+	// Time after which the redis lock of a replica that stopped refreshing it expires
+	DeploymentLockTTL time.Duration `envconfig:"DEPLOYMENT_LOCK_TTL" default:"1m"`
+	// Maximum parallel deployments per Dynatrace environment by the DT_TIER of its secret (e.g., small:1,large:4)
+	EnvironmentTierConcurrency map[string]int `envconfig:"ENVIRONMENT_TIER_CONCURRENCY" default:""`
+	// Maximum parallel deployments to Dynatrace environments without a tier listed above, 0 is unlimited
+	EnvironmentConcurrency int `envconfig:"ENVIRONMENT_CONCURRENCY" default:"0"`
+	// Whether to delay deployments based on the rate limit headers of the Dynatrace API
+	DeployThrottle bool `envconfig:"DEPLOY_THROTTLE" default:"false"`
+	// Upper bound of the delay added by the deploy throttle
+	DeployThrottleMaxDelay time.Duration `envconfig:"DEPLOY_THROTTLE_MAX_DELAY" default:"1m"`
+	// Whether runs that were interrupted by a restart get an errored .finished event on startup
+	RecoverInProgressRuns bool `envconfig:"RECOVER_IN_PROGRESS_RUNS" default:"true"`
+	// Whether the temp folders of runs are additionally namespaced by Dynatrace environment, they always are by project
+	WorkDirPerTenant bool `envconfig:"WORK_DIR_PER_TENANT" default:"false"`
+	// Temp folders of runs older than this are removed on startup, 0 keeps them
+	TempMaxAge time.Duration `envconfig:"TEMP_MAX_AGE" default:"24h"`
+	// Projects and Dynatrace environments recorded as metric labels, all others are recorded as "other" (empty allows all)
+	MetricsProjects     []string `envconfig:"METRICS_PROJECTS" default:""`
+	MetricsEnvironments []string `envconfig:"METRICS_ENVIRONMENTS" default:""`
+	// Maximum time a metrics, tracing or webhook backend may take to receive the telemetry of a run
+	TelemetryTimeout time.Duration `envconfig:"TELEMETRY_TIMEOUT" default:"5s"`
+	// Consecutive failures after which a telemetry backend is skipped for the cooldown, 0 never skips it
+	TelemetryBreakerThreshold int           `envconfig:"TELEMETRY_BREAKER_THRESHOLD" default:"5"`
+	TelemetryBreakerCooldown  time.Duration `envconfig:"TELEMETRY_BREAKER_COOLDOWN" default:"1m"`
+	// Consecutive failed deployments after which a Dynatrace environment isn't deployed to for ENVIRONMENT_BREAKER_COOLDOWN, 0 disables it
+	EnvironmentBreakerThreshold int           `envconfig:"ENVIRONMENT_BREAKER_THRESHOLD" default:"0"`
+	EnvironmentBreakerCooldown  time.Duration `envconfig:"ENVIRONMENT_BREAKER_COOLDOWN" default:"5m"`
+	// Remediation actions handled by deploying monaco projects, e.g., disable-alerting:alerting-off;maintenance-window
+	RemediationActions map[string]string `envconfig:"REMEDIATION_ACTIONS" default:""`
+	// Additional event types (comma separated, e.g., deployment.triggered) that also run monaco
+	HandledEventTypes []string `envconfig:"HANDLED_EVENT_TYPES" default:""`
+	// Whether monaco files are scanned for hardcoded secrets before deploying them
+	SecretScan bool `envconfig:"SECRET_SCAN" default:"true"`
+	// Regular expressions (one per line) detecting hardcoded secrets, empty uses the built-in patterns
+	SecretPatterns string `envconfig:"SECRET_PATTERNS" default:""`
+	// Interval of the status.changed events sent while monaco is running, 0 disables them
+	StatusInterval time.Duration `envconfig:"STATUS_INTERVAL" default:"1m"`
+	// Whether errors and warnings of runs are additionally reported as sh.keptn.log.error/warning events
+	EmitKeptnLogEvents bool `envconfig:"EMIT_KEPTN_LOG_EVENTS" default:"false"`
+	// Runs deploying the same content as a successful run within this window are skipped, 0 disables it
+	ContentDedupWindow time.Duration `envconfig:"CONTENT_DEDUP_WINDOW" default:"0"`
+	// Whether runs are skipped if the monaco configuration did not change since the last successful deployment to the stage
+	SkipUnchanged bool `envconfig:"SKIP_UNCHANGED" default:"false"`
+	// Directory the full log of each run is written to for log shippers, empty disables the deploy log files
+	DeployLogDir string `envconfig:"DEPLOY_LOG_DIR" default:""`
+	// File name of the deploy log within DEPLOY_LOG_DIR, a template using .KeptnContext, .Project, .Stage and .Service
+	DeployLogFileTemplate string `envconfig:"DEPLOY_LOG_FILE_TEMPLATE" default:"{{.KeptnContext}}-{{.Stage}}.log"`
+	// Deploy log files older than this are removed, 0 keeps them forever
+	DeployLogMaxAge time.Duration `envconfig:"DEPLOY_LOG_MAX_AGE" default:"168h"`
+	// Regular expression matching the output of monaco runs without changes, empty uses the built-in pattern
+	NoChangesPattern string `envconfig:"NO_CHANGES_PATTERN" default:""`
+	// Result of the .finished event of runs without changes, pass or warning
+	NoChangeResult string `envconfig:"NO_CHANGE_RESULT" default:"pass"`
+	// Regular expressions (one per line) matching warnings of successful monaco runs reported with the result warning, empty disables it
+	WarningPatterns string `envconfig:"WARNING_PATTERNS" default:""`
+	// Path of the pre-installed executables of pinned monaco releases, $VERSION is replaced by the pinned version
+	MonacoVersionPath string `envconfig:"MONACO_VERSION_PATH" default:"/usr/local/bin/monaco-$VERSION"`
+	// Triggers with the same deployment intent arriving within this window are deployed by a single run, 0 deploys each
+	DebounceWindow time.Duration `envconfig:"DEBOUNCE_WINDOW" default:"0"`
+	// Secret holding the OAuth credentials of the Dynatrace account deployed with the monaco.accountDeploy label
+	AccountCredentialsSecret string `envconfig:"ACCOUNT_CREDENTIALS_SECRET" default:"dynatrace-account"`
+	// comma separated domains the monaco.environmentUrl of events has to be below, empty allows all domains
+	EnvironmentURLAllowedDomains string `envconfig:"ENVIRONMENT_URL_ALLOWED_DOMAINS" default:"live.dynatrace.com,apps.dynatrace.com"`
+	// Variables (comma separated) the monaco.env event parameter may set, entries ending with * allow all variables with that prefix
+	MonacoEnvAllowed []string `envconfig:"MONACO_ENV_ALLOWED" default:""`
+	// Variables of the monaco.env event parameter (comma separated) that may override the Dynatrace credentials
+	MonacoEnvAllowOverride []string `envconfig:"MONACO_ENV_ALLOW_OVERRIDE" default:""`
+	// Sources (comma separated) CloudEvents are accepted from, empty accepts all sources
+	AllowedSources []string `envconfig:"ALLOWED_SOURCES" default:""`
+	// Data content types of the events whose payload is parsed, events without content type are parsed as JSON
+	AcceptedContentTypes []string `envconfig:"ACCEPTED_CONTENT_TYPES" default:"application/json,application/cloudevents+json"`
+	// Proxy and additional CA certificates used for the calls of the monaco-service to the Dynatrace API
+	HTTPSProxyURL string `envconfig:"HTTPS_PROXY_URL" default:""`
+	DTCACertPath  string `envconfig:"DT_CA_CERT_PATH" default:""`
+	// OS user and group monaco runs as, empty runs it as the user of the monaco-service (switching requires root)
+	MonacoUID string `envconfig:"MONACO_UID" default:""`
+	MonacoGID string `envconfig:"MONACO_GID" default:""`
+	// Number of event IDs remembered to skip redelivered events, 0 processes every delivery
+	EventIDCacheSize int `envconfig:"EVENT_ID_CACHE_SIZE" default:"1000"`
+	// Whether redelivered events (same event ID) are skipped
+	EventIDDedup bool `envconfig:"EVENT_ID_DEDUP" default:"true"`
+	// Events with the same deployment intent as an event deployed successfully within this window are skipped even if
+	// their IDs differ, 0 disables it
+	EventPayloadDedupWindow time.Duration `envconfig:"EVENT_PAYLOAD_DEDUP_WINDOW" default:"0"`
+	// Stages whose deployments are only planned (dry run) until the triggering event has the label monaco.approved=true
+	ProdStages []string `envconfig:"PROD_STAGES" default:""`
+	// Stages this instance deploys to, events of other stages are skipped; empty handles all stages
+	HandledStages []string `envconfig:"HANDLED_STAGES" default:""`
+	// Maximum triggered events processed per minute, further events are answered with 429; 0 is unlimited
+	MaxEventsPerMinute int `envconfig:"MAX_EVENTS_PER_MINUTE" default:"0"`
+	// Maximum events processed at the same time, further events wait for a free slot; 0 is unlimited
+	MaxConcurrentEvents int `envconfig:"MAX_CONCURRENT_EVENTS" default:"0"`
+	// Answer events exceeding MAX_CONCURRENT_EVENTS with 503 instead of waiting
+	RejectWhenBusy bool `envconfig:"REJECT_WHEN_BUSY" default:"false"`
+	// Link to the Dynatrace environment included in the .finished event, a template using .Environment, .KeptnContext,
+	// .Project, .Stage and .Service, empty disables the link
+	DeepLinkTemplate string `envconfig:"DEEP_LINK_TEMPLATE" default:"{{.Environment}}/#dashboards"`
+	// Message of the .finished event, a template using .KeptnContext, .Project, .Stage, .Service, .Status, .Result,
+	// .Message (the default message) and .Duration, empty keeps the default message
+	FinishedMessageTemplate string `envconfig:"FINISHED_MESSAGE_TEMPLATE" default:""`
+	// Whether the rendered deployment manifest (secrets redacted) is attached to the .finished event
+	AttachManifest bool `envconfig:"ATTACH_MANIFEST" default:"false"`
+	// Whether the configs of the environments are downloaded after a successful deployment and written to
+	// dynatrace/export/ of the config repo
+	ExportAfterDeploy bool `envconfig:"EXPORT_AFTER_DEPLOY" default:"false"`
+	// Whether the log of every deployment is uploaded to monaco-logs/<keptncontext>.log of the config repo
+	UploadLogs bool `envconfig:"UPLOAD_LOGS" default:"false"`
+	// Whether the redacted monaco output is attached to the .finished event as label
+	AttachOutput bool `envconfig:"ATTACH_OUTPUT" default:"false"`
+	// Size in bytes up to which the output is put into the label, larger output is written to a file in OUTPUT_DIR
+	MaxLabelSize int `envconfig:"MAX_LABEL_SIZE" default:"4096"`
+	// Directory the output exceeding MAX_LABEL_SIZE is written to
+	OutputDir string `envconfig:"OUTPUT_DIR" default:"tmp/monaco-output"`
+	// Output files in OUTPUT_DIR older than this are removed, 0 keeps them forever
+	OutputMaxAge time.Duration `envconfig:"OUTPUT_MAX_AGE" default:"168h"`
+	// Where the deployment history is recorded: none or file
+	HistoryBackend string `envconfig:"HISTORY_BACKEND" default:"none"`
+	// File the file history backend appends a JSON record per finished run to
+	HistoryFile string `envconfig:"HISTORY_FILE" default:""`
+	// OTLP endpoint the spans of the event processing are exported to, empty disables tracing
+	OTLPEndpoint string `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT" default:""`
+	// Certificate and key serving the receiver via HTTPS, either both or none must be set
+	TLSCertPath string `envconfig:"TLS_CERT_PATH" default:""`
+	TLSKeyPath  string `envconfig:"TLS_KEY_PATH" default:""`
 }
 
 type MonacoStartedEventData struct {
 	keptnv2.EventData
+	// layout of the payload, see MonacoSpecVersionLegacy and MonacoSpecVersion2
+	SpecVersion string `json:"specVersion,omitempty"`
+	// git branch the monaco files are fetched from, overridden by the label monaco.configRef (specVersion 1.0)
+	GitBranch string `json:"gitBranch,omitempty"`
+	// monaco specific parameters of the .triggered event
+	Monaco MonacoParameters `json:"monaco,omitempty"`
+	// remediation action of action.triggered events, see REMEDIATION_ACTIONS
+	Action *keptnv2.ActionInfo `json:"action,omitempty"`
+	// deployed artifact of deployment.triggered events, its image is available as $IMAGE in monaco files
+	ConfigurationChange keptnv2.ConfigurationChange `json:"configurationChange,omitempty"`
+}
+
+// MonacoParameters are passed in the monaco block of the .triggered event
+type MonacoParameters struct {
+	// environment variables passed to monaco, e.g., to be referenced in monaco templates
+	Env map[string]string `json:"env,omitempty"`
+	// stages deployed one after another by a single event, summarized in one .finished event
+	Stages []string `json:"stages,omitempty"`
+	// Dynatrace environment deployed to instead of the one of the credentials or environments file, requires
+	// TokenSecretRef
+	EnvironmentURL string `json:"environmentUrl,omitempty"`
+	// secret holding the DT_API_TOKEN for EnvironmentURL
+	TokenSecretRef string `json:"tokenSecretRef,omitempty"`
+	// git branch the monaco files are fetched from, overridden by the label monaco.configRef (specVersion 2.0)
+	GitBranch string `json:"gitBranch,omitempty"`
+}
+
+/**
+ * Version of the monaco block in MonacoFinishedEventData.
+ * Compatibility note for consumers: fields are only ever added within the same major version, so a consumer built
+ * for 1.x can read any 1.y payload and should ignore unknown fields. Renaming or removing a field bumps the major
+ * version; payloads without resultSchemaVersion were sent before versioning was introduced and carry no monaco block.
+ */
+const MonacoResultSchemaVersion = "1.0"
+
+// MonacoFinishedEventData is the payload of the monaco.finished event
+type MonacoFinishedEventData struct {
+	keptnv2.EventData
+	Monaco MonacoResult `json:"monaco"`
+}
+
+// MonacoResult contains the monaco specific details of a run
+type MonacoResult struct {
+	ResultSchemaVersion string `json:"resultSchemaVersion"`
+	// Keptn context passed to monaco as KEPTN_CONTEXT, only set if monaco was executed
+	KeptnContext string `json:"keptnContext,omitempty"`
+	// Configs deployed successfully and failed, only set for runs with monaco.continueOnError
+	Configs *common.MonacoConfigResults `json:"configs,omitempty"`
+	// Whether monaco was skipped because the event was a duplicate or the same content was deployed recently (see CONTENT_DEDUP_WINDOW)
+	Skipped bool `json:"skipped,omitempty"`
+	// Config folders (<project>/<api>) not deployed because their type is not in allowedTypes of monaco.conf.yaml
+	SkippedTypes []string `json:"skippedTypes,omitempty"`
+	// Existence check of the deployed configs, only set for events with the label monaco.verify
+	Verification *common.MonacoVerificationResult `json:"verification,omitempty"`
+	// Whether the deployment to a production stage was only planned and waits for the label monaco.approved, see PROD_STAGES
+	AwaitingApproval bool `json:"awaitingApproval,omitempty"`
+	// Output of the dry run of a deployment awaiting approval or requested with the label monaco.dryRun
+	Plan string `json:"plan,omitempty"`
+	// Configs the dry run would deploy, parsed from Plan
+	Changes []common.ConfigChange `json:"changes,omitempty"`
+	// Results of all stages of a promotion, only set for events with monaco.stages
+	Promotion *MonacoPromotionResult `json:"promotion,omitempty"`
+	// Configs monaco applied and failed to apply according to its output, only set if monaco deployed
+	ConfigsApplied int `json:"configsApplied"`
+	ConfigsFailed  int `json:"configsFailed"`
+	// Duration of the monaco run including the dry run, e.g., 1m12.5s
+	Duration string `json:"duration,omitempty"`
+	// Monaco environment deployed to, the host of the Dynatrace environment if monaco didn't name it
+	Environment string `json:"environment,omitempty"`
+	// Link to the Dynatrace environment monaco deployed to, see DEEP_LINK_TEMPLATE
+	DeepLink string `json:"deepLink,omitempty"`
+	// Outcome of a successful monaco run: deployed or no-changes if monaco found everything up-to-date
+	Outcome string `json:"outcome,omitempty"`
+	// What monaco was told to deploy against which environment with secrets redacted, only set with ATTACH_MANIFEST
+	Manifest *common.DeploymentManifest `json:"manifest,omitempty"`
+	// Whether the run was cancelled by sh.keptn.event.monaco.aborted
+	Aborted bool `json:"aborted,omitempty"`
+	// Files written to dynatrace/export/ of the config repo after the deployment, see EXPORT_AFTER_DEPLOY
+	Exported int `json:"exported,omitempty"`
+	// Lines of the monaco output matching WARNING_PATTERNS, the run then has the result warning
+	Warnings []string `json:"warnings,omitempty"`
 }
 
-// ServiceName specifies the current services name (e.g., used as source when sending CloudEvents)
+// Outcomes of successful monaco runs
+const MonacoOutcomeDeployed = "deployed"
+const MonacoOutcomeNoChanges = "no-changes"
+
+func newMonacoFinishedEventData(eventData *keptnv2.EventData) *MonacoFinishedEventData {
+	return &MonacoFinishedEventData{
+		EventData: *eventData,
+		Monaco: MonacoResult{
+			ResultSchemaVersion: MonacoResultSchemaVersion,
+		},
+	}
+}
+
+// ServiceName specifies the current services name (e.g., used as default source when sending CloudEvents, see CE_SOURCE)
 const ServiceName = "monaco-service"
+
+// source of the CloudEvents sent by the service, configured via CE_SOURCE
+var eventSource = ServiceName
+
 const MonacoEvent = "monaco"
 
 /**
@@ -46,16 +335,77 @@ func parseKeptnCloudEventPayload(event cloudevents.Event, data interface{}) erro
 	return nil
 }
 
+/**
+ * Returns an error if the data content type of the event is not one of acceptedContentTypes, so that a payload sent
+ * with a wrong content type is not silently misparsed. Parameters like charset are ignored, an empty content type
+ * defaults to JSON.
+ */
+func checkDataContentType(event cloudevents.Event, acceptedContentTypes []string) error {
+	contentType := event.DataContentType()
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("event %s has the invalid data content type '%s': %v", event.ID(), contentType, err)
+	}
+	for _, accepted := range acceptedContentTypes {
+		if strings.EqualFold(mediaType, strings.TrimSpace(accepted)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("event %s has the data content type '%s', expected one of %s", event.ID(), contentType, strings.Join(acceptedContentTypes, ", "))
+}
+
 /**
  * This method gets called when a new event is received from the Keptn Event Distributor
  * Depending on the Event Type will call the specific event handler functions, e.g: handleDeploymentFinishedEvent
  * See https://github.com/keptn/spec/blob/0.2.0-alpha/cloudevents.md for details on the payload
  */
 func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error {
+	// the handlers continue the trace of this span via the traceparent extension of the event
+	spanCtx, span := startEventSpan(&event, "processKeptnCloudEvent")
+	injectTraceContext(spanCtx, &event)
+
+	err := dispatchKeptnCloudEvent(ctx, event)
+	endSpan(span, err)
+	return err
+}
 
-	var shkeptncontext string
-	event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
-	logger := keptn.NewLogger(shkeptncontext, event.Context.GetID(), ServiceName)
+// dispatchKeptnCloudEvent checks the event and runs the handler registered for its type
+func dispatchKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error {
+	logger := newEventLogger(event)
+
+	// reject spoofed events, the delivery is not acknowledged
+	if !isAllowedSource(event.Source(), env.AllowedSources) {
+		logger.Error(fmt.Sprintf("Rejecting %s event %s from source %s: not in ALLOWED_SOURCES", event.Type(), event.ID(), event.Source()))
+		return fmt.Errorf("event source %s is not allowed", event.Source())
+	}
+
+	// throttled events are not acknowledged so that the distributor backs off and delivers them again
+	if eventRateLimiter != nil && isRateLimitedEvent(event.Type(), eventHandlers) && !eventRateLimiter.Allow() {
+		logger.Info(fmt.Sprintf("Throttling %s event %s: more than %d events per minute", event.Type(), event.ID(), env.MaxEventsPerMinute))
+		return cehttp.NewResult(http.StatusTooManyRequests, "more than %d events per minute", env.MaxEventsPerMinute)
+	}
+
+	// bound the monaco processes running at the same time, busy deliveries wait or are rejected (REJECT_WHEN_BUSY)
+	if eventSlots != nil && isConcurrencyLimitedEvent(event.Type(), eventHandlers) {
+		if env.RejectWhenBusy {
+			if !eventSlots.TryAcquire() {
+				logger.Info(fmt.Sprintf("Rejecting %s event %s: %d events are already in flight", event.Type(), event.ID(), env.MaxConcurrentEvents))
+				return cehttp.NewResult(http.StatusServiceUnavailable, "%d events are already in flight", env.MaxConcurrentEvents)
+			}
+		} else if err := eventSlots.Acquire(ctx); err != nil {
+			return err
+		}
+		defer eventSlots.Release()
+	}
+
+	// the Keptn handler and the event handlers parse the payload, events with a wrong content type are not acknowledged
+	if err := checkDataContentType(event, env.AcceptedContentTypes); err != nil {
+		logger.Error(fmt.Sprintf("Rejecting %s event: %v", event.Type(), err))
+		return err
+	}
 
 	// create keptn handler
 	logger.Info("Initializing Keptn Handler")
@@ -123,89 +473,322 @@ func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error
 		**/
 
 	/**
-	* The following code presents a very generic implementation of processing almost all possible
-	* Cloud Events that are retrieved by this service.
-	* Please follow the documentation provided above for more guidance on the different types.
-	* Feel free to delete parts that you don't need.
+	* The event types handled by this service are looked up in eventHandlers, which is built at startup from the
+	* built-in types and the additional types configured via HANDLED_EVENT_TYPES.
 	**/
-	switch event.Type() {
+	if handler, ok := eventHandlers[event.Type()]; ok {
+		logger.Info(fmt.Sprintf("Processing %s Event", event.Type()))
+		return runEventHandler(handler, myKeptn, event)
+	}
 
-	case keptnv2.GetTriggeredEventType(keptnv2.ConfigureMonitoringTaskName): // sh.keptn.event.configure-monitoring.triggered
-		logger.Info("Processing configure-monitoring.Triggered Event")
+	// Unknown Event -> Throw Error!
+	var errorMsg string
+	errorMsg = fmt.Sprintf("Unhandled Keptn Cloud Event: %s", event.Type())
 
-		eventData := &keptnv2.ConfigureMonitoringTriggeredEventData{}
-		parseKeptnCloudEventPayload(event, eventData)
+	logger.Error(errorMsg)
+	return nil
+}
 
-		return HandleConfigureMonitoringTriggeredEvent(myKeptn, event, eventData)
+// maximum length of the stack trace sent in the .finished event of a run that panicked
+const panicStackLimit = 2048
 
-		// -------------------------------------------------------
-	// your custom cloud event, e.g., sh.keptn.your-event
-	// see https://github.com/keptn-sandbox/echo-service/blob/a90207bc119c0aca18368985c7bb80dea47309e9/pkg/events.go
-	// for an example on how to generate your own CloudEvents and structs
-	case keptnv2.GetTriggeredEventType(MonacoEvent): // sh.keptn.event.monaco.triggered
-		logger.Info("Processing sh.keptn.event.monaco.triggered Event")
+/**
+ * Runs the handler and turns a panic into a failed .finished event with the panic message and its (truncated) stack
+ * trace, so a single broken event doesn't take down the service. The delivery is acknowledged.
+ */
+func runEventHandler(handler keptnEventHandler, myKeptn *keptnv2.Keptn, event cloudevents.Event) (err error) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		stack := string(debug.Stack())
+		logger := newEventLogger(event)
+		logger.Error(fmt.Sprintf("Handling %s event %s panicked: %v\n%s", event.Type(), event.ID(), recovered, stack))
+		if len(stack) > panicStackLimit {
+			stack = stack[:panicStackLimit] + "\n..."
+		}
 
-		eventData := &MonacoStartedEventData{}
-		parseKeptnCloudEventPayload(event, eventData)
+		message := fmt.Sprintf("monaco-service panicked: %v\n%s", recovered, stack)
+		// the payload has the schema of every other monaco.finished event, so consumers can parse it as well
+		finishedData := newMonacoFinishedEventData(&keptnv2.EventData{Status: keptnv2.StatusErrored, Result: keptnv2.ResultFailed, Message: message})
+		if _, sendErr := myKeptn.SendTaskFinishedEvent(finishedData, eventSource); sendErr != nil {
+			logger.Error(fmt.Sprintf("Could not send .finished event for %s: %v", event.ID(), sendErr))
+			err = sendErr
+		}
+	}()
 
-		return HandleMonacoTriggeredEvent(myKeptn, event, eventData)
-		break
+	return handler(myKeptn, event)
+}
 
-		/*   HERE SOME ADDITIONAL OPTIONS TO CONSIDER IN THE FUTURE!!
-		// -------------------------------------------------------
-		// sh.keptn.event.project.create - Note: This is due to change
-		case keptnv2.GetStartedEventType(keptnv2.ProjectCreateTaskName): // sh.keptn.event.project.create.started
-			log.Printf("Processing Project.Create.Started Event")
-			// Please note: Processing .started, .status.changed and .finished events is only recommended when you want to
-			// notify an external service (e.g., for logging purposes).
+// isAllowedSource returns whether events from source are processed, all sources are allowed if allowedSources is empty
+func isAllowedSource(source string, allowedSources []string) bool {
+	allowAll := true
+	for _, allowedSource := range allowedSources {
+		allowedSource = strings.TrimSpace(allowedSource)
+		if allowedSource == "" {
+			continue
+		}
+		if allowedSource == source {
+			return true
+		}
+		allowAll = false
+	}
+	return allowAll
+}
 
-			eventData := &keptnv2.ProjectCreateStartedEventData{}
-			parseKeptnCloudEventPayload(event, eventData)
+// keptnEventHandler processes one type of Keptn CloudEvent
+type keptnEventHandler func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error
 
-			return GenericLogKeptnCloudEventHandler(myKeptn, event, eventData)
-		case keptnv2.GetFinishedEventType(keptnv2.ProjectCreateTaskName): // sh.keptn.event.project.create.finished
-			log.Printf("Processing Project.Create.Finished Event")
-			// Please note: Processing .started, .status.changed and .finished events is only recommended when you want to
-			// notify an external service (e.g., for logging purposes).
+// eventHandlers maps the types of the CloudEvents this service processes to their handlers
+var eventHandlers, _ = newEventHandlers(nil)
 
-			eventData := &keptnv2.ProjectCreateFinishedEventData{}
-			parseKeptnCloudEventPayload(event, eventData)
+/**
+ * Builds the map of handled event types: configure-monitoring.triggered, monaco.triggered, monaco.aborted, get-sli.triggered
+ * and service.delete.finished are always handled,
+ * deployment.triggered runs monaco if it indicates monaco as deployment tool, action.triggered if its remediation
+ * action is listed in REMEDIATION_ACTIONS.
+ * additionalTypes (e.g., deployment.triggered or sh.keptn.event.deployment.triggered) always run monaco.
+ */
+func newEventHandlers(additionalTypes []string) (map[string]keptnEventHandler, error) {
+	handlers := map[string]keptnEventHandler{
+		keptnv2.GetTriggeredEventType(keptnv2.ConfigureMonitoringTaskName): handleConfigureMonitoringEvent, // sh.keptn.event.configure-monitoring.triggered
+		keptnv2.GetTriggeredEventType(MonacoEvent):                         handleMonacoEvent,              // sh.keptn.event.monaco.triggered
+		monacoAbortedEventType:                                             handleMonacoAbortedEvent,       // sh.keptn.event.monaco.aborted
+		keptnv2.GetTriggeredEventType(keptnv2.GetSLITaskName):              handleGetSLIEvent,              // sh.keptn.event.get-sli.triggered
+		serviceDeleteFinishedEventType:                                     handleServiceDeleteEvent,       // sh.keptn.event.service.delete.finished
+	}
 
-			// Just log this event
-			return GenericLogKeptnCloudEventHandler(myKeptn, event, eventData)
-		// -------------------------------------------------------
-		// sh.keptn.event.service.create - Note: This is due to change
-		case keptnv2.GetStartedEventType(keptnv2.ServiceCreateTaskName): // sh.keptn.event.service.create.started
-			log.Printf("Processing Service.Create.Started Event")
-			// Please note: Processing .started, .status.changed and .finished events is only recommended when you want to
-			// notify an external service (e.g., for logging purposes).
+	for _, eventType := range additionalTypes {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" {
+			continue
+		}
+		if !strings.HasPrefix(eventType, "sh.keptn.event.") {
+			eventType = "sh.keptn.event." + eventType
+		}
+		if !strings.HasSuffix(eventType, ".triggered") {
+			return nil, fmt.Errorf("cannot handle %s: only .triggered events can run monaco", eventType)
+		}
+		if _, ok := handlers[eventType]; !ok {
+			handlers[eventType] = handleMonacoEvent
+		}
+	}
 
-			eventData := &keptnv2.ServiceCreateStartedEventData{}
-			parseKeptnCloudEventPayload(event, eventData)
+	deploymentTriggeredType := keptnv2.GetTriggeredEventType(keptnv2.DeploymentTaskName) // sh.keptn.event.deployment.triggered
+	if _, ok := handlers[deploymentTriggeredType]; !ok {
+		handlers[deploymentTriggeredType] = handleDeploymentEvent
+	}
+	actionTriggeredType := keptnv2.GetTriggeredEventType(keptnv2.ActionTaskName) // sh.keptn.event.action.triggered
+	if _, ok := handlers[actionTriggeredType]; !ok {
+		handlers[actionTriggeredType] = handleActionEvent
+	}
+	return handlers, nil
+}
 
-			// Just log this event
-			return GenericLogKeptnCloudEventHandler(myKeptn, event, eventData)
-		case keptnv2.GetFinishedEventType(keptnv2.ServiceCreateTaskName): // sh.keptn.event.service.create.finished
-			log.Printf("Processing Service.Create.Finished Event")
-			// Please note: Processing .started, .status.changed and .finished events is only recommended when you want to
-			// notify an external service (e.g., for logging purposes).
+func handleConfigureMonitoringEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	eventData := &keptnv2.ConfigureMonitoringTriggeredEventData{}
+	if err := parseKeptnCloudEventPayload(event, eventData); err != nil {
+		return err
+	}
 
-			eventData := &keptnv2.ServiceCreateFinishedEventData{}
-			parseKeptnCloudEventPayload(event, eventData)
+	return HandleConfigureMonitoringTriggeredEvent(myKeptn, event, eventData)
+}
 
-			// Just log this event
-			return GenericLogKeptnCloudEventHandler(myKeptn, event, eventData) */
+func handleMonacoEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	eventData := &MonacoStartedEventData{}
+	if err := parseKeptnCloudEventPayload(event, eventData); err != nil {
+		return err
+	}
 
+	// distributors may deliver an event more than once, it is only deployed the first time. This is checked once per
+	// incoming event, the stages of a promotion run with its ID as well.
+	if env.EventIDDedup && processedEvents != nil && processedEvents.Seen(event.Context.GetID()) {
+		newEventLogger(event).Info(fmt.Sprintf("Skipping event %s, it was already processed", event.Context.GetID()))
+		finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+			Status:  keptnv2.StatusSucceeded,
+			Result:  keptnv2.ResultPass,
+			Message: "Duplicate event, skipped",
+		})
+		finishedData.Monaco.Skipped = true
+		_, err := myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+		return err
 	}
 
-	// Unknown Event -> Throw Error!
-	var errorMsg string
-	errorMsg = fmt.Sprintf("Unhandled Keptn Cloud Event: %s", event.Type())
+	var err error
+	if versionErr := applyMonacoSpecVersion(eventData); versionErr != nil {
+		err = sendMonacoErrorFinishedEvent(myKeptn, newEventLogger(event), &MonacoError{Kind: KindValidation, Err: versionErr})
+	} else {
+		err = handleDebouncedMonacoTriggeredEvent(myKeptn, event, eventData, env.DebounceWindow)
+	}
+	var monacoErr *MonacoError
+	if errors.As(err, &monacoErr) {
+		// the failure has already been reported via the .finished event, so the delivery is acknowledged
+		newEventLogger(event).Error(fmt.Sprintf("Monaco run for %s failed: %v", event.Context.GetID(), monacoErr))
+		return nil
+	}
+	return err
+}
 
-	logger.Error(errorMsg)
+// environment variables of the Keptn distributor naming the port and path it forwards cloudevents to
+const distributorPortVariable = "PUBSUB_RECIPIENT_PORT"
+const distributorPathVariable = "PUBSUB_RECIPIENT_PATH"
+
+/**
+ * Receives cloudevents on the port and path the Keptn distributor forwards them to (PUBSUB_RECIPIENT_PORT and
+ * PUBSUB_RECIPIENT_PATH) unless RCV_PORT or RCV_PATH/RCV_PATHS are set explicitly
+ */
+func applyDistributorDefaults(env *envConfig, lookupEnv func(string) (string, bool)) error {
+	if _, explicit := lookupEnv("RCV_PORT"); !explicit {
+		if port, ok := lookupEnv(distributorPortVariable); ok && port != "" {
+			parsed, err := strconv.Atoi(port)
+			if err != nil {
+				return fmt.Errorf("invalid %s '%s': %v", distributorPortVariable, port, err)
+			}
+			env.Port = parsed
+		}
+	}
+	_, explicitPath := lookupEnv("RCV_PATH")
+	_, explicitPaths := lookupEnv("RCV_PATHS")
+	if !explicitPath && !explicitPaths {
+		if path, ok := lookupEnv(distributorPathVariable); ok && path != "" {
+			env.Path = path
+		}
+	}
 	return nil
 }
 
+// paths of the endpoints served next to the cloudevents receiver
+var reservedPaths = []string{"/ready", "/metrics", "/version", "/replay"}
+
+/**
+ * Returns the paths the cloudevents receiver is served on: paths (RCV_PATHS) if set, otherwise path (RCV_PATH).
+ * Paths ending with / also receive on all paths below them.
+ */
+func getReceivePaths(path string, paths []string) ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, receivePath := range paths {
+		receivePath = strings.TrimSpace(receivePath)
+		if receivePath != "" && !seen[receivePath] {
+			result = append(result, receivePath)
+			seen[receivePath] = true
+		}
+	}
+	if len(result) == 0 {
+		result = []string{path}
+	}
+
+	for _, receivePath := range result {
+		if !strings.HasPrefix(receivePath, "/") {
+			return nil, fmt.Errorf("path %s must start with /", receivePath)
+		}
+		for _, reservedPath := range reservedPaths {
+			if strings.TrimSuffix(receivePath, "/") == reservedPath {
+				return nil, fmt.Errorf("path %s collides with %s", receivePath, reservedPath)
+			}
+		}
+	}
+	return result, nil
+}
+
+/**
+ * Listens on port, with TLS if the certificate and key at certPath and keyPath are set. Either both or none of them
+ * must be set.
+ */
+func newListener(port int, certPath string, keyPath string) (net.Listener, error) {
+	if (certPath == "") != (keyPath == "") {
+		return nil, errors.New("TLS_CERT_PATH and TLS_KEY_PATH must be set together")
+	}
+
+	var tlsConfig *tls.Config
+	if certPath != "" {
+		certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the TLS certificate: %v", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		return tls.NewListener(listener, tlsConfig), nil
+	}
+	return listener, nil
+}
+
+/**
+ * Creates the http protocol receiving cloudevents on all paths, mux serves the other endpoints
+ */
+func newHTTPProtocol(listenOption cehttp.Option, paths []string, mux *http.ServeMux) (*cehttp.Protocol, error) {
+	// the protocol registers itself on the first path when it is opened
+	p, err := cehttp.New(listenOption, cehttp.WithPath(paths[0]))
+	if err != nil {
+		return nil, err
+	}
+	p.Handler = mux
+	for _, path := range paths[1:] {
+		mux.Handle(path, p)
+	}
+	return p, nil
+}
+
+// deployment.triggered events run monaco if their deployment strategy is monaco or they have the label deploymentTool=monaco
+const monacoDeploymentStrategy = "monaco"
+const deploymentToolLabel = "deploymentTool"
+
+func isMonacoDeployment(eventData *keptnv2.DeploymentTriggeredEventData) bool {
+	return eventData.Deployment.DeploymentStrategy == monacoDeploymentStrategy || eventData.Labels[deploymentToolLabel] == monacoDeploymentStrategy
+}
+
+func handleDeploymentEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	eventData := &keptnv2.DeploymentTriggeredEventData{}
+	if err := parseKeptnCloudEventPayload(event, eventData); err != nil {
+		return err
+	}
+
+	// deployments done by other tools are none of our business
+	if !isMonacoDeployment(eventData) {
+		newEventLogger(event).Info(fmt.Sprintf("Ignoring %s, it is not a monaco deployment", event.Context.GetID()))
+		return nil
+	}
+
+	return handleMonacoEvent(myKeptn, event)
+}
+
+// getRemediationActionProjects returns the monaco projects deploying the remediation action, nil if it isn't mapped
+func getRemediationActionProjects(action string, remediationActions map[string]string) []string {
+	mapping, ok := remediationActions[action]
+	if !ok {
+		return nil
+	}
+	projects := []string{}
+	for _, project := range strings.Split(mapping, ";") {
+		if project = strings.TrimSpace(project); project != "" {
+			projects = append(projects, project)
+		}
+	}
+	return projects
+}
+
+func handleActionEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	eventData := &keptnv2.ActionTriggeredEventData{}
+	if err := parseKeptnCloudEventPayload(event, eventData); err != nil {
+		return err
+	}
+
+	// other action providers handle the actions that aren't mapped to monaco projects
+	if len(getRemediationActionProjects(eventData.Action.Action, env.RemediationActions)) == 0 {
+		newEventLogger(event).Info(fmt.Sprintf("Ignoring %s, the action '%s' is not a monaco remediation action", event.Context.GetID(), eventData.Action.Action))
+		return nil
+	}
+
+	return handleMonacoEvent(myKeptn, event)
+}
+
 /**
  * Usage: ./main
  * no args: starts listening for cloudnative events on localhost:port/path
@@ -214,10 +797,12 @@ func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error
  * env=runlocal   -> will fetch resources from local drive instead of configuration service
  */
 func main() {
-	var env envConfig
 	if err := envconfig.Process("", &env); err != nil {
 		log.Fatalf("Failed to process env var: %s", err)
 	}
+	if err := applyDistributorDefaults(&env, os.LookupEnv); err != nil {
+		log.Fatalf("Failed to process env var: %s", err)
+	}
 
 	os.Exit(_main(os.Args[1:], env))
 }
@@ -232,29 +817,272 @@ func _main(args []string, env envConfig) int {
 		keptnOptions.UseLocalFileSystem = true
 	}
 
-	keptnOptions.ConfigurationServiceURL = env.ConfigurationServiceUrl
+	configurationServiceURL, err := common.ExpandConfigurationServiceURL(env.ConfigurationServiceUrl)
+	if err != nil {
+		log.Fatalf("Invalid CONFIGURATION_SERVICE: %v", err)
+	}
+	common.SetConfigurationServiceURL(configurationServiceURL)
+	keptnOptions.ConfigurationServiceURL = configurationServiceURL
+	if env.CESource != "" {
+		eventSource = env.CESource
+	}
 
-	log.Println("Starting monaco-service...")
-	log.Printf("    on Port = %d; Path=%s", env.Port, env.Path)
+	if err := common.SetResourceSource(env.ResourceSource, env.ResourceHTTPURL); err != nil {
+		log.Fatalf("Invalid RESOURCE_SOURCE: %v", err)
+	}
+	common.SetConfigMountPath(env.ConfigMountPath)
+	if env.FetchMaxRetries < 0 {
+		log.Fatalf("Invalid FETCH_MAX_RETRIES '%d', must not be negative", env.FetchMaxRetries)
+	}
+	common.SetFetchMaxRetries(env.FetchMaxRetries)
+	if env.ResourceCacheTTL > 0 && env.ResourceCacheSize <= 0 {
+		log.Fatalf("Invalid RESOURCE_CACHE_SIZE '%d', must be positive", env.ResourceCacheSize)
+	}
+	common.SetResourceCache(env.ResourceCacheTTL, env.ResourceCacheSize)
+	if env.MaxLabelSize < 0 {
+		log.Fatalf("Invalid MAX_LABEL_SIZE '%d', must not be negative", env.MaxLabelSize)
+	}
+
+	if env.MonacoDownloadURL != "" {
+		downloaded, err := common.EnsureMonacoExecutable(env.MonacoDownloadURL, env.MonacoReleaseVersion, env.MonacoDownloadSHA256)
+		if err != nil {
+			log.Fatalf("Could not provide monaco: %v", err)
+		}
+		if downloaded {
+			log.Printf("Downloaded monaco %s", env.MonacoReleaseVersion)
+		}
+	}
+
+	eventSender, err := newEventSender(env.EventBrokerURL, keptnOptions.EventSender)
+	if err != nil {
+		log.Fatalf("Invalid EVENT_BROKER_URL '%s': %v", env.EventBrokerURL, err)
+	}
+	history, err := newHistoryBackend(env.HistoryBackend, env.HistoryFile)
+	if err != nil {
+		log.Fatalf("Invalid HISTORY_BACKEND: %v", err)
+	}
+	eventSender, err = newHistoryEventSender(eventSender, history)
+	if err != nil {
+		log.Fatalf("Could not record the deployment history: %v", err)
+	}
+	keptnOptions.EventSender = eventSender
+
+	handlers, err := newEventHandlers(env.HandledEventTypes)
+	if err != nil {
+		log.Fatalf("Invalid HANDLED_EVENT_TYPES: %v", err)
+	}
+	eventHandlers = handlers
+
+	if env.TokenDelivery != common.TokenDeliveryEnv && env.TokenDelivery != common.TokenDeliveryFile {
+		log.Fatalf("Invalid TOKEN_DELIVERY '%s', must be one of %s, %s", env.TokenDelivery, common.TokenDeliveryEnv, common.TokenDeliveryFile)
+	}
+
+	if env.MonacoVersion != common.MonacoCLIVersion1 && env.MonacoVersion != common.MonacoCLIVersion2 {
+		log.Fatalf("Invalid MONACO_CLI_VERSION '%s', must be one of %s, %s", env.MonacoVersion, common.MonacoCLIVersion1, common.MonacoCLIVersion2)
+	}
+
+	if env.CrossProjectDeps != common.CrossProjectDepsInclude && env.CrossProjectDeps != common.CrossProjectDepsFail {
+		log.Fatalf("Invalid CROSS_PROJECT_DEPS '%s', must be one of %s, %s", env.CrossProjectDeps, common.CrossProjectDepsInclude, common.CrossProjectDepsFail)
+	}
+
+	if env.DeploymentLockRedisURL != "" {
+		locker, err := newRedisLocker(env.DeploymentLockRedisURL, env.DeploymentLockTTL)
+		if err != nil {
+			log.Fatalf("Invalid DEPLOYMENT_LOCK_REDIS_URL or DEPLOYMENT_LOCK_TTL: %v", err)
+		}
+		deploymentLocks = locker
+	}
+
+	receivePaths, err := getReceivePaths(env.Path, env.Paths)
+	if err != nil {
+		log.Fatalf("Invalid RCV_PATHS: %v", err)
+	}
+
+	if env.Transport != transportHTTP && env.Transport != transportNATS {
+		log.Fatalf("Invalid TRANSPORT '%s', must be one of %s, %s", env.Transport, transportHTTP, transportNATS)
+	}
+
+	if (env.TLSCertPath == "") != (env.TLSKeyPath == "") {
+		log.Fatalf("Invalid TLS configuration: TLS_CERT_PATH and TLS_KEY_PATH must be set together")
+	}
+
+	if env.SecretScan {
+		patterns, err := common.ParseSecretPatterns(env.SecretPatterns)
+		if err != nil {
+			log.Fatalf("Invalid SECRET_PATTERNS: %v", err)
+		}
+		secretPatterns = patterns
+	}
+
+	patterns, err := common.ParseWarningPatterns(env.WarningPatterns)
+	if err != nil {
+		log.Fatalf("Invalid WARNING_PATTERNS: %v", err)
+	}
+	warningPatterns = patterns
+
+	if _, err := parseDeepLinkTemplate(env.DeepLinkTemplate); err != nil {
+		log.Fatalf("Invalid DEEP_LINK_TEMPLATE '%s': %v", env.DeepLinkTemplate, err)
+	}
+
+	if _, err := parseFinishedMessageTemplate(env.FinishedMessageTemplate); err != nil {
+		log.Printf("Invalid FINISHED_MESSAGE_TEMPLATE '%s', using the default messages: %v", env.FinishedMessageTemplate, err)
+	}
+
+	dynatraceClient, err := common.NewDynatraceHTTPClient(env.HTTPSProxyURL, env.DTCACertPath)
+	if err != nil {
+		log.Fatalf("Invalid HTTPS_PROXY_URL or DT_CA_CERT_PATH: %v", err)
+	}
+	common.SetDynatraceHTTPClient(dynatraceClient)
+
+	user, err := common.ParseMonacoUser(env.MonacoUID, env.MonacoGID)
+	if err != nil {
+		log.Fatalf("Invalid MONACO_UID/MONACO_GID: %v", err)
+	}
+	if user != nil {
+		if err := common.CheckMonacoUser(user); err != nil {
+			log.Fatalf("Invalid MONACO_UID/MONACO_GID: %v", err)
+		}
+		monacoUser = user
+	}
+
+	if env.EventIDCacheSize > 0 {
+		processedEvents = newEventIDCache(env.EventIDCacheSize)
+	}
+
+	if env.MaxEventsPerMinute < 0 {
+		log.Fatalf("Invalid MAX_EVENTS_PER_MINUTE %d, must not be negative", env.MaxEventsPerMinute)
+	}
+	if env.MaxEventsPerMinute > 0 {
+		eventRateLimiter = newTokenBucket(env.MaxEventsPerMinute, time.Now)
+	}
+
+	if env.MaxConcurrentEvents < 0 {
+		log.Fatalf("Invalid MAX_CONCURRENT_EVENTS %d, must not be negative", env.MaxConcurrentEvents)
+	}
+	if env.MaxConcurrentEvents > 0 {
+		eventSlots = newEventSemaphore(env.MaxConcurrentEvents)
+	}
+
+	if env.NoChangesPattern != "" {
+		pattern, err := regexp.Compile(env.NoChangesPattern)
+		if err != nil {
+			log.Fatalf("Invalid NO_CHANGES_PATTERN '%s': %v", env.NoChangesPattern, err)
+		}
+		noChangesPattern = pattern
+	}
+	if env.NoChangeResult != string(keptnv2.ResultPass) && env.NoChangeResult != string(keptnv2.ResultWarning) {
+		log.Fatalf("Invalid NO_CHANGE_RESULT '%s', must be one of %s, %s", env.NoChangeResult, keptnv2.ResultPass, keptnv2.ResultWarning)
+	}
+
+	if env.DeployLogDir != "" {
+		if _, err := parseDeployLogFileTemplate(env.DeployLogFileTemplate); err != nil {
+			log.Fatalf("Invalid DEPLOY_LOG_FILE_TEMPLATE '%s': %v", env.DeployLogFileTemplate, err)
+		}
+		if env.DeployLogMaxAge > 0 {
+			startFileReaper("deploy log", env.DeployLogDir, env.DeployLogMaxAge)
+		}
+	}
+	if env.AttachOutput && env.OutputMaxAge > 0 {
+		startFileReaper("monaco output", env.OutputDir, env.OutputMaxAge)
+	}
+
+	if env.RecoverInProgressRuns {
+		recoverInProgressRuns(common.MonacoBaseFolder, keptnOptions)
+	}
+	common.IsolateTenants = env.WorkDirPerTenant
+	if env.TempMaxAge > 0 {
+		cleanupOrphanedTempFolders(common.MonacoBaseFolder, env.TempMaxAge, time.Now())
+	}
+
+	buildInfo := getBuildInfo()
+	log.Printf("Starting monaco-service %s (commit %s, built %s, %s)...", buildInfo.Version, buildInfo.Commit, buildInfo.BuildDate, buildInfo.GoVersion)
+	log.Printf("    on Port = %d; Path=%s", env.Port, strings.Join(receivePaths, ","))
+
+	shutdownTracing, err := initTracing(env.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("Could not set up tracing to OTEL_EXPORTER_OTLP_ENDPOINT: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+	if env.OTLPEndpoint != "" {
+		log.Printf("    exporting traces to %s", env.OTLPEndpoint)
+	}
 
 	ctx := context.Background()
 	ctx = cloudevents.WithEncodingStructured(ctx)
 
-	log.Printf("Creating new http handler")
-
-	// configure http server to receive cloudevents
-	p, err := cloudevents.NewHTTP(cloudevents.WithPath(env.Path), cloudevents.WithPort(env.Port))
+	// serve the readiness check, metrics and build info next to the cloudevents receiver
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", handleReady)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/version", handleVersion)
+	if env.ReplayToken != "" {
+		mux.HandleFunc("/replay", newReplayHandler(env.ReplayToken))
+		log.Printf("    serving /replay")
+	}
 
+	listener, err := newListener(env.Port, env.TLSCertPath, env.TLSKeyPath)
 	if err != nil {
-		log.Fatalf("failed to create client, %v", err)
+		log.Fatalf("Could not listen on port %d: %v", env.Port, err)
+	}
+	if env.TLSCertPath != "" {
+		log.Printf("    serving HTTPS with the certificate %s", env.TLSCertPath)
+	}
+
+	var p interface{}
+	if env.Transport == transportNATS {
+		log.Printf("Subscribing to %s on %s", env.NATSSubject, env.NATSURL)
+
+		// configure nats subscription to receive cloudevents
+		natsConsumer, err := newNATSConsumer(env.NATSURL, env.NATSSubject)
+		if err != nil {
+			log.Fatalf("failed to create client, %v", err)
+		}
+		p = natsConsumer
+
+		go func() {
+			log.Fatal(http.Serve(listener, mux))
+		}()
+	} else {
+		log.Printf("Creating new http handler")
+
+		// configure http server to receive cloudevents
+		httpProtocol, err := newHTTPProtocol(cehttp.WithListener(listener), receivePaths, mux)
+		if err != nil {
+			log.Fatalf("failed to create client, %v", err)
+		}
+		p = httpProtocol
 	}
+
 	c, err := cloudevents.NewClient(p)
 	if err != nil {
 		log.Fatalf("failed to create client, %v", err)
 	}
 
+	// stop receiving on SIGTERM, e.g., during rolling restarts
+	ctx, stop := withShutdownSignal(ctx)
+	defer stop()
+
+	var lifecycleEvents keptn.EventSender
+	if env.EmitLifecycleEvents {
+		lifecycleEvents, err = newLifecycleEventSender(env.LifecycleEventsURL)
+		if err != nil {
+			log.Fatalf("Invalid LIFECYCLE_EVENTS_URL '%s': %v", env.LifecycleEventsURL, err)
+		}
+		if err := sendLifecycleEvent(lifecycleEvents, serviceStartedEventType); err != nil {
+			log.Printf("Could not send %s: %v", serviceStartedEventType, err)
+		}
+	}
+
 	log.Printf("Starting receiver")
-	log.Fatal(c.StartReceiver(ctx, processKeptnCloudEvent))
+	if err := c.StartReceiver(ctx, processKeptnCloudEvent); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Stopped receiver")
 
+	if lifecycleEvents != nil {
+		if err := sendLifecycleEvent(lifecycleEvents, serviceStoppedEventType); err != nil {
+			log.Printf("Could not send %s: %v", serviceStoppedEventType, err)
+		}
+	}
 	return 0
 }
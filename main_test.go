@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+func TestProcessKeptnCloudEventRoutesCustomEventType(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+
+	handlers, err := newEventHandlers([]string{"deployment.triggered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(original map[string]keptnEventHandler) { eventHandlers = original }(eventHandlers)
+	eventHandlers = handlers
+
+	eventSender := &fake.EventSender{}
+	defer func() { keptnOptions.EventSender = nil }()
+	keptnOptions.EventSender = eventSender
+
+	_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomingEvent.SetType(keptnv2.GetTriggeredEventType(keptnv2.DeploymentTaskName))
+
+	if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = eventSender.AssertSentEventTypes([]string{
+		keptnv2.GetStartedEventType(keptnv2.DeploymentTaskName),
+		keptnv2.GetFinishedEventType(keptnv2.DeploymentTaskName),
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessKeptnCloudEventRunsMonacoDeployments(t *testing.T) {
+	tests := []struct {
+		name           string
+		strategy       string
+		labels         map[string]string
+		expectedEvents []string
+	}{
+		{
+			name:           "monaco deployment strategy",
+			strategy:       monacoDeploymentStrategy,
+			expectedEvents: []string{keptnv2.GetStartedEventType(keptnv2.DeploymentTaskName), keptnv2.GetFinishedEventType(keptnv2.DeploymentTaskName)},
+		},
+		{
+			name:           "deploymentTool label",
+			strategy:       "direct",
+			labels:         map[string]string{deploymentToolLabel: monacoDeploymentStrategy},
+			expectedEvents: []string{keptnv2.GetStartedEventType(keptnv2.DeploymentTaskName), keptnv2.GetFinishedEventType(keptnv2.DeploymentTaskName)},
+		},
+		{
+			name:           "other deployment tool",
+			strategy:       "blue_green_service",
+			expectedEvents: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, `echo "$@" >> args.log`, nil)()
+
+			eventSender := &fake.EventSender{}
+			defer func() { keptnOptions.EventSender = nil }()
+			keptnOptions.EventSender = eventSender
+
+			_, incomingEvent, err := initializeTestObjects("test-events/deployment.triggered.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventData := &keptnv2.DeploymentTriggeredEventData{}
+			incomingEvent.DataAs(eventData)
+			eventData.Deployment.DeploymentStrategy = tt.strategy
+			for key, value := range tt.labels {
+				eventData.Labels[key] = value
+			}
+			incomingEvent.SetData(cloudevents.ApplicationJSON, eventData)
+
+			if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := eventSender.AssertSentEventTypes(tt.expectedEvents); err != nil {
+				t.Error(err)
+			}
+			args, _ := ioutil.ReadFile("args.log")
+			if ranMonaco := len(args) > 0; ranMonaco != (len(tt.expectedEvents) > 0) {
+				t.Errorf("expected monaco to run: %t, got %t", len(tt.expectedEvents) > 0, ranMonaco)
+			}
+			if len(tt.expectedEvents) == 0 {
+				return
+			}
+
+			finishedData := &keptnv2.EventData{}
+			eventSender.SentEvents[1].DataAs(finishedData)
+			if finishedData.Result != keptnv2.ResultPass {
+				t.Errorf("expected a passed deployment.finished event, got %s: %s", finishedData.Result, finishedData.Message)
+			}
+		})
+	}
+}
+
+func TestNewEventHandlersRejectsNonTriggeredTypes(t *testing.T) {
+	if _, err := newEventHandlers([]string{"deployment.finished"}); err == nil {
+		t.Errorf("expected an error for a .finished event type")
+	}
+}
+
+func TestHTTPProtocolReceivesOnAllPaths(t *testing.T) {
+	paths, err := getReceivePaths("/", []string{"/keptn", " /ingress/monaco/ "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routed := make(chan cloudevents.Event, 2)
+	defer func(handlers map[string]keptnEventHandler) { eventHandlers = handlers }(eventHandlers)
+	eventHandlers = map[string]keptnEventHandler{
+		keptnv2.GetTriggeredEventType(MonacoEvent): func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			routed <- event
+			return nil
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", handleReady)
+	p, err := newHTTPProtocol(cehttp.WithListener(listener), paths, mux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cloudevents.NewClient(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.StartReceiver(cloudevents.WithEncodingStructured(ctx), processKeptnCloudEvent)
+
+	triggeredEvent, err := ioutil.ReadFile(filepath.Join(testRootDir, "test-events/monaco.triggered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/keptn", "/ingress/monaco/sub"} {
+		resp, err := http.Post("http://"+listener.Addr().String()+path, "application/cloudevents+json", bytes.NewReader(triggeredEvent))
+		if err != nil {
+			t.Fatalf("could not post to %s: %v", path, err)
+		}
+		resp.Body.Close()
+
+		select {
+		case <-routed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the event posted to %s was not routed to its handler", path)
+		}
+	}
+
+	// paths that are not configured don't receive events
+	resp, err := http.Post("http://"+listener.Addr().String()+"/other", "application/cloudevents+json", bytes.NewReader(triggeredEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a path that is not configured, got %d", resp.StatusCode)
+	}
+}
+
+func TestGetReceivePaths(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		paths       []string
+		expected    []string
+		expectError bool
+	}{
+		{name: "RCV_PATH only", path: "/", expected: []string{"/"}},
+		{name: "RCV_PATHS replaces RCV_PATH", path: "/", paths: []string{"/a", "/b", "/a"}, expected: []string{"/a", "/b"}},
+		{name: "collides with /metrics", path: "/", paths: []string{"/metrics"}, expectError: true},
+		{name: "collides with /ready", path: "/ready/", expectError: true},
+		{name: "relative path", path: "/", paths: []string{"keptn"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := getReceivePaths(tt.path, tt.paths)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", paths)
+				}
+				return
+			}
+			if err != nil || len(paths) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v (%v)", tt.expected, paths, err)
+			}
+			for i := range paths {
+				if paths[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected, paths)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDistributorDefaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		variables     map[string]string
+		expectedPort  int
+		expectedPath  string
+		expectedError bool
+	}{
+		{name: "no variables", expectedPort: 8080, expectedPath: "/"},
+		{name: "distributor variables", variables: map[string]string{"PUBSUB_RECIPIENT_PORT": "9090", "PUBSUB_RECIPIENT_PATH": "/events"}, expectedPort: 9090, expectedPath: "/events"},
+		{name: "explicit variables win", variables: map[string]string{"RCV_PORT": "8080", "RCV_PATH": "/", "PUBSUB_RECIPIENT_PORT": "9090", "PUBSUB_RECIPIENT_PATH": "/events"}, expectedPort: 8080, expectedPath: "/"},
+		{name: "RCV_PATHS wins", variables: map[string]string{"RCV_PATHS": "/a,/b", "PUBSUB_RECIPIENT_PORT": "9090", "PUBSUB_RECIPIENT_PATH": "/events"}, expectedPort: 9090, expectedPath: "/"},
+		{name: "invalid port", variables: map[string]string{"PUBSUB_RECIPIENT_PORT": "http"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := envConfig{Port: 8080, Path: "/"}
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tt.variables[key]
+				return value, ok
+			}
+
+			err := applyDistributorDefaults(&config, lookupEnv)
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got port %d", config.Port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.Port != tt.expectedPort || config.Path != tt.expectedPath {
+				t.Errorf("expected %d%s, got %d%s", tt.expectedPort, tt.expectedPath, config.Port, config.Path)
+			}
+		})
+	}
+}
+
+func TestProcessKeptnCloudEventAllowedSources(t *testing.T) {
+	defer func(sources []string) { env.AllowedSources = sources }(env.AllowedSources)
+
+	tests := []struct {
+		name           string
+		allowedSources []string
+		expectError    bool
+	}{
+		{name: "no allowlist", allowedSources: nil},
+		{name: "allowed source", allowedSources: []string{"shipyard-controller", " test-events"}},
+		{name: "rejected source", allowedSources: []string{"shipyard-controller"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, "exit 0", nil)()
+			env.AllowedSources = tt.allowedSources
+
+			eventSender := &fake.EventSender{}
+			defer func() { keptnOptions.EventSender = nil }()
+			keptnOptions.EventSender = eventSender
+
+			_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = processKeptnCloudEvent(context.Background(), *incomingEvent)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected the event from source test-events to be rejected")
+				}
+				if len(eventSender.SentEvents) != 0 {
+					t.Errorf("expected a rejected event not to be processed, got %d sent events", len(eventSender.SentEvents))
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if len(eventSender.SentEvents) == 0 {
+				t.Errorf("expected the event to be processed")
+			}
+		})
+	}
+}
+
+func TestProcessKeptnCloudEventChecksDataContentType(t *testing.T) {
+	defer func(accepted []string) { env.AcceptedContentTypes = accepted }(env.AcceptedContentTypes)
+
+	tests := []struct {
+		name                 string
+		contentType          string
+		acceptedContentTypes []string
+		expectError          bool
+	}{
+		{name: "no content type", contentType: "", acceptedContentTypes: []string{"application/json"}},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", acceptedContentTypes: []string{"application/json"}},
+		{name: "wrong content type", contentType: "text/plain", acceptedContentTypes: []string{"application/json"}, expectError: true},
+		{name: "json not accepted", contentType: "application/json", acceptedContentTypes: []string{"application/cloudevents+json"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, "exit 0", nil)()
+			env.AcceptedContentTypes = tt.acceptedContentTypes
+
+			eventSender := &fake.EventSender{}
+			defer func() { keptnOptions.EventSender = nil }()
+			keptnOptions.EventSender = eventSender
+
+			_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			incomingEvent.SetDataContentType(tt.contentType)
+
+			err = processKeptnCloudEvent(context.Background(), *incomingEvent)
+			if tt.expectError {
+				if err == nil || !strings.Contains(err.Error(), "data content type") {
+					t.Errorf("expected the event with content type %s to be rejected, got %v", tt.contentType, err)
+				}
+				if len(eventSender.SentEvents) != 0 {
+					t.Errorf("expected a rejected event not to be processed, got %d sent events", len(eventSender.SentEvents))
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if len(eventSender.SentEvents) == 0 {
+				t.Errorf("expected the event to be processed")
+			}
+		})
+	}
+}
+
+func TestProcessKeptnCloudEventRunsRemediationActions(t *testing.T) {
+	defer func(actions map[string]string) { env.RemediationActions = actions }(env.RemediationActions)
+	env.RemediationActions = map[string]string{"disable-alerting": "alerting-off;maintenance-window"}
+
+	tests := []struct {
+		name         string
+		action       string
+		expectMonaco bool
+	}{
+		{name: "mapped action", action: "disable-alerting", expectMonaco: true},
+		{name: "other action", action: "scale", expectMonaco: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, `echo "$@ $KEPTN_ACTION $KEPTN_ACTION_VALUE" >> args.log`, nil)()
+
+			eventSender := &fake.EventSender{}
+			defer func() { keptnOptions.EventSender = nil }()
+			keptnOptions.EventSender = eventSender
+
+			_, incomingEvent, err := initializeTestObjects("test-events/action.triggered.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventData := &keptnv2.ActionTriggeredEventData{}
+			incomingEvent.DataAs(eventData)
+			eventData.Action.Action = tt.action
+			incomingEvent.SetData(cloudevents.ApplicationJSON, eventData)
+
+			if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !tt.expectMonaco {
+				if len(eventSender.SentEvents) != 0 || common.FileExists("args.log") {
+					t.Errorf("expected the action to be left to other action providers")
+				}
+				return
+			}
+			err = eventSender.AssertSentEventTypes([]string{
+				keptnv2.GetStartedEventType(keptnv2.ActionTaskName),
+				keptnv2.GetFinishedEventType(keptnv2.ActionTaskName),
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			args, _ := ioutil.ReadFile("args.log")
+			if !strings.Contains(string(args), `-p=alerting-off, maintenance-window monaco-test/projects disable-alerting {"duration":"30m"}`) {
+				t.Errorf("expected monaco to deploy the projects of the action, got %s", args)
+			}
+		})
+	}
+}
+
+func TestProcessKeptnCloudEventRecoversFromPanic(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	panicking := true
+	defer useMonacoRunner(&fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+		if panicking {
+			var configs map[string]int
+			configs["carts"]++
+		}
+		return MonacoRunResult{}, nil
+	}})()
+
+	for _, expectedResult := range []keptnv2.ResultType{keptnv2.ResultFailed, keptnv2.ResultPass} {
+		eventSender := &fake.EventSender{}
+		keptnOptions.EventSender = eventSender
+
+		_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		keptnOptions.EventSender = nil
+
+		finishedEvent := eventSender.SentEvents[len(eventSender.SentEvents)-1]
+		finishedData := &MonacoFinishedEventData{}
+		finishedEvent.DataAs(finishedData)
+		if finishedEvent.Type() != keptnv2.GetFinishedEventType(MonacoEvent) || finishedData.Result != expectedResult {
+			t.Fatalf("expected a %s event with result %s, got %s with %s: %s", keptnv2.GetFinishedEventType(MonacoEvent), expectedResult, finishedEvent.Type(), finishedData.Result, finishedData.Message)
+		}
+		if expectedResult == keptnv2.ResultFailed && (!strings.Contains(finishedData.Message, "assignment to entry in nil map") || !strings.Contains(finishedData.Message, "goroutine")) {
+			t.Errorf("expected the panic message and stack trace in the finished event, got %s", finishedData.Message)
+		}
+		if finishedData.Monaco.ResultSchemaVersion != MonacoResultSchemaVersion {
+			t.Errorf("expected the result schema version %s, got %q", MonacoResultSchemaVersion, finishedData.Monaco.ResultSchemaVersion)
+		}
+		if len(finishedData.Message) > panicStackLimit+200 {
+			t.Errorf("expected the stack trace to be truncated, got %d characters", len(finishedData.Message))
+		}
+
+		// the service stays alive for the next event
+		panicking = false
+	}
+}
+
+// writeSelfSignedCertificate writes a certificate for 127.0.0.1 and its key to dir and returns their paths and the certificate
+func writeSelfSignedCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "monaco-service"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath, certificate
+}
+
+func TestHTTPProtocolServesTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monaco-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certPath, keyPath, certificate := writeSelfSignedCertificate(t, dir)
+
+	if _, err := newListener(0, certPath, ""); err == nil {
+		t.Error("expected an error if only TLS_CERT_PATH is set")
+	}
+
+	routed := make(chan cloudevents.Event, 1)
+	defer func(handlers map[string]keptnEventHandler) { eventHandlers = handlers }(eventHandlers)
+	eventHandlers = map[string]keptnEventHandler{
+		keptnv2.GetTriggeredEventType(MonacoEvent): func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			routed <- event
+			return nil
+		},
+	}
+
+	listener, err := newListener(0, certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newHTTPProtocol(cehttp.WithListener(listener), []string{"/"}, http.NewServeMux())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cloudevents.NewClient(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.StartReceiver(cloudevents.WithEncodingStructured(ctx), processKeptnCloudEvent)
+
+	triggeredEvent, err := ioutil.ReadFile(filepath.Join(testRootDir, "test-events/monaco.triggered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	url := fmt.Sprintf("https://127.0.0.1:%d/", port)
+
+	// plain HTTP is not served
+	if resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/", port), "application/cloudevents+json", bytes.NewReader(triggeredEvent)); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 400 {
+			t.Errorf("expected plain HTTP to be rejected, got %d", resp.StatusCode)
+		}
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(certificate)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	resp, err := client.Post(url, "application/cloudevents+json", bytes.NewReader(triggeredEvent))
+	if err != nil {
+		t.Fatalf("could not post via HTTPS: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-routed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event posted via HTTPS was not routed to its handler")
+	}
+}
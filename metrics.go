@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// label value used for projects and environments that are not part of the metrics allowlist
+const metricsOtherLabelValue = "other"
+
+var (
+	deploymentsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "monaco_deployments_total",
+		Help: "Number of monaco deployments by project, Dynatrace environment and result",
+	}, []string{"project", "dynatrace_environment", "result"})
+
+	deploymentDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "monaco_deployment_duration_seconds",
+		Help:    "Duration of monaco deployments by project and Dynatrace environment",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	}, []string{"project", "dynatrace_environment"})
+
+	deploymentOutcomesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "monaco_deployment_outcomes_total",
+		Help: "Number of successful monaco deployments by project, Dynatrace environment and outcome (deployed or no-changes)",
+	}, []string{"project", "dynatrace_environment", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(deploymentsTotal, deploymentDuration, deploymentOutcomesTotal)
+}
+
+/**
+ * Bounds the label cardinality: values that are not in the (comma separated) allowlist are recorded as "other".
+ * An empty allowlist allows all values.
+ */
+func getAllowedLabelValue(value string, allowlist []string) string {
+	if len(allowlist) == 0 {
+		return value
+	}
+	for _, allowed := range allowlist {
+		if strings.TrimSpace(allowed) == value {
+			return value
+		}
+	}
+	return metricsOtherLabelValue
+}
+
+// getDynatraceEnvironmentName returns the host of the tenant URL, e.g., abc12345.live.dynatrace.com
+func getDynatraceEnvironmentName(tenant string) string {
+	tenantURL, err := url.Parse(tenant)
+	if err != nil || tenantURL.Host == "" {
+		return tenant
+	}
+	return tenantURL.Host
+}
+
+// prometheusExporter records deployments as the metrics served on /metrics
+type prometheusExporter struct{}
+
+func (prometheusExporter) Name() string {
+	return "metrics"
+}
+
+func (prometheusExporter) Export(ctx context.Context, telemetry deploymentTelemetry) error {
+	if err := recordDeploymentMetrics(telemetry.Project, telemetry.Tenant, telemetry.Result, telemetry.Duration); err != nil {
+		return err
+	}
+	if telemetry.Outcome == "" {
+		return nil
+	}
+	return recordDeploymentOutcome(telemetry.Project, telemetry.Tenant, telemetry.Outcome)
+}
+
+func recordDeploymentMetrics(project string, tenant string, result string, duration time.Duration) error {
+	project = getAllowedLabelValue(project, env.MetricsProjects)
+	environment := getAllowedLabelValue(getDynatraceEnvironmentName(tenant), env.MetricsEnvironments)
+
+	counter, err := deploymentsTotal.GetMetricWithLabelValues(project, environment, result)
+	if err != nil {
+		return err
+	}
+	histogram, err := deploymentDuration.GetMetricWithLabelValues(project, environment)
+	if err != nil {
+		return err
+	}
+	counter.Inc()
+	histogram.Observe(duration.Seconds())
+	return nil
+}
+
+func recordDeploymentOutcome(project string, tenant string, outcome string) error {
+	project = getAllowedLabelValue(project, env.MetricsProjects)
+	environment := getAllowedLabelValue(getDynatraceEnvironmentName(tenant), env.MetricsEnvironments)
+
+	counter, err := deploymentOutcomesTotal.GetMetricWithLabelValues(project, environment, outcome)
+	if err != nil {
+		return err
+	}
+	counter.Inc()
+	return nil
+}
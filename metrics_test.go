@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeploymentMetricsAreLabeledByProjectAndEnvironment(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+	deploymentsTotal.Reset()
+	deploymentDuration.Reset()
+
+	runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+
+	count := testutil.ToFloat64(deploymentsTotal.WithLabelValues("sockshop", "abc12345.live.dynatrace.com", string(keptnv2.ResultPass)))
+	if count != 1 {
+		t.Errorf("expected 1 labeled deployment, got %v", count)
+	}
+	if observations := testutil.CollectAndCount(deploymentDuration); observations != 1 {
+		t.Errorf("expected 1 duration series, got %d", observations)
+	}
+}
+
+func TestDeploymentMetricsRespectAllowlist(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 1", nil)()
+	defer func(projects, environments []string) {
+		env.MetricsProjects, env.MetricsEnvironments = projects, environments
+	}(env.MetricsProjects, env.MetricsEnvironments)
+	env.MetricsProjects = []string{"carts-project"}
+	env.MetricsEnvironments = []string{"abc12345.live.dynatrace.com"}
+	deploymentsTotal.Reset()
+
+	runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+
+	count := testutil.ToFloat64(deploymentsTotal.WithLabelValues(metricsOtherLabelValue, "abc12345.live.dynatrace.com", string(keptnv2.ResultFailed)))
+	if count != 1 {
+		t.Errorf("expected the project outside the allowlist to be recorded as %s, got %v", metricsOtherLabelValue, count)
+	}
+	if series := testutil.CollectAndCount(deploymentsTotal); series != 1 {
+		t.Errorf("expected exactly 1 series, got %d", series)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const mockDynatraceToken = "dt0c01.TESTTOKEN"
+
+/**
+ * mockDynatrace emulates the parts of the Dynatrace configuration API monaco uses:
+ * - GET  /api/config/v1/<api>            lists the configs of an API
+ * - GET  /api/config/v1/<api>/<id>       returns a config, 404 if it doesn't exist
+ * - POST /api/config/v1/<api>            creates a config and returns its id
+ * - PUT  /api/config/v1/<api>/<id>       updates a config
+ * - POST /api/config/v1/<api>/validator  validates a config without storing it (monaco dry run)
+ * - GET  /api/v1/config/clusterversion   returns the version of the environment
+ * - GET  /api/v2/metrics/query           returns the value of a metric selector over the whole timeframe
+ * All requests need the header "Authorization: Api-Token dt0c01.TESTTOKEN".
+ */
+type mockDynatrace struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	configs map[string]map[string]string // api -> id -> name
+	metrics map[string]float64           // metric selector -> value
+}
+
+type mockDynatraceConfig struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// startMockDynatrace starts a mock Dynatrace environment, its URL is used as DT_TENANT. Close it when done.
+func startMockDynatrace(t *testing.T) *mockDynatrace {
+	mock := &mockDynatrace{configs: map[string]map[string]string{}, metrics: map[string]float64{}}
+	mock.Server = httptest.NewServer(http.HandlerFunc(mock.handle))
+	return mock
+}
+
+// addConfig stores a config as if it had been created before
+func (m *mockDynatrace) addConfig(api string, id string, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.configs[api] == nil {
+		m.configs[api] = map[string]string{}
+	}
+	m.configs[api][id] = name
+}
+
+// addMetric makes the metrics API return value for metricSelector
+func (m *mockDynatrace) addMetric(metricSelector string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.metrics[metricSelector] = value
+}
+
+// getConfigNames returns the names of all configs stored for api
+func (m *mockDynatrace) getConfigNames(api string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for _, name := range m.configs[api] {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (m *mockDynatrace) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Api-Token "+mockDynatraceToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/api/v1/config/clusterversion" {
+		json.NewEncoder(w).Encode(map[string]string{"version": "1.210.0"})
+		return
+	}
+
+	if r.URL.Path == "/api/v2/metrics/query" {
+		metricSelector := r.URL.Query().Get("metricSelector")
+		value, ok := m.metrics[metricSelector]
+		if !ok || r.URL.Query().Get("resolution") != "Inf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": []interface{}{map[string]interface{}{
+				"metricId": metricSelector,
+				"data":     []interface{}{map[string]interface{}{"values": []float64{value}}},
+			}},
+		})
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/api/config/v1/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/config/v1/"), "/")
+	api := segments[0]
+	if m.configs[api] == nil {
+		m.configs[api] = map[string]string{}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 1:
+		values := []mockDynatraceConfig{}
+		for id, name := range m.configs[api] {
+			values = append(values, mockDynatraceConfig{ID: id, Name: name})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+	case r.Method == http.MethodGet && len(segments) == 2:
+		name, ok := m.configs[api][segments[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(mockDynatraceConfig{ID: segments[1], Name: name})
+	case r.Method == http.MethodPost && len(segments) == 2 && segments[1] == "validator":
+		w.WriteHeader(http.StatusNoContent)
+	case (r.Method == http.MethodPost && len(segments) == 1) || (r.Method == http.MethodPut && len(segments) == 2):
+		config := mockDynatraceConfig{}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil || config.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		config.ID = fmt.Sprintf("%s-%d", api, len(m.configs[api])+1)
+		if len(segments) == 2 {
+			config.ID = segments[1]
+		}
+		m.configs[api][config.ID] = config.Name
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(config)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+/**
+ * monaco stub talking to the mock like monaco v1 does for an auto-tag named after the Keptn project:
+ * it lists the existing auto-tags, then validates (dry run, -d) or creates the auto-tag
+ */
+const mockMonacoScript = `auth="Authorization: Api-Token $DT_API_TOKEN"
+api="$DT_ENVIRONMENT_URL/api/config/v1/autoTags"
+curl -sf -H "$auth" "$api" > /dev/null || exit 1
+case " $* " in
+  *" -d "*) curl -sf -X POST -H "$auth" -H "Content-Type: application/json" -d "{\"name\":\"$KEPTN_PROJECT\"}" "$api/validator" || exit 1 ;;
+  *) curl -sf -X POST -H "$auth" -H "Content-Type: application/json" -d "{\"name\":\"$KEPTN_PROJECT\"}" "$api" || exit 1 ;;
+esac`
+
+func TestHandleMonacoTriggeredEventAgainstMockDynatrace(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("the monaco stub needs curl")
+	}
+
+	tests := []struct {
+		name           string
+		apiToken       string
+		expectedResult keptnv2.ResultType
+		expectedTags   int
+	}{
+		{name: "success", apiToken: mockDynatraceToken, expectedResult: keptnv2.ResultPass, expectedTags: 1},
+		{name: "invalid token", apiToken: "dt0c01.INVALID", expectedResult: keptnv2.ResultFailed, expectedTags: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := startMockDynatrace(t)
+			defer mock.Close()
+
+			defer setupTestWorkDir(t, mockMonacoScript, nil)()
+			os.Setenv("DT_TENANT", mock.URL)
+			os.Setenv("DT_API_TOKEN", tt.apiToken)
+
+			myKeptn, _ := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+
+			finishedData := getFinishedEventData(t, myKeptn)
+			if finishedData.Result != tt.expectedResult {
+				t.Errorf("expected result %s, got %s: %s", tt.expectedResult, finishedData.Result, finishedData.Message)
+			}
+
+			tags := mock.getConfigNames("autoTags")
+			if len(tags) != tt.expectedTags {
+				t.Errorf("expected %d auto-tags to be created, got %v", tt.expectedTags, tags)
+			}
+			if len(tags) > 0 && tags[0] != "sockshop" {
+				t.Errorf("expected the auto-tag to be named after the project, got %s", tags[0])
+			}
+		})
+	}
+}
+
+func TestHandleMonacoTriggeredEventVerifiesDeployedConfigs(t *testing.T) {
+	output := "Upserted config carts of api auto-tag with id tag-1\nUpserted config sockshop of api management-zone with id zone-1\n"
+
+	tests := []struct {
+		name            string
+		existingConfigs map[string]string
+		expectedResult  keptnv2.ResultType
+		expectedMissing []string
+	}{
+		{name: "all configs exist", existingConfigs: map[string]string{"autoTags": "tag-1", "managementZones": "zone-1"}, expectedResult: keptnv2.ResultPass},
+		{name: "config missing", existingConfigs: map[string]string{"autoTags": "tag-1"}, expectedResult: keptnv2.ResultFailed, expectedMissing: []string{"management-zone/zone-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := startMockDynatrace(t)
+			defer mock.Close()
+			for api, id := range tt.existingConfigs {
+				mock.addConfig(api, id, id)
+			}
+
+			defer setupTestWorkDir(t, "", nil)()
+			os.Setenv("DT_TENANT", mock.URL)
+			defer useMonacoRunner(&fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+				return MonacoRunResult{Output: output}, nil
+			}})()
+
+			myKeptn, _ := runMonacoTriggeredEventWithLabels(t, map[string]string{verifyLabel: "true"})
+
+			finishedData := getFinishedEventData(t, myKeptn)
+			if finishedData.Result != tt.expectedResult {
+				t.Errorf("expected result %s, got %s: %s", tt.expectedResult, finishedData.Result, finishedData.Message)
+			}
+			verification := finishedData.Monaco.Verification
+			if verification == nil {
+				t.Fatalf("expected the verification to be reported")
+			}
+			if verification.Verified != len(tt.existingConfigs) || strings.Join(verification.Missing, ",") != strings.Join(tt.expectedMissing, ",") {
+				t.Errorf("expected %d verified and %v missing configs, got %+v", len(tt.existingConfigs), tt.expectedMissing, verification)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	cenats "github.com/cloudevents/sdk-go/protocol/nats/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// Supported transports for receiving CloudEvents
+const transportHTTP = "http"
+const transportNATS = "nats"
+
+/**
+ * Connects to the NATS server at natsURL (e.g., nats://keptn-nats-cluster:4222) and returns the consumer of the
+ * CloudEvents published on subject, it is passed to cloudevents.NewClient like the HTTP protocol
+ */
+func newNATSConsumer(natsURL string, subject string) (*cenats.Consumer, error) {
+	parsedURL, err := url.Parse(natsURL)
+	if err != nil || parsedURL.Scheme != "nats" || parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL '%s', expected nats://host[:port]", natsURL)
+	}
+
+	consumer, err := cenats.NewConsumer(natsURL, subject, cenats.NatsOptions(nats.Name(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to NATS: %v", err)
+	}
+	return consumer, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+/**
+ * startNATSServer runs an embedded NATS server on a random port, the returned function shuts it down
+ */
+func startNATSServer(t *testing.T) (*server.Server, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("the NATS server did not start")
+	}
+	return s, s.Shutdown
+}
+
+func TestNATSConsumerReceivesAndRoutesEvents(t *testing.T) {
+	triggeredEvent, err := ioutil.ReadFile(filepath.Join(testRootDir, "test-events/monaco.triggered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, shutdown := startNATSServer(t)
+	defer shutdown()
+
+	// route monaco.triggered to a handler recording the events
+	routed := make(chan cloudevents.Event, 1)
+	defer func(handlers map[string]keptnEventHandler) { eventHandlers = handlers }(eventHandlers)
+	eventHandlers = map[string]keptnEventHandler{
+		keptnv2.GetTriggeredEventType(MonacoEvent): func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			routed <- event
+			return nil
+		},
+	}
+
+	consumer, err := newNATSConsumer(s.ClientURL(), "sh.keptn.>")
+	if err != nil {
+		t.Fatalf("could not connect to the NATS server: %v", err)
+	}
+	c, err := cloudevents.NewClient(consumer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.StartReceiver(ctx, processKeptnCloudEvent)
+
+	// the consumer subscribes once the receiver is started
+	for start := time.Now(); s.NumSubscriptions() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("expected a subscription to sh.keptn.>")
+		}
+	}
+
+	publisher, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	publisher.Publish("sh.keptn.event.monaco.triggered", []byte("not a cloudevent"))
+	publisher.Publish("sh.keptn.event.monaco.triggered", triggeredEvent)
+	publisher.Flush()
+
+	select {
+	case event := <-routed:
+		if event.Type() != keptnv2.GetTriggeredEventType(MonacoEvent) || event.ID() != "f2b878d3-03c0-4e8f-bc3f-454bc1b3d79b" {
+			t.Errorf("expected the monaco.triggered test event, got %s %s", event.Type(), event.ID())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event published on NATS was not routed to its handler")
+	}
+}
+
+func TestNewNATSConsumerInvalidURL(t *testing.T) {
+	if _, err := newNATSConsumer("http://keptn-nats-cluster", "sh.keptn.>"); err == nil {
+		t.Errorf("expected an error for a non-nats URL")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// label of the .finished event holding the redacted monaco output, see ATTACH_OUTPUT
+const monacoOutputLabel = "monaco.output"
+
+// label of the .finished event referencing the file with the monaco output if it exceeds MAX_LABEL_SIZE
+const monacoOutputFileLabel = "monaco.outputFile"
+
+// characters of the Keptn context and stage that are not used in the names of the output files
+var outputFileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+/**
+ * Adds the redacted monaco output to the labels of the .finished event. Output longer than MAX_LABEL_SIZE bytes would
+ * be dropped by Keptn, it is written to <OUTPUT_DIR>/<keptncontext>-<stage>.log instead and the label
+ * monaco.outputFile references that file. MAX_LABEL_SIZE 0 never writes a file.
+ */
+func setMonacoOutputLabel(myKeptn *keptnv2.Keptn, finishedData *keptnv2.EventData, output string) error {
+	if output == "" {
+		return nil
+	}
+	if finishedData.Labels == nil {
+		finishedData.Labels = map[string]string{}
+	}
+	if env.MaxLabelSize <= 0 || len(output) <= env.MaxLabelSize {
+		finishedData.Labels[monacoOutputLabel] = output
+		return nil
+	}
+
+	outputPath, err := writeMonacoOutputFile(env.OutputDir, myKeptn.KeptnContext, myKeptn.Event.GetStage(), output)
+	if err != nil {
+		return err
+	}
+	finishedData.Labels[monacoOutputFileLabel] = outputPath
+	return nil
+}
+
+// writeMonacoOutputFile stores the output of a run in outputDir and returns the path of the file
+func writeMonacoOutputFile(outputDir string, keptnContext string, stage string, output string) (string, error) {
+	if err := os.MkdirAll(outputDir, common.WorkDirPermissions); err != nil {
+		return "", fmt.Errorf("could not create %s: %v", outputDir, err)
+	}
+	fileName := outputFileNameUnsafe.ReplaceAllString(keptnContext+"-"+stage, "_") + ".log"
+	outputPath := filepath.Join(outputDir, fileName)
+	if err := ioutil.WriteFile(outputPath, []byte(output), common.WorkFilePermissions); err != nil {
+		return "", fmt.Errorf("could not write the monaco output to %s: %v", outputPath, err)
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+const monacoTestOutput = "INFO Deploying config auto-tag/tagging\nINFO Deployment finished without errors"
+
+func TestHandleMonacoTriggeredEventWritesOversizedOutputToFile(t *testing.T) {
+	defer setupTestWorkDir(t, "echo '"+monacoTestOutput+"'", nil)()
+	defer func(attach bool, maxSize int) { env.AttachOutput, env.MaxLabelSize = attach, maxSize }(env.AttachOutput, env.MaxLabelSize)
+	env.AttachOutput = true
+	env.MaxLabelSize = 16
+
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	labels := getFinishedEventData(t, myKeptn).Labels
+	if _, ok := labels[monacoOutputLabel]; ok {
+		t.Errorf("expected the oversized output not to be put into the label %s", monacoOutputLabel)
+	}
+	outputPath := labels[monacoOutputFileLabel]
+	if filepath.Dir(outputPath) != filepath.Clean(env.OutputDir) || !strings.HasSuffix(outputPath, "-dev.log") {
+		t.Fatalf("expected the label %s to reference a file in %s, got '%s'", monacoOutputFileLabel, env.OutputDir, outputPath)
+	}
+	content, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("expected the output file to be written: %v", err)
+	}
+	if !strings.Contains(string(content), monacoTestOutput) {
+		t.Errorf("expected the file to contain the full output, got %s", content)
+	}
+}
+
+func TestHandleMonacoTriggeredEventPutsOutputIntoLabel(t *testing.T) {
+	defer setupTestWorkDir(t, "echo '"+monacoTestOutput+"'", nil)()
+	defer func(attach bool) { env.AttachOutput = attach }(env.AttachOutput)
+	env.AttachOutput = true
+
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	labels := getFinishedEventData(t, myKeptn).Labels
+	if !strings.Contains(labels[monacoOutputLabel], monacoTestOutput) {
+		t.Errorf("expected the output in the label %s, got '%s'", monacoOutputLabel, labels[monacoOutputLabel])
+	}
+	if _, ok := labels[monacoOutputFileLabel]; ok {
+		t.Errorf("expected no output file for output below MAX_LABEL_SIZE")
+	}
+}
+
+func TestReapMonacoOutputFiles(t *testing.T) {
+	outputDir, _ := ioutil.TempDir("", "monaco-service-output")
+	defer os.RemoveAll(outputDir)
+
+	now := time.Now()
+	oldOutput, err := writeMonacoOutputFile(outputDir, "old-context", "dev", monacoTestOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newOutput, err := writeMonacoOutputFile(outputDir, "new-context", "dev", monacoTestOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(oldOutput, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+
+	if reaped := reapFiles(outputDir, 24*time.Hour, now); reaped != 1 {
+		t.Errorf("expected 1 reaped output file, got %d", reaped)
+	}
+	if common.FileExists(oldOutput) {
+		t.Errorf("expected %s to be removed", oldOutput)
+	}
+	if !common.FileExists(newOutput) {
+		t.Errorf("expected %s to be kept", newOutput)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// projectGroupDeployment is the outcome of deploying one group of independent monaco projects
+type projectGroupDeployment struct {
+	projects string
+	output   string
+	err      *MonacoError
+}
+
+/**
+ * Deploys each group of projects with its own monaco run, at most parallelism runs at a time (MAX_PARALLEL_DEPLOYMENTS).
+ * The outputs are concatenated in the order of the groups, failed groups are reported in that order as well.
+ */
+func callMonacoInParallel(runCtx context.Context, logger Logger, runner MonacoRunner, dtCredentials *common.DTCredentials, keptnEvent *common.BaseKeptnEvent, options common.MonacoCommandOptions, status *statusReporter, groups [][]string, parallelism int) (string, *MonacoError) {
+	deployments := make([]projectGroupDeployment, len(groups))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, projects string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			groupOptions := options
+			groupOptions.Projects = projects
+			output, monacoErr := callMonaco(runCtx, logger, runner, dtCredentials, keptnEvent, groupOptions, status)
+			deployments[i] = projectGroupDeployment{projects: projects, output: output, err: monacoErr}
+		}(i, strings.Join(group, ", "))
+	}
+	wg.Wait()
+
+	outputs := []string{}
+	failures := []string{}
+	failedOutputs := []string{}
+	var firstErr *MonacoError
+	for _, deployment := range deployments {
+		if deployment.output != "" {
+			outputs = append(outputs, deployment.output)
+		}
+		if deployment.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", deployment.projects, deployment.err.Err))
+			failedOutputs = append(failedOutputs, deployment.err.Output)
+			if firstErr == nil {
+				firstErr = deployment.err
+			}
+		}
+	}
+
+	output := strings.Join(outputs, "\n")
+	if firstErr != nil {
+		monacoErr := newMonacoError(firstErr.Kind, "%d of %d project deployments failed: %s", len(failures), len(deployments), strings.Join(failures, "; "))
+		monacoErr.ExitCode = firstErr.ExitCode
+		monacoErr.Output = strings.Join(failedOutputs, "\n")
+		return output, monacoErr
+	}
+	return output, nil
+}
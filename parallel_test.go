@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+func TestHandleMonacoTriggeredEventDeploysIndependentProjectsInParallel(t *testing.T) {
+	files := map[string]string{"dynatrace/monaco.conf.yaml": "projects:\n  - a\n  - b\n  - c\n  - d\n"}
+	for _, project := range []string{"a", "b", "c", "d"} {
+		files["monaco-test/projects/"+project+"/auto-tag/auto-tag.yaml"] = "config:\n  - tag: \"tag.json\"\n"
+	}
+	defer func(parallelism int) { env.MaxParallelDeployments = parallelism }(env.MaxParallelDeployments)
+	env.MaxParallelDeployments = 2
+
+	tests := []struct {
+		name            string
+		failing         map[string]bool
+		expectedResult  keptnv2.ResultType
+		expectedMessage string
+	}{
+		{
+			name:            "all projects deployed",
+			expectedResult:  keptnv2.ResultPass,
+			expectedMessage: "Successfully ran monaco for the projects a, b, c, d in 4 parallel deployments!",
+		},
+		{
+			name:            "some projects failed",
+			failing:         map[string]bool{"c": true, "a": true},
+			expectedResult:  keptnv2.ResultFailed,
+			expectedMessage: "Monaco failed: 2 of 4 project deployments failed: a: monaco deployment failed: a is broken; c: monaco deployment failed: c is broken",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, "", files)()
+
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			deployed := []string{}
+			runner := &fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				running--
+				if !args.Options.DryRun {
+					deployed = append(deployed, args.Options.Projects)
+				}
+				mu.Unlock()
+
+				if !args.Options.DryRun && tt.failing[args.Options.Projects] {
+					return MonacoRunResult{Output: "Deployment of " + args.Options.Projects + " failed"}, errors.New(args.Options.Projects + " is broken")
+				}
+				return MonacoRunResult{Output: "Deployed " + args.Options.Projects}, nil
+			}}
+			defer useMonacoRunner(runner)()
+
+			myKeptn, _ := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+
+			if len(deployed) != 4 {
+				t.Errorf("expected one deployment per project, got %v", deployed)
+			}
+			if maxRunning != 2 {
+				t.Errorf("expected 2 monaco runs at a time, got %d", maxRunning)
+			}
+			finishedData := getFinishedEventData(t, myKeptn)
+			if finishedData.Result != tt.expectedResult {
+				t.Errorf("expected result %s, got %s", tt.expectedResult, finishedData.Result)
+			}
+			if finishedData.Message != tt.expectedMessage {
+				t.Errorf("expected message %q, got %q", tt.expectedMessage, finishedData.Message)
+			}
+		})
+	}
+}
+
+func TestCallMonacoInParallelConcatenatesOutputsInOrder(t *testing.T) {
+	runner := &fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+		// the first group finishes last
+		if strings.HasPrefix(args.Options.Projects, "a") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return MonacoRunResult{Output: "Deployed " + args.Options.Projects}, nil
+	}}
+
+	output, monacoErr := callMonacoInParallel(context.Background(), &recordingLogger{}, runner, &common.DTCredentials{}, &common.BaseKeptnEvent{}, common.MonacoCommandOptions{}, nil, [][]string{{"a", "shared"}, {"b"}, {"c"}}, 3)
+	if monacoErr != nil {
+		t.Fatalf("unexpected error: %v", monacoErr)
+	}
+	if expected := "Deployed a, shared\nDeployed b\nDeployed c"; output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Keys of the secret holding the credentials of a Dynatrace account, monaco reads them from the environment variables
+// of the same name referenced by the accounts of manifest.yaml
+const AccountUUIDKey = "ACCOUNT_UUID"
+const AccountClientIDKey = "OAUTH_CLIENT_ID"
+const AccountClientSecretKey = "OAUTH_CLIENT_SECRET"
+
+// top level keys of monaco account resource files, e.g., users: or policies:
+var accountResourceKeys = []string{"users", "groups", "policies", "serviceUsers"}
+
+// ErrNoAccountConfigs is returned when an account deployment doesn't find account resources in the monaco files
+var ErrNoAccountConfigs = errors.New("no account configs found")
+
+// AccountCredentials authenticate monaco account deployments via OAuth
+type AccountCredentials struct {
+	AccountUUID  string
+	ClientID     string
+	ClientSecret string
+}
+
+/**
+ * Pulls the credentials of the Dynatrace account from the passed secret, or from the environment variables of the
+ * same name when running locally
+ */
+func GetAccountCredentials(secretName string) (*AccountCredentials, error) {
+	accountCreds := &AccountCredentials{}
+	if RunLocal || RunLocalTest {
+		accountCreds.AccountUUID = os.Getenv(AccountUUIDKey)
+		accountCreds.ClientID = os.Getenv(AccountClientIDKey)
+		accountCreds.ClientSecret = os.Getenv(AccountClientSecretKey)
+	} else {
+		kubeAPI, err := GetKubernetesClient()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving account credentials: could not initialize Kubernetes client: %v", err)
+		}
+		secret, err := kubeAPI.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving account credentials: could not retrieve secret %s: %v", secretName, err)
+		}
+
+		accountCreds.AccountUUID = string(secret.Data[AccountUUIDKey])
+		accountCreds.ClientID = string(secret.Data[AccountClientIDKey])
+		accountCreds.ClientSecret = string(secret.Data[AccountClientSecretKey])
+	}
+
+	if accountCreds.AccountUUID == "" || accountCreds.ClientID == "" || accountCreds.ClientSecret == "" {
+		return nil, fmt.Errorf("invalid or no account credentials found. Need %s, %s & %s stored in secret %s", AccountUUIDKey, AccountClientIDKey, AccountClientSecretKey, secretName)
+	}
+	return accountCreds, nil
+}
+
+/**
+ * Returns the yaml files below folder that define account resources (users, groups, policies or service users),
+ * relative to folder. Returns ErrNoAccountConfigs if there are none.
+ */
+func FindAccountConfigs(folder string) ([]string, error) {
+	configs := []string{}
+	if !FileExists(folder) {
+		return nil, fmt.Errorf("%w in %s", ErrNoAccountConfigs, folder)
+	}
+
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := filepath.Ext(path)
+		if info.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var parsed map[string]interface{}
+		if yaml.Unmarshal(content, &parsed) != nil {
+			// reported by ValidateMonacoYAML
+			return nil
+		}
+		for _, key := range accountResourceKeys {
+			if _, ok := parsed[key]; ok {
+				relativePath, _ := filepath.Rel(folder, path)
+				configs = append(configs, relativePath)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%w in %s, account configs define %v", ErrNoAccountConfigs, folder, accountResourceKeys)
+	}
+	sort.Strings(configs)
+	return configs, nil
+}
+
+// Secret returns the OAuth client secret that has to be redacted from the monaco output, empty without an account
+func (c *AccountCredentials) Secret() string {
+	if c == nil {
+		return ""
+	}
+	return c.ClientSecret
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+/**
+ * Overlays the monaco folder of the event with the shared monaco files of the base directories, e.g., monaco-common
+ * with configs used by all services (BASE_CONFIG_DIRS). The directories have the layout of the monaco folder (the
+ * projects folder and, for monaco v2, the manifest.yaml) and may contain the Keptn placeholders, e.g., $PROJECT.
+ * Files of the project take precedence over those of the base directories, later base directories take precedence
+ * over earlier ones. Base directories that don't exist are skipped.
+ */
+func MergeBaseConfigDirs(keptnEvent *BaseKeptnEvent, baseDirs []string) error {
+	monacoFolder := GetMonacoFolder(keptnEvent)
+	// files are only copied if they don't exist yet, so the directory with the highest precedence goes first
+	for i := len(baseDirs) - 1; i >= 0; i-- {
+		baseDir := ReplaceKeptnPlaceholders(strings.TrimSpace(baseDirs[i]), keptnEvent)
+		if baseDir == "" {
+			continue
+		}
+		if info, err := os.Stat(baseDir); err != nil || !info.IsDir() {
+			log.Printf("Skipping base config directory %s, it doesn't exist", baseDir)
+			continue
+		}
+		if err := copyMountedDir(baseDir, monacoFolder, false); err != nil {
+			return err
+		}
+		log.Printf("Merged base config directory %s into %s", baseDir, monacoFolder)
+	}
+	return nil
+}
@@ -2,21 +2,23 @@ package common
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	keptnmodels "github.com/keptn/go-utils/pkg/api/models"
-	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 	"gopkg.in/yaml.v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -35,15 +37,88 @@ const MonacoBaseFolder = "tmp/monaco/"
 const MonacoProjectsSubfolder = "projects"
 const MonacoExecutable = "./monaco"
 
+// Permissions of the folders and files of the work directory, only the service itself may read fetched configs
+const WorkDirPermissions os.FileMode = 0700
+const WorkFilePermissions os.FileMode = 0600
+
+// IsolateTenants additionally namespaces the temp folders of runs by Dynatrace environment, see WORK_DIR_PER_TENANT
+var IsolateTenants = false
+
+// Supported ways of handing the Dynatrace API token over to monaco
+const TokenDeliveryEnv = "env"
+const TokenDeliveryFile = "file"
+
+// Supported monaco CLIs: v1 uses environments.yaml and a projects folder, v2 deploys a manifest.yaml
+const MonacoCLIVersion1 = "v1"
+const MonacoCLIVersion2 = "v2"
+const MonacoManifestFilename = "manifest.yaml"
+
+// MonacoCommandOptions control how monaco gets invoked
+type MonacoCommandOptions struct {
+	Projects      string
+	Verbose       bool
+	DryRun        bool
+	TokenDelivery string
+	CLIVersion    string
+	ManifestPath  string
+	// v1 only: environments file passed to monaco, defaults to MonacoEnvironmentsFile
+	EnvironmentsFile string
+	// deploy all configs that can be deployed instead of aborting on the first failure
+	ContinueOnError bool
+	// v2 only: environment group or comma separated environments of the manifest to deploy to, at most one of them is set
+	Group       string
+	Environment string
+	// URL or directory of the mirror monaco downloads API schemas from, passed as MONACO_SCHEMA_MIRROR
+	SchemaMirror string
+	// optional destination for the command and output of the run
+	Log io.Writer
+	// additional environment variables for monaco templates, the variables set by the service take precedence
+	Env map[string]string
+	// variables set by the service that are explicitly overridden, they take precedence over all other variables
+	EnvOverride map[string]string
+	// OS user and group monaco runs as, nil runs it as the user of the monaco-service
+	User *MonacoUser
+	// output matching one of the patterns is redacted, just like the Dynatrace API token, before it is logged or returned
+	SecretPatterns []SecretPattern
+	// v2 only: deploys the account resources of the manifest with monaco account deploy, nil deploys to environments
+	Account *AccountCredentials
+	// monaco executable of a pinned release, empty runs MonacoExecutable
+	Executable string
+	// deletes the configs listed in the delete file instead of deploying the projects, see PrepareDeleteFiles
+	DeleteFile string
+	// v2 only: downloads the configs of Environment into the folder instead of deploying the projects
+	ExportDir string
+}
+
+// environmentArgs returns a --environment flag per comma separated environment
+func environmentArgs(environments string) []string {
+	args := []string{}
+	for _, environment := range strings.Split(environments, ",") {
+		if environment = strings.TrimSpace(environment); environment != "" {
+			args = append(args, "--environment="+environment)
+		}
+	}
+	return args
+}
+
+// ErrInvalidMonacoConfig is returned when monaco.conf.yaml exists but cannot be parsed
+var ErrInvalidMonacoConfig = errors.New("invalid monaco.conf.yaml")
+
 type MonacoConfigFile struct {
 	SpecVersion string   `json:"spec_version" yaml:"spec_version"`
 	DtCreds     string   `json:"dtCreds,omitempty" yaml:"dtCreds,omitempty"`
 	Projects    []string `json:"projects,omitempty" yaml:"projects,omitempty"`
+	// Dynatrace API types (e.g., dashboard) that are deployed, configs of other types are skipped; empty deploys all
+	AllowedTypes []string `json:"allowedTypes,omitempty" yaml:"allowedTypes,omitempty"`
 }
 
 type DTCredentials struct {
 	Tenant   string `json:"DT_TENANT" yaml:"DT_TENANT"`
 	ApiToken string `json:"DT_API_TOKEN" yaml:"DT_API_TOKEN"`
+	// optional size of the environment (e.g., small, large) used to limit the parallel deployments to it
+	Tier string `json:"DT_TIER" yaml:"DT_TIER"`
+	// optional path of the environment below DT_TENANT, e.g., /e/<environment-id> on Dynatrace Managed clusters
+	ApiBasePath string `json:"DT_API_BASE_PATH,omitempty" yaml:"DT_API_BASE_PATH,omitempty"`
 }
 
 type BaseKeptnEvent struct {
@@ -62,8 +137,23 @@ type BaseKeptnEvent struct {
 	Tag   string
 
 	Labels map[string]string
+
+	// git branch or tag the monaco files are fetched from, empty for the default branch
+	ConfigRef string
+
+	// Dynatrace environment the run deploys to, set once the credentials are known
+	Tenant string
+
+	// git commit the resources were fetched from, LocalCommit when running locally
+	Commit string
+
+	// team of the team CloudEvent extension, its monaco files are read from TeamsSubfolder
+	Team string
 }
 
+// LocalCommit is reported as commit of resources read from the local filesystem
+const LocalCommit = "local"
+
 var namespace = getPodNamespace()
 
 func getPodNamespace() string {
@@ -145,8 +235,9 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 		}
 		log.Printf("Loaded LOCAL file " + resourceURI)
 		fileContent = string(localFileContent)
+		keptnEvent.Commit = LocalCommit
 	} else {
-		resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
+		resourceHandler := newResourceHandler(keptnEvent.ConfigRef)
 
 		// Lets search on SERVICE-LEVEL
 		keptnResourceContent, err := resourceHandler.GetServiceResource(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, resourceURI)
@@ -169,6 +260,9 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 			log.Printf("Found " + resourceURI + " on service level")
 		}
 		fileContent = keptnResourceContent.ResourceContent
+		if keptnResourceContent.Metadata != nil && keptnResourceContent.Metadata.Version != "" {
+			keptnEvent.Commit = keptnResourceContent.Metadata.Version
+		}
 	}
 
 	return fileContent, nil
@@ -177,7 +271,7 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 // GetMonacoConfig loads monaco.conf for the current service
 func GetMonacoConfig(keptnEvent *BaseKeptnEvent) (*MonacoConfigFile, error) {
 
-	monacoConfFileContent, err := GetKeptnResource(keptnEvent, MonacoConfigFilename)
+	monacoConfFileContent, err := GetResource(keptnEvent, GetTeamResourceURI(keptnEvent, MonacoConfigFilename))
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +288,7 @@ func GetMonacoConfig(keptnEvent *BaseKeptnEvent) (*MonacoConfigFile, error) {
 	if err != nil {
 		logMessage := fmt.Sprintf("Couldn't parse %s file found for service %s in stage %s in project %s. Error: %s; Content: %s", MonacoConfigFilename, keptnEvent.Service, keptnEvent.Stage, keptnEvent.Project, err.Error(), monacoConfFileContent)
 		log.Printf(logMessage)
-		return nil, errors.New(logMessage)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMonacoConfig, logMessage)
 	}
 	fmt.Printf("GetMonacoConfig monacoConfFile: %v\n", monacoConfFile)
 	return monacoConfFile, nil
@@ -211,7 +305,7 @@ func UploadKeptnResource(contentToUpload []byte, remoteResourceURI string, keptn
 		}
 		log.Printf("Local file written " + remoteResourceURI)
 	} else {
-		resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
+		resourceHandler := newResourceHandler("")
 
 		// lets upload it
 		resources := []*keptnmodels.Resource{{ResourceContent: string(contentToUpload), ResourceURI: &remoteResourceURI}}
@@ -244,14 +338,27 @@ func parseMonacoConfigFile(input []byte) (*MonacoConfigFile, error) {
  * Pulls the Dynatrace Credentials from the passed secret
  */
 func GetDTCredentials(dynatraceSecretName string) (*DTCredentials, error) {
+	return GetDTCredentialsForEnvironment(dynatraceSecretName, "")
+}
+
+/**
+ * Pulls the Dynatrace Credentials of the monaco environment from the passed secret, see SelectEnvironmentCredentials.
+ * An empty environment returns the default credentials of the secret.
+ */
+func GetDTCredentialsForEnvironment(dynatraceSecretName string, environment string) (*DTCredentials, error) {
 	if dynatraceSecretName == "" {
 		return nil, nil
 	}
 	dtCreds := &DTCredentials{}
+	environments := ""
+	missingCredentialsMessage := "invalid or no Dynatrace credentials found. Need DT_TENANT & DT_API_TOKEN stored in secret!"
 	if RunLocal || RunLocalTest {
 		// if we RunLocal we take it from the env-variables
 		dtCreds.Tenant = os.Getenv("DT_TENANT")
 		dtCreds.ApiToken = os.Getenv("DT_API_TOKEN")
+		dtCreds.Tier = os.Getenv("DT_TIER")
+		environments = os.Getenv(DTEnvironmentsSecretKey)
+		missingCredentialsMessage = "invalid or no Dynatrace credentials found. Need DT_TENANT & DT_API_TOKEN set as env variables!"
 	} else {
 		kubeAPI, err := GetKubernetesClient()
 		if err != nil {
@@ -262,21 +369,40 @@ func GetDTCredentials(dynatraceSecretName string) (*DTCredentials, error) {
 			return nil, fmt.Errorf("error retrieving Dynatrace credentials: could not retrieve secret %s: %v", dynatraceSecretName, err)
 		}
 
-		// grabnerandi: remove check on DT_PAAS_TOKEN as it is not relevant for quality-gate-only use case
-		if string(secret.Data["DT_TENANT"]) == "" || string(secret.Data["DT_API_TOKEN"]) == "" { //|| string(secret.Data["DT_PAAS_TOKEN"]) == "" {
-			return nil, errors.New("invalid or no Dynatrace credentials found. Need DT_TENANT & DT_API_TOKEN stored in secret!")
-		}
-
 		dtCreds.Tenant = string(secret.Data["DT_TENANT"])
 		dtCreds.ApiToken = string(secret.Data["DT_API_TOKEN"])
+		dtCreds.Tier = string(secret.Data["DT_TIER"])
+		environments = string(secret.Data[DTEnvironmentsSecretKey])
+	}
+
+	if environment != "" && environments != "" {
+		environmentCreds, err := SelectEnvironmentCredentials(dynatraceSecretName, environments, environment)
+		if err != nil {
+			return nil, err
+		}
+		dtCreds = environmentCreds
+	}
+
+	// grabnerandi: remove check on DT_PAAS_TOKEN as it is not relevant for quality-gate-only use case
+	if dtCreds.Tenant == "" || dtCreds.ApiToken == "" {
+		return nil, errors.New(missingCredentialsMessage)
 	}
 
 	// ensure URL always has http or https in front
-	if strings.HasPrefix(dtCreds.Tenant, "https://") || strings.HasPrefix(dtCreds.Tenant, "http://") {
-		dtCreds.Tenant = dtCreds.Tenant
-	} else {
+	if !strings.HasPrefix(dtCreds.Tenant, "https://") && !strings.HasPrefix(dtCreds.Tenant, "http://") {
 		dtCreds.Tenant = "https://" + dtCreds.Tenant
 	}
+	// the environment URL monaco and the Dynatrace API calls use includes the path of Managed environments
+	if dtCreds.ApiBasePath != "" {
+		basePath, err := ValidateAPIBasePath(dtCreds.ApiBasePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DT_API_BASE_PATH of monaco environment %s in secret %s: %v", environment, dynatraceSecretName, err)
+		}
+		dtCreds.Tenant = strings.TrimSuffix(dtCreds.Tenant, "/")
+		if !strings.HasSuffix(dtCreds.Tenant, basePath) {
+			dtCreds.Tenant += basePath
+		}
+	}
 	return dtCreds, nil
 }
 
@@ -302,6 +428,9 @@ func TimestampToString(time time.Time) string {
 
 // Request URL of configuration service
 func GetConfigurationServiceURL() string {
+	if configurationServiceURL != "" {
+		return configurationServiceURL
+	}
 	if os.Getenv("CONFIGURATION_SERVICE") != "" {
 		return os.Getenv("CONFIGURATION_SERVICE")
 	}
@@ -312,7 +441,7 @@ func GetConfigurationServiceURL() string {
 func CreateBaseFolderIfNotExist() error {
 	path := MonacoBaseFolder
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		errmkdir := os.Mkdir(path, os.ModePerm)
+		errmkdir := os.MkdirAll(path, WorkDirPermissions)
 		if errmkdir != nil {
 			return errmkdir
 		}
@@ -325,7 +454,7 @@ func CreateBaseFolderIfNotExist() error {
 func CreateTempFolderForKeptnContext(keptnEvent *BaseKeptnEvent) (error, string) {
 	path := GetTempMonacoFolder(keptnEvent)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		errmkdir := os.Mkdir(path, os.ModePerm)
+		errmkdir := os.MkdirAll(path, WorkDirPermissions)
 		if errmkdir != nil {
 			return errmkdir, path
 		}
@@ -346,14 +475,37 @@ func DeleteTempFolderForKeptnContext(keptnEvent *BaseKeptnEvent) error {
 	return nil
 }
 
-// returns the tmp folder for this run, e.g: tmp/KEPTNCONTEXT-STAGE
+/**
+ * returns the tmp folder for this run, namespaced by project so runs of different projects can't see each other's
+ * files, e.g: tmp/monaco/PROJECT/KEPTNCONTEXT-STAGE. With IsolateTenants and a known tenant the Dynatrace environment
+ * is added, e.g: tmp/monaco/PROJECT/abc12345.live.dynatrace.com/KEPTNCONTEXT-STAGE
+ */
 func GetTempMonacoFolder(keptnEvent *BaseKeptnEvent) string {
-	return fmt.Sprintf("%s%s-%s", MonacoBaseFolder, keptnEvent.Context, keptnEvent.Stage)
+	namespace := getWorkDirNamespace(keptnEvent.Project)
+	if IsolateTenants && keptnEvent.Tenant != "" {
+		tenant := keptnEvent.Tenant
+		if tenantURL, err := url.Parse(tenant); err == nil && tenantURL.Host != "" {
+			tenant = tenantURL.Host
+		}
+		namespace += "/" + getWorkDirNamespace(tenant)
+	}
+	return fmt.Sprintf("%s%s/%s-%s", MonacoBaseFolder, namespace, keptnEvent.Context, keptnEvent.Stage)
+}
+
+var workDirNamespaceInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// returns name as a single folder name that can't escape the work directory
+func getWorkDirNamespace(name string) string {
+	name = workDirNamespaceInvalidChars.ReplaceAllString(name, "_")
+	if name == "" || name == "." || name == ".." {
+		return "_" + name
+	}
+	return name
 }
 
 // Copy file contents to a destination
 func CopyFileContentToDestination(fileContent string, destination string) error {
-	err := ioutil.WriteFile(destination, []byte(fileContent), 0755)
+	err := ioutil.WriteFile(destination, []byte(fileContent), WorkFilePermissions)
 
 	return err
 }
@@ -382,39 +534,209 @@ func ExtractMonacoArchive(keptnEvent *BaseKeptnEvent) error {
 func ExtractZIPArchive(archiveFileName string, outputFolder string) error {
 	files, err := Unzip(archiveFileName, outputFolder)
 	if err != nil {
-		fmt.Errorf("Error unzipping file: " + err.Error())
+		fmt.Println("Error unzipping file: " + err.Error())
 		return err
 	}
 	fmt.Println("Succesfully Unzipped:\n" + strings.Join(files, "\n"))
 	return nil
 }
 
-func ExecuteMonaco(dtCredentials *DTCredentials, keptnEvent *BaseKeptnEvent, projects string, verbose bool, dryrun bool) error {
+/**
+ * Runs monaco and returns its combined output. The command and output are also written to options.Log if set.
+ * The Dynatrace API token and everything matching options.SecretPatterns is redacted from the output.
+ */
+func ExecuteMonaco(ctx context.Context, dtCredentials *DTCredentials, keptnEvent *BaseKeptnEvent, options MonacoCommandOptions) (string, error) {
+
+	cmd, cleanup, err := NewMonacoCommand(ctx, dtCredentials, keptnEvent, options)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	fmt.Printf("Monaco command: %v\n", cmd.String())
+	stdoutStderr, err := cmd.CombinedOutput()
+	output := RedactSecrets(string(stdoutStderr), options.SecretPatterns, dtCredentials.ApiToken, options.Account.Secret())
+	fmt.Printf("%s\n", output)
 
-	cmd := exec.Command(MonacoExecutable)
+	if options.Log != nil {
+		fmt.Fprintf(options.Log, "Monaco command: %v\n%s\n", cmd.String(), output)
+	}
 
-	tmpMonacoFolder := GetTempMonacoFolder(keptnEvent)
-	// If running in a locla environment, use a local test folder
+	return output, err
+}
+
+// returns the folder monaco is executed on: the temp folder of the run or the local test folder when running locally
+func GetMonacoFolder(keptnEvent *BaseKeptnEvent) string {
 	if RunLocal {
-		tmpMonacoFolder = "monaco-test"
+		return "monaco-test"
 	}
+	return GetTempMonacoFolder(keptnEvent)
+}
 
-	if verbose {
-		cmd.Args = append(cmd.Args, "-v")
+/**
+ * Looks for the monaco v2 manifest.yaml in the downloaded monaco files, either at the root or in the projects folder
+ */
+func FindMonacoManifest(keptnEvent *BaseKeptnEvent) (string, error) {
+	folder := GetMonacoFolder(keptnEvent)
+	candidates := []string{folder + "/" + MonacoManifestFilename, folder + "/" + MonacoProjectsSubfolder + "/" + MonacoManifestFilename}
+	for _, candidate := range candidates {
+		if FileExists(candidate) {
+			return candidate, nil
+		}
 	}
-	if dryrun {
-		cmd.Args = append(cmd.Args, "-d")
+	return "", fmt.Errorf("no %s found in the monaco files for project=%s,stage=%s,service=%s", MonacoManifestFilename, keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service)
+}
+
+/**
+ * Prepares the monaco command including all arguments and environment variables without starting it.
+ * Depending on the token delivery the Dynatrace API token is either passed as DT_API_TOKEN or written to a temp file
+ * that is referenced by DT_API_TOKEN_FILE. The returned cleanup function removes that temp file again.
+ */
+func NewMonacoCommand(ctx context.Context, dtCredentials *DTCredentials, keptnEvent *BaseKeptnEvent, options MonacoCommandOptions) (*exec.Cmd, func(), error) {
+
+	executable := MonacoExecutable
+	if options.Executable != "" {
+		executable = options.Executable
 	}
-	cmd.Args = append(cmd.Args, "-e=/environments.yaml")
-	if projects != "" {
-		cmd.Args = append(cmd.Args, "-p="+projects)
+	cmd := exec.CommandContext(ctx, executable)
+	cleanup := func() {}
+
+	switch options.CLIVersion {
+	case MonacoCLIVersion2:
+		// monaco [account] deploy manifest.yaml [--dry-run] [--verbose] [--project=...]
+		if options.ManifestPath == "" {
+			return nil, cleanup, errors.New("monaco v2 requires a manifest")
+		}
+		if options.DeleteFile != "" {
+			// monaco delete --manifest manifest.yaml --file delete.yaml [--environment=...]
+			if options.Account != nil {
+				return nil, cleanup, errors.New("monaco can't delete account resources")
+			}
+			cmd.Args = append(cmd.Args, "delete", "--manifest", options.ManifestPath, "--file", options.DeleteFile)
+			cmd.Args = append(cmd.Args, environmentArgs(options.Environment)...)
+			break
+		}
+		if options.ExportDir != "" {
+			// monaco download --manifest manifest.yaml --environment=... --output-folder export
+			if options.Account != nil {
+				return nil, cleanup, errors.New("monaco can't export account resources")
+			}
+			if options.Environment == "" || strings.Contains(options.Environment, ",") {
+				return nil, cleanup, errors.New("monaco exports the configs of a single environment")
+			}
+			cmd.Args = append(cmd.Args, "download", "--manifest", options.ManifestPath, "--environment="+options.Environment, "--output-folder", options.ExportDir)
+			break
+		}
+		if options.Account != nil {
+			if options.Group != "" || options.Environment != "" {
+				return nil, cleanup, errors.New("monaco account deployments can't select an environment group or environment")
+			}
+			cmd.Args = append(cmd.Args, "account")
+		}
+		cmd.Args = append(cmd.Args, "deploy", options.ManifestPath)
+		if options.DryRun {
+			cmd.Args = append(cmd.Args, "--dry-run")
+		}
+		if options.Verbose {
+			cmd.Args = append(cmd.Args, "--verbose")
+		}
+		if options.ContinueOnError {
+			cmd.Args = append(cmd.Args, "--continue-on-error")
+		}
+		if options.Group != "" && options.Environment != "" {
+			return nil, cleanup, errors.New("monaco can either deploy an environment group or an environment, not both")
+		}
+		if options.Group != "" {
+			cmd.Args = append(cmd.Args, "--group="+options.Group)
+		}
+		cmd.Args = append(cmd.Args, environmentArgs(options.Environment)...)
+		for _, project := range strings.Split(options.Projects, ",") {
+			if project = strings.TrimSpace(project); project != "" {
+				cmd.Args = append(cmd.Args, "--project="+project)
+			}
+		}
+	case MonacoCLIVersion1, "":
+		if options.Group != "" || options.Environment != "" {
+			return nil, cleanup, fmt.Errorf("environment groups and environments can only be selected with monaco %s", MonacoCLIVersion2)
+		}
+		if options.Account != nil {
+			return nil, cleanup, fmt.Errorf("account resources can only be deployed with monaco %s", MonacoCLIVersion2)
+		}
+		if options.ExportDir != "" {
+			return nil, cleanup, fmt.Errorf("configs can only be exported with monaco %s", MonacoCLIVersion2)
+		}
+		if options.Verbose {
+			cmd.Args = append(cmd.Args, "-v")
+		}
+		if options.DryRun {
+			cmd.Args = append(cmd.Args, "-d")
+		}
+		if options.ContinueOnError {
+			cmd.Args = append(cmd.Args, "--continue-on-error")
+		}
+		environmentsFile := MonacoEnvironmentsFile
+		if options.EnvironmentsFile != "" {
+			environmentsFile = options.EnvironmentsFile
+		}
+		cmd.Args = append(cmd.Args, "-e="+environmentsFile)
+		if options.DeleteFile != "" {
+			// monaco v1 deletes the configs of the delete.yaml at the root of the projects, the folder holds no projects
+			cmd.Args = append(cmd.Args, filepath.Dir(options.DeleteFile))
+			break
+		}
+		if options.Projects != "" {
+			cmd.Args = append(cmd.Args, "-p="+options.Projects)
+		}
+		cmd.Args = append(cmd.Args, GetMonacoFolder(keptnEvent)+"/projects")
+	default:
+		return nil, cleanup, fmt.Errorf("unsupported monaco CLI version '%s', must be one of %s, %s", options.CLIVersion, MonacoCLIVersion1, MonacoCLIVersion2)
 	}
-	cmd.Args = append(cmd.Args, tmpMonacoFolder+"/projects")
 
 	// Set environment variables to be used in monaco
 	cmd.Env = os.Environ()
+	for key, value := range options.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
 	cmd.Env = append(cmd.Env, "DT_ENVIRONMENT_URL="+dtCredentials.Tenant)
-	cmd.Env = append(cmd.Env, "DT_API_TOKEN="+dtCredentials.ApiToken)
+	if options.SchemaMirror != "" {
+		cmd.Env = append(cmd.Env, "MONACO_SCHEMA_MIRROR="+options.SchemaMirror)
+	}
+
+	// files monaco reads, they are handed over to options.User
+	monacoFiles := []string{GetMonacoFolder(keptnEvent)}
+	switch options.TokenDelivery {
+	case TokenDeliveryFile:
+		tokenFile, err := ioutil.TempFile("", "monaco-token-")
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("could not create token file: %v", err)
+		}
+		cleanup = func() { os.Remove(tokenFile.Name()) }
+		_, err = tokenFile.WriteString(dtCredentials.ApiToken)
+		tokenFile.Close()
+		if err != nil {
+			cleanup()
+			return nil, func() {}, fmt.Errorf("could not write token file: %v", err)
+		}
+		cmd.Env = append(cmd.Env, "DT_API_TOKEN_FILE="+tokenFile.Name())
+		monacoFiles = append(monacoFiles, tokenFile.Name())
+	case TokenDeliveryEnv, "":
+		cmd.Env = append(cmd.Env, "DT_API_TOKEN="+dtCredentials.ApiToken)
+	default:
+		return nil, cleanup, fmt.Errorf("unsupported token delivery mode '%s', must be one of %s, %s", options.TokenDelivery, TokenDeliveryEnv, TokenDeliveryFile)
+	}
+	if options.Account != nil {
+		cmd.Env = append(cmd.Env, AccountUUIDKey+"="+options.Account.AccountUUID)
+		cmd.Env = append(cmd.Env, AccountClientIDKey+"="+options.Account.ClientID)
+		cmd.Env = append(cmd.Env, AccountClientSecretKey+"="+options.Account.ClientSecret)
+	}
+
+	if options.User != nil {
+		if err := runAsMonacoUser(cmd, options.User, monacoFiles...); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+	}
+
 	cmd.Env = append(cmd.Env, "KEPTN_PROJECT="+keptnEvent.Project)
 	cmd.Env = append(cmd.Env, "KEPTN_SERVICE="+keptnEvent.Service)
 	cmd.Env = append(cmd.Env, "KEPTN_STAGE="+keptnEvent.Stage)
@@ -430,11 +752,11 @@ func ExecuteMonaco(dtCredentials *DTCredentials, keptnEvent *BaseKeptnEvent, pro
 		cmd.Env = append(cmd.Env, fmt.Sprintf("KEPTN_LABEL_%s=%s", labelKey, url.QueryEscape(value)))
 	}
 
-	fmt.Printf("Monaco command: %v\n", cmd.String())
-	stdoutStderr, err := cmd.CombinedOutput()
-	fmt.Printf("%s\n", stdoutStderr)
+	for key, value := range options.EnvOverride {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
 
-	return err
+	return cmd, cleanup, nil
 }
 
 /**
@@ -442,7 +764,7 @@ func ExecuteMonaco(dtCredentials *DTCredentials, keptnEvent *BaseKeptnEvent, pro
  */
 func DownloadAndExtractMonacoZip(keptnEvent *BaseKeptnEvent, zipFilePath string) error {
 	// Get archive from Keptn
-	monacoArchive, err := GetKeptnResource(keptnEvent, zipFilePath)
+	monacoArchive, err := GetResource(keptnEvent, zipFilePath)
 	if err != nil {
 		log.Printf(fmt.Sprintf("No monaco archive found for project=%s,stage=%s,service=%s found as no dynatrace/monaco.zip in repo: %s, breaking", keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, err.Error()))
 		return err
@@ -482,19 +804,40 @@ func DownloadAllFilesFromSubfolder(keptnEvent *BaseKeptnEvent, projectsPath stri
 		log.Printf(fmt.Sprintf("Error cleaning temp folder '%s' content: %v", folder, err))
 		return err
 	}
-	err = os.MkdirAll(folder, os.ModePerm)
+	err = os.MkdirAll(folder, WorkDirPermissions)
 	if err != nil {
 		log.Printf(fmt.Sprintf("Error creating temp folder '%s' content: %v", folder, err))
 		return err
 	}
 
-	fileMatchPattern := projectsPath
-	downloadedFileCount, err := GetAllKeptnResources(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, true, fileMatchPattern, folder)
-
+	fetcher := NewResourceFetcher(keptnEvent)
+	resourcePaths, err := fetcher.List(projectsPath)
 	if err != nil {
 		return err
 	}
 
+	// the files are stored relative to projectsPath, e.g., /dynatrace/projects/sockshop/auto-tag/auto-tag.yaml as sockshop/auto-tag/auto-tag.yaml
+	folderOfInterest := strings.TrimPrefix(projectsPath, "/")
+	downloadedFileCount := 0
+	for _, resourcePath := range resourcePaths {
+		startingIndex := strings.Index(resourcePath, folderOfInterest)
+		if startingIndex < 0 || strings.HasSuffix(resourcePath, "/") {
+			continue
+		}
+		content, err := fetcher.Fetch(resourcePath)
+		if err != nil {
+			return err
+		}
+		stored, err := storeFile(folder, resourcePath[startingIndex+len(folderOfInterest):], string(content), true)
+		if err != nil {
+			return err
+		}
+		if stored {
+			downloadedFileCount++
+		}
+	}
+	log.Printf("Downloaded %d files for %s in %s.%s.%s", downloadedFileCount, projectsPath, keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service)
+
 	if downloadedFileCount == 0 {
 		err = fmt.Errorf("No Monaco files found for project=%s,stage=%s,service=%s under %s", keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, projectsPath)
 	}
@@ -520,18 +863,33 @@ func PrepareFiles(keptnEvent *BaseKeptnEvent) error {
 	}
 	log.Printf(fmt.Sprintf("Monaco temp folder created %s", tmpFolderPath))
 
-	// We provide two options for monaco files
+	// monaco files mounted into the container, e.g., from a ConfigMap, replace the files of the configuration service
+	if found, err := CopyMountedConfig(keptnEvent, configMountPath); found {
+		if err != nil {
+			return fmt.Errorf("could not copy the monaco files from %s: %w", configMountPath, err)
+		}
+		log.Printf("Using the monaco files mounted at %s", configMountPath)
+		return nil
+	}
+
+	// We provide three options for monaco files
 	// Option 1: zipped file under dynatrace/monaco.zip
-	// Option 2: folder structure as defined in project monaco under dynatrace/projects
+	// Option 2: gzipped tar archive under dynatrace/monaco.tar.gz
+	// Option 3: folder structure as defined in project monaco under dynatrace/projects
 
 	// We first try option 1 as this was the initial implementation of the monaco service
-	err = DownloadAndExtractMonacoZip(keptnEvent, "dynatrace/monaco.zip")
+	err = DownloadAndExtractMonacoZip(keptnEvent, GetTeamResourceURI(keptnEvent, "dynatrace/monaco.zip"))
 	if err == nil {
 		return nil
 	}
 
-	// Now lets try option 2 where we assume there is a projects folder under dynatrace. we simply download all these files
-	err = DownloadAllFilesFromSubfolder(keptnEvent, "/dynatrace/projects/")
+	// a tarball that can't be fetched or extracted safely fails the run instead of falling back to option 3
+	if found, err := DownloadAndExtractMonacoTarball(keptnEvent); found || err != nil {
+		return err
+	}
+
+	// Now lets try option 3 where we assume there is a projects folder under dynatrace. we simply download all these files
+	err = DownloadAllFilesFromSubfolder(keptnEvent, GetTeamResourceURI(keptnEvent, "/dynatrace/projects/"))
 
 	return err
 }
@@ -576,16 +934,16 @@ func Unzip(src string, dest string) ([]string, error) {
 
 		if f.FileInfo().IsDir() {
 			// Make Folder
-			os.MkdirAll(fpath, os.ModePerm)
+			os.MkdirAll(fpath, WorkDirPermissions)
 			continue
 		}
 
 		// Make File
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		if err = os.MkdirAll(filepath.Dir(fpath), WorkDirPermissions); err != nil {
 			return filenames, err
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm()&WorkDirPermissions)
 		if err != nil {
 			return filenames, err
 		}
@@ -608,108 +966,20 @@ func Unzip(src string, dest string) ([]string, error) {
 	return filenames, nil
 }
 
-/*
- * This function will download ALL Resources from Keptn's Configuration Repository where the name starts with 'resourceUriFolderOfInterest'. This for instance allows us to download all files in the /dynatrace/projects folders
- *
- * Parameters:
- * project, stage, string: reference the keptn repo
- * inheritResources: if true it will download all resources from service, stage and project level - otherwise just from service level
- * resourceUriFolderOfInterest: will only download resources where the resourceUri contains that value, e.g: "/jmeter" and then also stores the downloaded files under that prefix
- * localDirectory: the local directory to store these downloaded files
- *
- * Return:
- * no of resources: total number of downloaded resources
- * error: any error that occured
- */
-func GetAllKeptnResources(project string, stage string, service string, inheritResources bool, resourceUriFolderOfInterest string, localDirectory string) (int, error) {
-
-	resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
-
-	// Lets first get the servcie resources
-	// TODO: This endpoint is not yet implemented and therefore this always fails - https://github.com/keptn/keptn/issues/1924
-	/* resourceList, err := resourceHandler.GetAllServiceResources(project, stage, service)
-	if err != nil {
-		return 0, err
-	}*/
-
-	resourceList := []*keptnmodels.Resource{}
-
-	// Next - lets get stage and project resources!
-	// if inheritResources == true we also get the list of resources from stage and project level
-	if inheritResources {
-		stageResources, err := resourceHandler.GetAllStageResources(project, stage)
-		if err != nil {
-			return 0, err
-		}
-		resourceList = append(resourceList, stageResources...)
-
-		// TODO: missing configutils.GetAllProjectResources(project)
-		/* projectResources, err := resourceHandler.GetAllProjectResoruces(project)
-		if err != nil {
-			return 0, err
-		}
-		resourceList = append(resourceList, projectResources...)*/
-	}
-
-	fileCount := 0
-	skippedFileCount := 0
-
-	// Download Files
-	// now lets iterate through all resources and download those that match the resourceUriFolderOfInterest and that havent already been downloaded
-	// as we download files from project, service and stage level we have different file structures, e.g:
-	// Project: /jmeter/myjmeter.jmx
-	// Stage: /jmeter/myjmenter2.jmx
-	// Stage: /myservice/jmeter/myjmeter3.jmx
-	// When we store it locally we have to store all these files in /jmeter/filename.jmx
-	for _, resource := range resourceList {
-		startingIndex := strings.Index(*resource.ResourceURI, resourceUriFolderOfInterest)
-
-		// store to local directory if it doesnt already exist
-		// now lets strip off the any prepending directory names prior to resourceUriFolderOfInterest
-
-		targetFileName := ""
-		if startingIndex >= 0 {
-			startingIndex += len(resourceUriFolderOfInterest)
-			targetFileName = (*resource.ResourceURI)[startingIndex:]
-		}
-
-		// only store it if we really know whether and where we have to store it to!
-		if targetFileName != "" {
-
-			// now we have to download that resource first as so far we only have the resourceURI
-			downloadedResource, err := resourceHandler.GetStageResource(project, stage, *resource.ResourceURI)
-			if err != nil {
-				return fileCount, err
-			}
-
-			log.Printf(fmt.Sprintf("Storing %s to %s/%s - size (%d)", *resource.ResourceURI, localDirectory, targetFileName, len(downloadedResource.ResourceContent)))
-			stored, err := storeFile(localDirectory, targetFileName, downloadedResource.ResourceContent, true)
-			if err != nil {
-				return fileCount, err
-			}
-
-			if stored {
-				fileCount = fileCount + 1
-			}
-		} else {
-			skippedFileCount = skippedFileCount + 1
-			// 	log.Printf(fmt.Sprintf("Not storing %s as it doesnt match %s or %s", *resource.ResourceURI, primaryTestFileName, resourceUriFolderOfInterest))
-		}
-	}
-
-	log.Printf(fmt.Sprintf("Downloaded %d and skipped %d files for %s in %s.%s.%s", fileCount, skippedFileCount, resourceUriFolderOfInterest, project, stage, service))
-
-	return fileCount, nil
-}
-
 /**
- * Stores the content to the local file system under the targetFileName (can also contain directories)
+ * Stores the content to the local file system under the targetFileName (can also contain directories), names with
+ * absolute paths or .. are rejected
  * Returns:
  * 1: true if file was actually written, e.g: will be false if file exists and overwriteIfExists==False
  * 2: error if an error occured
  */
 func storeFile(localDirectory string, targetFileName string, resourceContent string, overwriteIfExists bool) (bool, error) {
 
+	// the target file name comes from the resource list, e.g., the index.txt of a web server, and must stay in localDirectory
+	if _, err := containedPath(localDirectory, targetFileName); err != nil {
+		return false, err
+	}
+
 	// lets construct the final directory name
 	if !strings.HasSuffix(localDirectory, "/") {
 		localDirectory = localDirectory + "/"
@@ -729,13 +999,13 @@ func storeFile(localDirectory string, targetFileName string, resourceContent str
 	}
 
 	// now lets create that directory if it doesnt exist
-	err := os.MkdirAll(directory, os.ModePerm)
+	err := os.MkdirAll(directory, WorkDirPermissions)
 	if err != nil {
 		return false, err
 	}
 
 	// now we store the file
-	writeToFile, err := os.Create(finalLocalFilename)
+	writeToFile, err := os.OpenFile(finalLocalFilename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, WorkFilePermissions)
 	if err != nil {
 		return false, err
 	}
@@ -759,3 +1029,45 @@ func FileExists(filename string) bool {
 	}
 	return false
 }
+
+// DTRateLimit holds the rate limit information the Dynatrace API returns with every response
+type DTRateLimit struct {
+	Limit      int
+	Remaining  int
+	Reset      time.Time
+	RetryAfter time.Duration
+}
+
+/**
+ * Sends a lightweight preflight request to the Dynatrace API and parses the rate limit headers of the response
+ */
+func GetDTRateLimit(dtCredentials *DTCredentials) (*DTRateLimit, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(dtCredentials.Tenant, "/")+"/api/v1/config/clusterversion", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Api-Token "+dtCredentials.ApiToken)
+
+	resp, err := getDynatraceHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("preflight request to Dynatrace failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	rateLimit := &DTRateLimit{Limit: -1, Remaining: -1}
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		rateLimit.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		rateLimit.Remaining = remaining
+	}
+	// Dynatrace reports the reset time in microseconds since epoch
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rateLimit.Reset = time.Unix(0, reset*int64(time.Microsecond))
+	}
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		rateLimit.RetryAfter = time.Duration(retryAfter) * time.Second
+	}
+
+	return rateLimit, nil
+}
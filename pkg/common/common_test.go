@@ -0,0 +1,388 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getCmdEnv(env []string, name string) (string, bool) {
+	for _, entry := range env {
+		if strings.HasPrefix(entry, name+"=") {
+			return strings.TrimPrefix(entry, name+"="), true
+		}
+	}
+	return "", false
+}
+
+func TestNewMonacoCommandTokenDelivery(t *testing.T) {
+	dtCredentials := &DTCredentials{Tenant: "https://abc12345.live.dynatrace.com", ApiToken: "dt0c01.SECRETTOKEN"}
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "my-context"}
+
+	for _, tokenDelivery := range []string{TokenDeliveryEnv, TokenDeliveryFile} {
+		t.Run(tokenDelivery, func(t *testing.T) {
+			cmd, cleanup, err := NewMonacoCommand(context.Background(), dtCredentials, keptnEvent, MonacoCommandOptions{Projects: "sockshop", Verbose: true, TokenDelivery: tokenDelivery})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer cleanup()
+
+			for _, arg := range cmd.Args {
+				if strings.Contains(arg, dtCredentials.ApiToken) {
+					t.Errorf("token leaked in argv: %v", cmd.Args)
+				}
+			}
+
+			tokenEnv, hasTokenEnv := getCmdEnv(cmd.Env, "DT_API_TOKEN")
+			tokenFile, hasTokenFile := getCmdEnv(cmd.Env, "DT_API_TOKEN_FILE")
+
+			switch tokenDelivery {
+			case TokenDeliveryEnv:
+				if tokenEnv != dtCredentials.ApiToken {
+					t.Errorf("expected DT_API_TOKEN to contain the token")
+				}
+				if hasTokenFile {
+					t.Errorf("did not expect DT_API_TOKEN_FILE to be set")
+				}
+			case TokenDeliveryFile:
+				if hasTokenEnv && tokenEnv == dtCredentials.ApiToken {
+					t.Errorf("did not expect DT_API_TOKEN to contain the token")
+				}
+				content, err := ioutil.ReadFile(tokenFile)
+				if err != nil {
+					t.Fatalf("could not read token file: %v", err)
+				}
+				if string(content) != dtCredentials.ApiToken {
+					t.Errorf("expected token file to contain the token, got %s", string(content))
+				}
+				info, _ := os.Stat(tokenFile)
+				if info.Mode().Perm() != 0600 {
+					t.Errorf("expected token file permissions 0600, got %v", info.Mode().Perm())
+				}
+				cleanup()
+				if FileExists(tokenFile) {
+					t.Errorf("expected token file to be removed by cleanup")
+				}
+			}
+		})
+	}
+}
+
+func TestNewMonacoCommandInvalidTokenDelivery(t *testing.T) {
+	_, _, err := NewMonacoCommand(context.Background(), &DTCredentials{}, &BaseKeptnEvent{}, MonacoCommandOptions{TokenDelivery: "stdin"})
+	if err == nil {
+		t.Errorf("expected an error for an unsupported token delivery mode")
+	}
+}
+
+func TestNewMonacoCommandShapes(t *testing.T) {
+	dtCredentials := &DTCredentials{Tenant: "https://abc12345.live.dynatrace.com", ApiToken: "dt0c01.SECRETTOKEN"}
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "my-context"}
+
+	tests := []struct {
+		name     string
+		options  MonacoCommandOptions
+		expected []string
+	}{
+		{
+			name:     "v1",
+			options:  MonacoCommandOptions{CLIVersion: MonacoCLIVersion1, Projects: "sockshop", Verbose: true, DryRun: true},
+			expected: []string{MonacoExecutable, "-v", "-d", "-e=/environments.yaml", "-p=sockshop", "tmp/monaco/sockshop/my-context-dev/projects"},
+		},
+		{
+			name:     "v2",
+			options:  MonacoCommandOptions{CLIVersion: MonacoCLIVersion2, ManifestPath: "tmp/monaco/my-context-dev/manifest.yaml", Projects: "sockshop, infrastructure", Verbose: true, DryRun: true},
+			expected: []string{MonacoExecutable, "deploy", "tmp/monaco/my-context-dev/manifest.yaml", "--dry-run", "--verbose", "--project=sockshop", "--project=infrastructure"},
+		},
+		{
+			name:     "v1 delete",
+			options:  MonacoCommandOptions{CLIVersion: MonacoCLIVersion1, DeleteFile: "tmp/monaco/sockshop/my-context-dev/delete/delete.yaml"},
+			expected: []string{MonacoExecutable, "-e=/environments.yaml", "tmp/monaco/sockshop/my-context-dev/delete"},
+		},
+		{
+			name:     "v2 delete",
+			options:  MonacoCommandOptions{CLIVersion: MonacoCLIVersion2, ManifestPath: "tmp/monaco/my-context-dev/manifest.yaml", DeleteFile: "tmp/monaco/my-context-dev/delete/delete.yaml", Environment: "prod-eu"},
+			expected: []string{MonacoExecutable, "delete", "--manifest", "tmp/monaco/my-context-dev/manifest.yaml", "--file", "tmp/monaco/my-context-dev/delete/delete.yaml", "--environment=prod-eu"},
+		},
+		{
+			name:     "v2 several environments",
+			options:  MonacoCommandOptions{CLIVersion: MonacoCLIVersion2, ManifestPath: "tmp/monaco/my-context-dev/manifest.yaml", Environment: "prod-eu,prod-us"},
+			expected: []string{MonacoExecutable, "deploy", "tmp/monaco/my-context-dev/manifest.yaml", "--environment=prod-eu", "--environment=prod-us"},
+		},
+		{
+			name:     "v2 export",
+			options:  MonacoCommandOptions{CLIVersion: MonacoCLIVersion2, ManifestPath: "tmp/monaco/my-context-dev/manifest.yaml", ExportDir: "tmp/monaco/my-context-dev/export/prod-eu", Environment: "prod-eu", Projects: "sockshop"},
+			expected: []string{MonacoExecutable, "download", "--manifest", "tmp/monaco/my-context-dev/manifest.yaml", "--environment=prod-eu", "--output-folder", "tmp/monaco/my-context-dev/export/prod-eu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, cleanup, err := NewMonacoCommand(context.Background(), dtCredentials, keptnEvent, tt.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer cleanup()
+
+			if strings.Join(cmd.Args, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("expected args %v, got %v", tt.expected, cmd.Args)
+			}
+		})
+	}
+}
+
+func TestNewMonacoCommandKeptnContext(t *testing.T) {
+	dtCredentials := &DTCredentials{Tenant: "https://abc12345.live.dynatrace.com", ApiToken: "dt0c01.SECRETTOKEN"}
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "08735340-6f9e-4b32-97ff-3b6c292bc50h"}
+
+	cmd, cleanup, err := NewMonacoCommand(context.Background(), dtCredentials, keptnEvent, MonacoCommandOptions{Projects: "sockshop"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+
+	keptnContext, ok := getCmdEnv(cmd.Env, "KEPTN_CONTEXT")
+	if !ok || keptnContext != keptnEvent.Context {
+		t.Errorf("expected KEPTN_CONTEXT=%s in the monaco environment, got %q", keptnEvent.Context, keptnContext)
+	}
+}
+
+func TestGetKeptnResourceAtConfigRef(t *testing.T) {
+	requestedRefs := []string{}
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get(ConfigRefQueryParameter)
+		requestedRefs = append(requestedRefs, ref)
+		if ref != "release-1.2" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"code":400,"message":"reference %s not found"}`, ref)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/resource") {
+			fmt.Fprint(w, `{"resources":[],"totalCount":0}`)
+			return
+		}
+		fmt.Fprintf(w, `{"resourceURI":"monaco.conf.yaml","resourceContent":"%s"}`, base64.StdEncoding.EncodeToString([]byte("dtCreds: dynatrace-release")))
+	}))
+	defer configurationService.Close()
+
+	defer os.Setenv("CONFIGURATION_SERVICE", os.Getenv("CONFIGURATION_SERVICE"))
+	os.Setenv("CONFIGURATION_SERVICE", configurationService.URL)
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", ConfigRef: "release-1.2"}
+	if err := ValidateConfigRef(keptnEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := GetKeptnResource(keptnEvent, MonacoConfigFilename)
+	if err != nil || content != "dtCreds: dynatrace-release" {
+		t.Errorf("expected the resource at the ref, got %q (%v)", content, err)
+	}
+	for _, ref := range requestedRefs {
+		if ref != "release-1.2" {
+			t.Errorf("expected all requests to be made at release-1.2, got %v", requestedRefs)
+		}
+	}
+
+	keptnEvent.ConfigRef = "does-not-exist"
+	err = ValidateConfigRef(keptnEvent)
+	if !errors.Is(err, ErrConfigRefNotFound) || !strings.Contains(err.Error(), "'does-not-exist'") {
+		t.Errorf("expected an error naming the missing ref, got %v", err)
+	}
+}
+
+func TestGetKeptnResourceRefreshesConfigServiceToken(t *testing.T) {
+	// the token endpoint hands out a new token on every call, the first one is already expired
+	issuedTokens := 0
+	tokenService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuedTokens++
+		fmt.Fprintf(w, "token-%d\n", issuedTokens)
+	}))
+	defer tokenService.Close()
+
+	rejectedRequests := 0
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ConfigServiceTokenHeader) != "token-2" {
+			rejectedRequests++
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code":401,"message":"token expired"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"resourceURI":"monaco.conf.yaml","resourceContent":"%s"}`, base64.StdEncoding.EncodeToString([]byte("dtCreds: dynatrace-refreshed")))
+	}))
+	defer configurationService.Close()
+
+	defer os.Setenv("CONFIGURATION_SERVICE", os.Getenv("CONFIGURATION_SERVICE"))
+	os.Setenv("CONFIGURATION_SERVICE", configurationService.URL)
+	os.Setenv("CONFIGURATION_SERVICE_TOKEN_URL", tokenService.URL)
+	defer os.Unsetenv("CONFIGURATION_SERVICE_TOKEN_URL")
+	defer configServiceToken.configure("", "")
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}
+	content, err := GetKeptnResource(keptnEvent, MonacoConfigFilename)
+	if err != nil || content != "dtCreds: dynatrace-refreshed" {
+		t.Errorf("expected the resource after refreshing the token, got %q (%v)", content, err)
+	}
+	if issuedTokens != 2 || rejectedRequests != 1 {
+		t.Errorf("expected one rejected request and one refresh, got %d rejected requests and %d tokens", rejectedRequests, issuedTokens)
+	}
+
+	// the refreshed token is reused
+	if _, err := GetKeptnResource(keptnEvent, MonacoConfigFilename); err != nil || issuedTokens != 2 {
+		t.Errorf("expected the refreshed token to be reused, got %d tokens (%v)", issuedTokens, err)
+	}
+}
+
+func TestConfigServiceTokenFetchTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	tokenService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer tokenService.Close()
+	defer close(release)
+	defer func(client *http.Client) { configServiceTokenClient = client }(configServiceTokenClient)
+	configServiceTokenClient = &http.Client{Timeout: 50 * time.Millisecond}
+
+	source := &configServiceTokenSource{}
+	source.configure("", tokenService.URL)
+	start := time.Now()
+	if _, err := source.Token(); err == nil {
+		t.Errorf("expected the token fetch to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the token fetch to give up after the client timeout, took %s", elapsed)
+	}
+}
+
+func TestTempMonacoFolderIsolation(t *testing.T) {
+	workDir, _ := ioutil.TempDir("", "monaco-service-test")
+	defer os.RemoveAll(workDir)
+	originalDir, _ := os.Getwd()
+	os.Chdir(workDir)
+	defer os.Chdir(originalDir)
+
+	sockshop := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Context: "my-context", Tenant: "https://abc12345.live.dynatrace.com"}
+	easytravel := &BaseKeptnEvent{Project: "easytravel", Stage: "dev", Context: "my-context", Tenant: "https://abc12345.live.dynatrace.com"}
+	for _, keptnEvent := range []*BaseKeptnEvent{sockshop, easytravel} {
+		if err := prepareTempFolderForTest(keptnEvent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if GetTempMonacoFolder(sockshop) == GetTempMonacoFolder(easytravel) {
+		t.Errorf("expected runs of different projects to use different folders")
+	}
+	for path, expectedMode := range map[string]os.FileMode{
+		"tmp/monaco/sockshop":                           WorkDirPermissions,
+		"tmp/monaco/sockshop/my-context-dev":            WorkDirPermissions,
+		"tmp/monaco/sockshop/my-context-dev/monaco.zip": WorkFilePermissions,
+		"tmp/monaco/easytravel/my-context-dev":          WorkDirPermissions,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+			continue
+		}
+		if info.Mode().Perm() != expectedMode {
+			t.Errorf("expected %s to have permissions %o, got %o", path, expectedMode, info.Mode().Perm())
+		}
+	}
+
+	// project names can't escape the work directory
+	if folder := GetTempMonacoFolder(&BaseKeptnEvent{Project: "..", Stage: "dev", Context: "my-context"}); folder != "tmp/monaco/_../my-context-dev" {
+		t.Errorf("expected the project folder to stay in the work directory, got %s", folder)
+	}
+
+	defer func(isolateTenants bool) { IsolateTenants = isolateTenants }(IsolateTenants)
+	IsolateTenants = true
+	if folder := GetTempMonacoFolder(sockshop); folder != "tmp/monaco/sockshop/abc12345.live.dynatrace.com/my-context-dev" {
+		t.Errorf("expected the folder to be namespaced by tenant, got %s", folder)
+	}
+}
+
+// creates the temp folder of the run and stores a monaco.zip in it
+func prepareTempFolderForTest(keptnEvent *BaseKeptnEvent) error {
+	if err, _ := CreateTempFolderForKeptnContext(keptnEvent); err != nil {
+		return err
+	}
+	return CopyFileContentsToMonacoProject("zip", keptnEvent)
+}
+
+func TestFetchedResourcesRecordCommit(t *testing.T) {
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/resource") {
+			fmt.Fprint(w, `{"resources":[{"resourceURI":"/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml"}],"totalCount":1}`)
+			return
+		}
+		fmt.Fprintf(w, `{"resourceURI":"monaco.conf.yaml","resourceContent":"%s","metadata":{"branch":"dev","version":"4f3b2a1c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a"}}`, base64.StdEncoding.EncodeToString([]byte("dtCreds: dynatrace")))
+	}))
+	defer configurationService.Close()
+
+	defer os.Setenv("CONFIGURATION_SERVICE", os.Getenv("CONFIGURATION_SERVICE"))
+	os.Setenv("CONFIGURATION_SERVICE", configurationService.URL)
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}
+	if _, err := GetKeptnResource(keptnEvent, MonacoConfigFilename); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keptnEvent.Commit != "4f3b2a1c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a" {
+		t.Errorf("expected the commit of the fetched resource, got %s", keptnEvent.Commit)
+	}
+
+	localDirectory, _ := ioutil.TempDir("", "monaco-service-test")
+	defer os.RemoveAll(localDirectory)
+
+	RunLocal = true
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	os.Chdir(localDirectory)
+	os.MkdirAll("dynatrace", os.ModePerm)
+	ioutil.WriteFile(MonacoConfigFilename, []byte("dtCreds: dynatrace"), 0644)
+	if _, err := GetKeptnResource(keptnEvent, MonacoConfigFilename); err != nil || keptnEvent.Commit != LocalCommit {
+		t.Errorf("expected resources read locally to report %s, got %s (%v)", LocalCommit, keptnEvent.Commit, err)
+	}
+}
+
+func TestExecuteMonacoRedactsOutput(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "monaco-redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	os.Chdir(workDir)
+
+	leakedToken := "dt0c01.ABCDEFGHIJKLMNOPQRSTUVWX.ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ01"
+	script := "#!/bin/sh\necho \"using token $DT_API_TOKEN\"\necho \"found " + leakedToken + " in config\"\n"
+	ioutil.WriteFile(MonacoExecutable, []byte(script), 0755)
+
+	dtCredentials := &DTCredentials{Tenant: "https://abc12345.live.dynatrace.com", ApiToken: "dt0c01.SECRETTOKEN"}
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "my-context"}
+	var log strings.Builder
+	output, err := ExecuteMonaco(context.Background(), dtCredentials, keptnEvent, MonacoCommandOptions{TokenDelivery: TokenDeliveryEnv, Log: &log, SecretPatterns: DefaultSecretPatterns})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, content := range map[string]string{"output": output, "log": log.String()} {
+		if strings.Contains(content, dtCredentials.ApiToken) || strings.Contains(content, leakedToken) {
+			t.Errorf("expected the tokens to be redacted from the %s, got %s", name, content)
+		}
+		if !strings.Contains(content, "using token ****") || !strings.Contains(content, "found **** in config") {
+			t.Errorf("expected the tokens to be replaced with ****, got %s", content)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// configurationServiceURL is the configuration service set at startup, see SetConfigurationServiceURL
+var configurationServiceURL = ""
+
+// SetConfigurationServiceURL makes GetConfigurationServiceURL return serviceURL, empty falls back to CONFIGURATION_SERVICE
+func SetConfigurationServiceURL(serviceURL string) {
+	configurationServiceURL = serviceURL
+}
+
+/**
+ * Replaces the references to environment variables in the configured configuration service URL, e.g.,
+ * http://$HOSTNAME:8080 or http://${CONFIG_HOST}:8080, and validates the result: it has to parse as a URL with a host.
+ * The scheme is optional like with the default configuration-service:8080. Empty stays empty.
+ */
+func ExpandConfigurationServiceURL(serviceURL string) (string, error) {
+	expanded := strings.TrimSpace(os.ExpandEnv(serviceURL))
+	if expanded == "" {
+		if serviceURL != "" {
+			return "", fmt.Errorf("'%s' expands to an empty URL", serviceURL)
+		}
+		return "", nil
+	}
+
+	withScheme := expanded
+	if !strings.HasPrefix(withScheme, "http://") && !strings.HasPrefix(withScheme, "https://") {
+		withScheme = "http://" + withScheme
+	}
+	parsed, err := url.Parse(withScheme)
+	if err != nil {
+		return "", fmt.Errorf("'%s' expands to the invalid URL '%s': %v", serviceURL, expanded, err)
+	}
+	if parsed.Hostname() == "" {
+		return "", fmt.Errorf("'%s' expands to '%s', which has no host", serviceURL, expanded)
+	}
+	return expanded, nil
+}
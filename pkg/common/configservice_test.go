@@ -0,0 +1,47 @@
+package common
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandConfigurationServiceURL(t *testing.T) {
+	defer os.Unsetenv("MONACO_TEST_CONFIG_HOST")
+	os.Setenv("MONACO_TEST_CONFIG_HOST", "keptn-config.keptn.svc")
+	os.Unsetenv("MONACO_TEST_UNSET")
+
+	tests := []struct {
+		name       string
+		serviceURL string
+		want       string
+		wantErr    bool
+	}{
+		{name: "referenced variable", serviceURL: "http://$MONACO_TEST_CONFIG_HOST:8080", want: "http://keptn-config.keptn.svc:8080"},
+		{name: "braced variable without scheme", serviceURL: "${MONACO_TEST_CONFIG_HOST}:8080/configuration-service", want: "keptn-config.keptn.svc:8080/configuration-service"},
+		{name: "no variables", serviceURL: "configuration-service:8080", want: "configuration-service:8080"},
+		{name: "empty", serviceURL: "", want: ""},
+		{name: "unset variable leaves no host", serviceURL: "http://$MONACO_TEST_UNSET:8080", wantErr: true},
+		{name: "expands to empty", serviceURL: "$MONACO_TEST_UNSET", wantErr: true},
+		{name: "invalid port", serviceURL: "http://$MONACO_TEST_CONFIG_HOST:port", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandConfigurationServiceURL(tt.serviceURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandConfigurationServiceURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandConfigurationServiceURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigurationServiceURLPrefersExpandedURL(t *testing.T) {
+	defer SetConfigurationServiceURL("")
+	SetConfigurationServiceURL("http://keptn-config.keptn.svc:8080")
+
+	if got := GetConfigurationServiceURL(); got != "http://keptn-config.keptn.svc:8080" {
+		t.Errorf("expected the expanded URL, got %s", got)
+	}
+}
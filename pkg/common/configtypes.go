@@ -0,0 +1,50 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * Removes the configs of all Dynatrace API types that are not in allowedTypes from the monaco projects, e.g., to
+ * only deploy dashboards. Monaco projects keep the configs of an API type in a folder named after it
+ * (projects/<project>/<api>). Returns the removed folders as <project>/<api>; an empty allowlist keeps all types.
+ */
+func FilterMonacoConfigTypes(projectsFolder string, allowedTypes []string) ([]string, error) {
+	skipped := []string{}
+	if len(allowedTypes) == 0 {
+		return skipped, nil
+	}
+	allowed := map[string]bool{}
+	for _, allowedType := range allowedTypes {
+		allowed[strings.TrimSpace(allowedType)] = true
+	}
+
+	projects, err := ioutil.ReadDir(projectsFolder)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if !project.IsDir() {
+			continue
+		}
+		apis, err := ioutil.ReadDir(filepath.Join(projectsFolder, project.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, api := range apis {
+			if !api.IsDir() || allowed[api.Name()] {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(projectsFolder, project.Name(), api.Name())); err != nil {
+				return nil, err
+			}
+			skipped = append(skipped, project.Name()+"/"+api.Name())
+		}
+	}
+	sort.Strings(skipped)
+	return skipped, nil
+}
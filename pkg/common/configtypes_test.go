@@ -0,0 +1,50 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilterMonacoConfigTypes(t *testing.T) {
+	projectsFolder, err := ioutil.TempDir("", "monaco-config-types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectsFolder)
+
+	for _, file := range []string{
+		"sockshop/dashboard/dashboard.yaml",
+		"sockshop/management-zone/zone.yaml",
+		"sockshop/alerting-profile/profile.yaml",
+		"infrastructure/management-zone/zone.yaml",
+	} {
+		path := filepath.Join(projectsFolder, file)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte("config: []\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	skipped, err := FilterMonacoConfigTypes(projectsFolder, []string{"dashboard", " alerting-profile"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"infrastructure/management-zone", "sockshop/management-zone"}
+	if !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("expected %v to be skipped, got %v", expected, skipped)
+	}
+	for _, kept := range []string{"sockshop/dashboard", "sockshop/alerting-profile"} {
+		if !FileExists(filepath.Join(projectsFolder, kept)) {
+			t.Errorf("expected %s to be kept", kept)
+		}
+	}
+	for _, removed := range expected {
+		if FileExists(filepath.Join(projectsFolder, removed)) {
+			t.Errorf("expected %s to be removed", removed)
+		}
+	}
+}
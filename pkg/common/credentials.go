@@ -0,0 +1,61 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DTEnvironmentsSecretKey holds the DT_TENANT and DT_API_TOKEN of several Dynatrace environments as yaml keyed by monaco environment
+const DTEnvironmentsSecretKey = "DT_ENVIRONMENTS"
+
+// segments of the API base path of an environment, e.g., /e/abc-123
+var apiBasePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// ErrNoEnvironmentCredentials is returned when a secret has credentials per environment but none for the deployed one
+var ErrNoEnvironmentCredentials = errors.New("no Dynatrace credentials for monaco environment")
+
+/**
+ * Returns the credentials of environment from environments, the DT_ENVIRONMENTS of the secret secretName
+ */
+func SelectEnvironmentCredentials(secretName string, environments string, environment string) (*DTCredentials, error) {
+	credentials := map[string]DTCredentials{}
+	if err := yaml.Unmarshal([]byte(environments), &credentials); err != nil {
+		return nil, fmt.Errorf("invalid %s in secret %s: %v", DTEnvironmentsSecretKey, secretName, err)
+	}
+
+	environmentCreds, ok := credentials[environment]
+	if !ok {
+		names := []string{}
+		for name := range credentials {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w %s: %s of secret %s only has credentials for %s", ErrNoEnvironmentCredentials, environment, DTEnvironmentsSecretKey, secretName, strings.Join(names, ", "))
+	}
+	if environmentCreds.Tenant == "" || environmentCreds.ApiToken == "" {
+		return nil, fmt.Errorf("invalid Dynatrace credentials for monaco environment %s in secret %s: need DT_TENANT & DT_API_TOKEN", environment, secretName)
+	}
+	return &environmentCreds, nil
+}
+
+/**
+ * Validates the API base path of an environment, e.g., /e/<environment-id> of a Dynatrace Managed cluster: it has to
+ * be an absolute path without query, fragment, empty or relative segments. Returns it without trailing slash.
+ */
+func ValidateAPIBasePath(basePath string) (string, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSpace(basePath), "/")
+	if !apiBasePathPattern.MatchString(trimmed) {
+		return "", fmt.Errorf("'%s' must be an absolute path like /e/<environment-id>", basePath)
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("'%s' must not contain relative segments", basePath)
+		}
+	}
+	return trimmed, nil
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testDTEnvironments = `
+prod-eu:
+  DT_TENANT: https://eu12345.live.dynatrace.com
+  DT_API_TOKEN: dt0c01.EUTOKEN
+prod-us:
+  DT_TENANT: us12345.live.dynatrace.com
+  DT_API_TOKEN: dt0c01.USTOKEN
+  DT_TIER: large
+`
+
+func TestGetDTCredentialsForEnvironment(t *testing.T) {
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = true
+	for name, value := range map[string]string{"DT_TENANT": "https://default.live.dynatrace.com", "DT_API_TOKEN": "dt0c01.DEFAULT", DTEnvironmentsSecretKey: testDTEnvironments} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	tests := []struct {
+		environment    string
+		expectedTenant string
+		expectedToken  string
+	}{
+		{"prod-eu", "https://eu12345.live.dynatrace.com", "dt0c01.EUTOKEN"},
+		{"prod-us", "https://us12345.live.dynatrace.com", "dt0c01.USTOKEN"},
+		{"", "https://default.live.dynatrace.com", "dt0c01.DEFAULT"},
+	}
+	for _, tt := range tests {
+		dtCreds, err := GetDTCredentialsForEnvironment("dynatrace", tt.environment)
+		if err != nil {
+			t.Fatalf("unexpected error for environment %q: %v", tt.environment, err)
+		}
+		if dtCreds.Tenant != tt.expectedTenant || dtCreds.ApiToken != tt.expectedToken {
+			t.Errorf("expected %s/%s for environment %q, got %s/%s", tt.expectedTenant, tt.expectedToken, tt.environment, dtCreds.Tenant, dtCreds.ApiToken)
+		}
+	}
+
+	_, err := GetDTCredentialsForEnvironment("dynatrace", "staging")
+	if !errors.Is(err, ErrNoEnvironmentCredentials) || !strings.Contains(err.Error(), "staging") || !strings.Contains(err.Error(), "prod-eu, prod-us") {
+		t.Errorf("expected an error naming the missing and the known environments, got %v", err)
+	}
+}
+
+func TestGetDTCredentialsForManagedEnvironment(t *testing.T) {
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = true
+	environments := `
+managed-prod:
+  DT_TENANT: https://managed.example.com/
+  DT_API_TOKEN: dt0c01.MANAGEDTOKEN
+  DT_API_BASE_PATH: /e/0a1b2c3d-4e5f-6789/
+managed-broken:
+  DT_TENANT: managed.example.com
+  DT_API_TOKEN: dt0c01.MANAGEDTOKEN
+  DT_API_BASE_PATH: /e/../api?x=1
+`
+	for name, value := range map[string]string{"DT_TENANT": "https://default.live.dynatrace.com", "DT_API_TOKEN": "dt0c01.DEFAULT", DTEnvironmentsSecretKey: environments} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	dtCreds, err := GetDTCredentialsForEnvironment("dynatrace", "managed-prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dtCreds.Tenant != "https://managed.example.com/e/0a1b2c3d-4e5f-6789" {
+		t.Errorf("expected the environment URL of the Managed environment, got %s", dtCreds.Tenant)
+	}
+
+	// monaco gets the environment URL including the base path
+	cmd, cleanup, err := NewMonacoCommand(context.Background(), dtCreds, &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Context: "my-context"}, MonacoCommandOptions{CLIVersion: MonacoCLIVersion2, ManifestPath: "manifest.yaml", Environment: "managed-prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if url, _ := getCmdEnv(cmd.Env, "DT_ENVIRONMENT_URL"); url != "https://managed.example.com/e/0a1b2c3d-4e5f-6789" {
+		t.Errorf("expected DT_ENVIRONMENT_URL to include the base path, got %s", url)
+	}
+
+	if _, err := GetDTCredentialsForEnvironment("dynatrace", "managed-broken"); err == nil || !strings.Contains(err.Error(), "DT_API_BASE_PATH") {
+		t.Errorf("expected an error about the invalid base path, got %v", err)
+	}
+}
+
+func TestValidateAPIBasePath(t *testing.T) {
+	tests := []struct {
+		basePath string
+		want     string
+		wantErr  bool
+	}{
+		{basePath: "/e/abc-123", want: "/e/abc-123"},
+		{basePath: "/e/abc-123/", want: "/e/abc-123"},
+		{basePath: "e/abc-123", wantErr: true},
+		{basePath: "/e//abc", wantErr: true},
+		{basePath: "/e/../api", wantErr: true},
+		{basePath: "/e/abc?api-token=x", wantErr: true},
+		{basePath: "https://managed.example.com/e/abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ValidateAPIBasePath(tt.basePath)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ValidateAPIBasePath(%q) = %q, %v, want %q (error %v)", tt.basePath, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DeleteFilename lists the Dynatrace configs monaco deletes when a service is deleted, read from the project
+const DeleteFilename = "dynatrace/delete.yaml"
+
+// subfolder of the monaco folder the delete file is written to, monaco v1 gets it as the root of its projects
+const MonacoDeleteSubfolder = "delete"
+
+// ErrNoDeleteFile is returned by PrepareDeleteFiles if the project has no delete.yaml
+var ErrNoDeleteFile = errors.New("no " + DeleteFilename + " found")
+
+/**
+ * Fetches the delete.yaml of the deleted service into the monaco folder of the event and replaces the Keptn
+ * placeholders in it, e.g., $SERVICE. Monaco v2 additionally gets the manifest.yaml naming the environments to delete
+ * from. Returns the paths of the delete file and the manifest (empty for monaco v1).
+ */
+func PrepareDeleteFiles(keptnEvent *BaseKeptnEvent, cliVersion string) (string, string, error) {
+	content, err := GetResource(keptnEvent, DeleteFilename)
+	if err != nil {
+		return "", "", err
+	}
+	if content == "" {
+		return "", "", fmt.Errorf("%w for project %s", ErrNoDeleteFile, keptnEvent.Project)
+	}
+
+	folder := GetMonacoFolder(keptnEvent)
+	deleteFolder := filepath.Join(folder, MonacoDeleteSubfolder)
+	if err := os.MkdirAll(deleteFolder, 0700); err != nil {
+		return "", "", err
+	}
+	deleteFile := filepath.Join(deleteFolder, filepath.Base(DeleteFilename))
+	if err := ioutil.WriteFile(deleteFile, []byte(content), WorkFilePermissions); err != nil {
+		return "", "", err
+	}
+	unknown, err := ReplaceMonacoPlaceholders(deleteFolder, keptnEvent)
+	if err != nil {
+		return "", "", err
+	}
+	if len(unknown) > 0 {
+		return "", "", fmt.Errorf("unknown placeholders in %s: %v", DeleteFilename, unknown)
+	}
+
+	if cliVersion != MonacoCLIVersion2 {
+		return deleteFile, "", nil
+	}
+	manifest, err := GetResource(keptnEvent, "dynatrace/"+MonacoManifestFilename)
+	if err != nil {
+		return "", "", err
+	}
+	if manifest == "" {
+		return "", "", fmt.Errorf("monaco %s deletes configs from the environments of the %s, but there is none in project %s", MonacoCLIVersion2, MonacoManifestFilename, keptnEvent.Project)
+	}
+	manifestPath := filepath.Join(folder, MonacoManifestFilename)
+	if err := ioutil.WriteFile(manifestPath, []byte(manifest), WorkFilePermissions); err != nil {
+		return "", "", err
+	}
+	return deleteFile, manifestPath, nil
+}
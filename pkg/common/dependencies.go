@@ -0,0 +1,176 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// monaco references configs of other projects as /project/api/config.id (or .name), the leading / is required
+var crossProjectReferencePattern = regexp.MustCompile(`^/([^/\s]+)/([^/\s]+)/([^/\s]+)\.(id|name)$`)
+
+// Supported ways of dealing with configs referencing projects that are not deployed
+const CrossProjectDepsInclude = "include"
+const CrossProjectDepsFail = "fail"
+
+// returns the monaco projects to deploy: the ones listed in monaco.conf.yaml or the Keptn project
+func GetMonacoProjects(monacoConfigFile *MonacoConfigFile, keptnEvent *BaseKeptnEvent) []string {
+	if len(monacoConfigFile.Projects) == 0 {
+		return []string{keptnEvent.Project}
+	}
+	return monacoConfigFile.Projects
+}
+
+/**
+ * Scans the yaml files of a monaco project and returns the other projects its configs reference
+ */
+func FindProjectDependencies(projectsFolder string, project string) ([]string, error) {
+	dependencies := map[string]bool{}
+
+	err := filepath.Walk(filepath.Join(projectsFolder, project), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (!strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml")) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var parsed interface{}
+		if err := yaml.Unmarshal(content, &parsed); err != nil {
+			return fmt.Errorf("could not parse %s: %v", path, err)
+		}
+		collectProjectReferences(parsed, project, dependencies)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for dependency := range dependencies {
+		result = append(result, dependency)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func collectProjectReferences(value interface{}, project string, dependencies map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		if match := crossProjectReferencePattern.FindStringSubmatch(v); match != nil && match[1] != project {
+			dependencies[match[1]] = true
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectProjectReferences(item, project, dependencies)
+		}
+	case map[interface{}]interface{}:
+		for _, item := range v {
+			collectProjectReferences(item, project, dependencies)
+		}
+	}
+}
+
+/**
+ * Checks whether the configs of the projects to deploy reference projects outside of that list.
+ * With CrossProjectDepsInclude those projects (and their dependencies) are added, with CrossProjectDepsFail an error
+ * names the missing projects. References to projects that don't exist are returned as warnings, they may be values
+ * that only look like references.
+ */
+func ResolveProjectDependencies(projectsFolder string, projects []string, mode string) ([]string, []string, error) {
+	resolved := append([]string{}, projects...)
+	warnings := []string{}
+	deployed := map[string]bool{}
+	for _, project := range projects {
+		deployed[project] = true
+	}
+
+	for i := 0; i < len(resolved); i++ {
+		project := resolved[i]
+		if _, err := os.Stat(filepath.Join(projectsFolder, project)); os.IsNotExist(err) {
+			continue
+		}
+		dependencies, err := FindProjectDependencies(projectsFolder, project)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, dependency := range dependencies {
+			if deployed[dependency] {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(projectsFolder, dependency)); os.IsNotExist(err) {
+				warnings = append(warnings, fmt.Sprintf("project %s references project %s which does not exist", project, dependency))
+				continue
+			}
+			if mode != CrossProjectDepsInclude {
+				return nil, nil, fmt.Errorf("project %s references project %s which is not part of the deployed projects (%s); add it to the projects in %s or set CROSS_PROJECT_DEPS=%s", project, dependency, strings.Join(projects, ", "), MonacoConfigFilename, CrossProjectDepsInclude)
+			}
+			deployed[dependency] = true
+			resolved = append(resolved, dependency)
+		}
+	}
+
+	return resolved, warnings, nil
+}
+
+/**
+ * Splits the projects into groups that can be deployed independently of each other: projects referencing each other,
+ * directly or through other projects of the list, end up in the same group. Groups and the projects within them keep
+ * the order of projects.
+ */
+func GroupIndependentProjects(projectsFolder string, projects []string) ([][]string, error) {
+	// union-find over the indexes of projects
+	parent := make([]int, len(projects))
+	index := map[string]int{}
+	for i, project := range projects {
+		parent[i] = i
+		index[project] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i, project := range projects {
+		if _, err := os.Stat(filepath.Join(projectsFolder, project)); os.IsNotExist(err) {
+			continue
+		}
+		dependencies, err := FindProjectDependencies(projectsFolder, project)
+		if err != nil {
+			return nil, err
+		}
+		for _, dependency := range dependencies {
+			if j, ok := index[dependency]; ok {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := [][]string{}
+	groupOfRoot := map[int]int{}
+	for i, project := range projects {
+		root := find(i)
+		group, ok := groupOfRoot[root]
+		if !ok {
+			group = len(groups)
+			groupOfRoot[root] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], project)
+	}
+	return groups, nil
+}
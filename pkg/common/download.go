@@ -0,0 +1,70 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MonacoVersionPlaceholder in MONACO_DOWNLOAD_URL is replaced by MONACO_VERSION, e.g., v1.5.0
+const MonacoVersionPlaceholder = "$VERSION"
+
+var monacoDownloadClient = &http.Client{Timeout: 5 * time.Minute}
+
+/**
+ * Makes sure the monaco executable exists. If it doesn't, it is downloaded from downloadURL (with $VERSION replaced
+ * by version), checked against the hex encoded SHA-256 checksum and made executable. Returns whether it was downloaded.
+ * A download that doesn't match the checksum is discarded.
+ */
+func EnsureMonacoExecutable(downloadURL string, version string, checksum string) (bool, error) {
+	if FileExists(MonacoExecutable) {
+		return false, nil
+	}
+	if checksum == "" {
+		return false, fmt.Errorf("%s is missing and can't be downloaded without a checksum", MonacoExecutable)
+	}
+
+	downloadURL = strings.Replace(downloadURL, MonacoVersionPlaceholder, version, -1)
+	resp, err := monacoDownloadClient.Get(downloadURL)
+	if err != nil {
+		return false, fmt.Errorf("could not download monaco from %s: %v", downloadURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("could not download monaco from %s: status %d", downloadURL, resp.StatusCode)
+	}
+
+	// download next to the executable so that it only appears once it is complete and verified
+	tmpFile, err := ioutil.TempFile(filepath.Dir(MonacoExecutable), ".monaco-download-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hash), resp.Body); err != nil {
+		tmpFile.Close()
+		return false, fmt.Errorf("could not download monaco from %s: %v", downloadURL, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return false, err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, checksum) {
+		return false, fmt.Errorf("checksum mismatch for monaco downloaded from %s: expected %s, got %s", downloadURL, checksum, actual)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpFile.Name(), MonacoExecutable); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnsureMonacoExecutable(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho monaco\n")
+	hash := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(hash[:])
+
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path != "/releases/v1.5.0/monaco-linux-amd64" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(binary)
+	}))
+	defer server.Close()
+	downloadURL := server.URL + "/releases/$VERSION/monaco-linux-amd64"
+
+	tests := []struct {
+		name               string
+		existing           bool
+		version            string
+		checksum           string
+		expectedDownloaded bool
+		expectedError      string
+	}{
+		{name: "download", version: "v1.5.0", checksum: checksum, expectedDownloaded: true},
+		{name: "upper case checksum", version: "v1.5.0", checksum: strings.ToUpper(checksum), expectedDownloaded: true},
+		{name: "existing executable", existing: true, version: "v1.5.0", checksum: checksum},
+		{name: "checksum mismatch", version: "v1.5.0", checksum: strings.Repeat("0", 64), expectedError: "checksum mismatch"},
+		{name: "unknown version", version: "v0.0.0", checksum: checksum, expectedError: "status 404"},
+		{name: "no checksum", version: "v1.5.0", expectedError: "without a checksum"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "monaco-download")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			originalDir, _ := os.Getwd()
+			os.Chdir(dir)
+			defer os.Chdir(originalDir)
+			if tt.existing {
+				ioutil.WriteFile(MonacoExecutable, []byte("existing"), 0755)
+			}
+			requests = nil
+
+			downloaded, err := EnsureMonacoExecutable(downloadURL, tt.version, tt.checksum)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected an error containing %q, got %v", tt.expectedError, err)
+				}
+				if FileExists(MonacoExecutable) {
+					t.Errorf("expected no monaco executable after a failed download")
+				}
+				if files, _ := ioutil.ReadDir("."); len(files) != 0 {
+					t.Errorf("expected the download to be removed, got %d files", len(files))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if downloaded != tt.expectedDownloaded {
+				t.Errorf("expected downloaded=%v, got %v", tt.expectedDownloaded, downloaded)
+			}
+			if !tt.expectedDownloaded {
+				if len(requests) != 0 {
+					t.Errorf("expected no download of an existing executable, got %v", requests)
+				}
+				return
+			}
+
+			info, err := os.Stat(MonacoExecutable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&0111 == 0 {
+				t.Errorf("expected the downloaded monaco to be executable, got %s", info.Mode())
+			}
+			if content, _ := ioutil.ReadFile(MonacoExecutable); string(content) != string(binary) {
+				t.Errorf("expected the downloaded binary, got %s", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	dynatraceHTTPClientMu  sync.RWMutex
+	dynatraceHTTPClient, _ = NewDynatraceHTTPClient("", "")
+)
+
+/**
+ * Builds the client used for all calls of the monaco-service to the Dynatrace API. Requests go through proxyURL if
+ * it is set, otherwise the standard proxy environment variables are honored. If caCertPath is set, the certificates
+ * of the bundle are trusted in addition to the system ones, e.g., for Dynatrace Managed behind a corporate CA.
+ */
+func NewDynatraceHTTPClient(proxyURL string, caCertPath string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// the Keptn API utils disable the certificate verification of the default transport, never inherit that
+	transport.TLSClientConfig = &tls.Config{}
+
+	if proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL '%s'", proxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if caCertPath != "" {
+		caCerts, err := ioutil.ReadFile(caCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caCertPath)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}, nil
+}
+
+// SetDynatraceHTTPClient replaces the client used for all calls to the Dynatrace API
+func SetDynatraceHTTPClient(client *http.Client) {
+	dynatraceHTTPClientMu.Lock()
+	defer dynatraceHTTPClientMu.Unlock()
+	dynatraceHTTPClient = client
+}
+
+func getDynatraceHTTPClient() *http.Client {
+	dynatraceHTTPClientMu.RLock()
+	defer dynatraceHTTPClientMu.RUnlock()
+	return dynatraceHTTPClient
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// startConnectProxy starts a proxy tunneling CONNECT requests and counts them
+func startConnectProxy(t *testing.T, tunnels *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		atomic.AddInt32(tunnels, 1)
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		go func() {
+			io.Copy(target, client)
+			target.Close()
+		}()
+		go func() {
+			io.Copy(client, target)
+			client.Close()
+		}()
+	}))
+}
+
+func TestDynatraceHTTPClientUsesProxyAndCA(t *testing.T) {
+	dynatrace := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "1000")
+	}))
+	defer dynatrace.Close()
+
+	caFile, err := ioutil.TempFile("", "dt-ca-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: dynatrace.Certificate().Raw})
+	caFile.Close()
+
+	var tunnels int32
+	proxy := startConnectProxy(t, &tunnels)
+	defer proxy.Close()
+
+	defer SetDynatraceHTTPClient(getDynatraceHTTPClient())
+
+	// without the CA bundle the certificate of the environment is not trusted
+	client, err := NewDynatraceHTTPClient(proxy.URL, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	SetDynatraceHTTPClient(client)
+	if _, err := GetDTRateLimit(&DTCredentials{Tenant: dynatrace.URL, ApiToken: "dt0c01.TESTTOKEN"}); err == nil {
+		t.Errorf("expected the untrusted certificate to be rejected")
+	}
+
+	client, err = NewDynatraceHTTPClient(proxy.URL, caFile.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	SetDynatraceHTTPClient(client)
+	rateLimit, err := GetDTRateLimit(&DTCredentials{Tenant: dynatrace.URL, ApiToken: "dt0c01.TESTTOKEN"})
+	if err != nil {
+		t.Fatalf("expected the CA bundle to be trusted: %v", err)
+	}
+	if rateLimit.Limit != 1000 {
+		t.Errorf("expected the response of the environment, got %+v", rateLimit)
+	}
+	if atomic.LoadInt32(&tunnels) != 2 {
+		t.Errorf("expected both requests to go through the proxy, got %d", tunnels)
+	}
+}
+
+func TestNewDynatraceHTTPClientRejectsInvalidSettings(t *testing.T) {
+	if _, err := NewDynatraceHTTPClient("::not a url", ""); err == nil {
+		t.Errorf("expected an error for an invalid proxy URL")
+	}
+	if _, err := NewDynatraceHTTPClient("", "/does/not/exist.pem"); err == nil {
+		t.Errorf("expected an error for a missing CA bundle")
+	}
+}
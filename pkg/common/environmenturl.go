@@ -0,0 +1,175 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Files generated next to the monaco files when the event overrides the Dynatrace environment URL
+const GeneratedEnvironmentsFilename = "environments.generated.yaml"
+const GeneratedManifestFilename = "manifest.generated.yaml"
+
+/**
+ * Validates a Dynatrace environment URL passed in an event: it has to be an https URL without credentials, query or
+ * fragment whose host is one of allowedDomains or below it. An empty allowedDomains allows all hosts.
+ * Returns the URL without trailing slash.
+ */
+func ValidateEnvironmentURL(environmentURL string, allowedDomains []string) (string, error) {
+	parsed, err := url.Parse(environmentURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid environment URL '%s': %v", environmentURL, err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return "", fmt.Errorf("invalid environment URL '%s': must be an absolute https URL", environmentURL)
+	}
+	if parsed.User != nil || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("invalid environment URL '%s': must not contain credentials, a query or a fragment", environmentURL)
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	allowed := len(allowedDomains) == 0
+	for _, domain := range allowedDomains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("invalid environment URL '%s': host %s is not below one of the allowed domains %s", environmentURL, host, strings.Join(allowedDomains, ", "))
+	}
+	return strings.TrimSuffix(parsed.String(), "/"), nil
+}
+
+/**
+ * Pulls the DT_API_TOKEN from the passed secret, or from the environment variable when running locally
+ */
+func GetDTAPIToken(secretName string) (string, error) {
+	token := ""
+	if RunLocal || RunLocalTest {
+		token = os.Getenv("DT_API_TOKEN")
+	} else {
+		kubeAPI, err := GetKubernetesClient()
+		if err != nil {
+			return "", fmt.Errorf("error retrieving Dynatrace API token: could not initialize Kubernetes client: %v", err)
+		}
+		secret, err := kubeAPI.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("error retrieving Dynatrace API token: could not retrieve secret %s: %v", secretName, err)
+		}
+		token = string(secret.Data["DT_API_TOKEN"])
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("no Dynatrace API token found. Need DT_API_TOKEN stored in secret %s", secretName)
+	}
+	return token, nil
+}
+
+/**
+ * Writes a monaco v1 environments file with the single environment name at environmentURL to the folder and returns
+ * its path. The token is read from DT_API_TOKEN like with the default environments file.
+ */
+func WriteEnvironmentsFile(folder string, name string, environmentURL string) (string, error) {
+	environments := yaml.MapSlice{{
+		Key: name,
+		Value: []yaml.MapSlice{
+			{{Key: "name", Value: name}},
+			{{Key: "env-url", Value: environmentURL}},
+			{{Key: "env-token-name", Value: "DT_API_TOKEN"}},
+		},
+	}}
+	content, err := yaml.Marshal(environments)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(folder, GeneratedEnvironmentsFilename)
+	if err := ioutil.WriteFile(path, content, WorkFilePermissions); err != nil {
+		return "", fmt.Errorf("could not write %s: %v", GeneratedEnvironmentsFilename, err)
+	}
+	return path, nil
+}
+
+/**
+ * Writes a copy of the monaco v2 manifest with the URL of all of its environments replaced by environmentURL next to
+ * it, so that the relative project paths still resolve, and returns its path. The token of all environments is read
+ * from DT_API_TOKEN, the variable the token of the event's tokenSecretRef is passed in.
+ */
+func WriteEnvironmentManifest(manifestPath string, environmentURL string) (string, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return "", err
+	}
+	manifest := yaml.MapSlice{}
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", MonacoManifestFilename, err)
+	}
+
+	environments := 0
+	for _, item := range manifest {
+		if item.Key != "environmentGroups" {
+			continue
+		}
+		groups, _ := item.Value.([]interface{})
+		for _, group := range groups {
+			groupSlice, _ := group.(yaml.MapSlice)
+			for _, groupItem := range groupSlice {
+				if groupItem.Key != "environments" {
+					continue
+				}
+				groupEnvironments, _ := groupItem.Value.([]interface{})
+				for i, environment := range groupEnvironments {
+					environmentSlice, _ := environment.(yaml.MapSlice)
+					environmentSlice = setMapSliceValue(environmentSlice, "url", yaml.MapSlice{{Key: "value", Value: environmentURL}})
+					auth, _ := getMapSliceValue(environmentSlice, "auth").(yaml.MapSlice)
+					auth = setMapSliceValue(auth, "token", yaml.MapSlice{{Key: "name", Value: "DT_API_TOKEN"}})
+					groupEnvironments[i] = setMapSliceValue(environmentSlice, "auth", auth)
+					environments++
+				}
+			}
+		}
+	}
+	if environments == 0 {
+		return "", errors.New("the manifest doesn't define environments whose URL could be replaced")
+	}
+
+	generated, err := yaml.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(filepath.Dir(manifestPath), GeneratedManifestFilename)
+	if err := ioutil.WriteFile(path, generated, WorkFilePermissions); err != nil {
+		return "", fmt.Errorf("could not write %s: %v", GeneratedManifestFilename, err)
+	}
+	return path, nil
+}
+
+// getMapSliceValue returns the value of key, nil if the slice doesn't contain it
+func getMapSliceValue(slice yaml.MapSlice, key string) interface{} {
+	for _, item := range slice {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// setMapSliceValue replaces the value of key or appends it
+func setMapSliceValue(slice yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i := range slice {
+		if slice[i].Key == key {
+			slice[i].Value = value
+			return slice
+		}
+	}
+	return append(slice, yaml.MapItem{Key: key, Value: value})
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	keptnmodels "github.com/keptn/go-utils/pkg/api/models"
+)
+
+// ExportResourceFolder is the folder of the config repo the configs exported after a deployment are written to
+const ExportResourceFolder = "dynatrace/export/"
+
+// subfolder of the monaco folder the configs are exported to, one folder per environment
+const MonacoExportSubfolder = "export"
+
+/**
+ * Returns the content of all files below exportDir keyed by their resource URI, i.e., their path relative to
+ * exportDir below ExportResourceFolder
+ */
+func CollectExportedResources(exportDir string) (map[string]string, error) {
+	resources := map[string]string{}
+	err := filepath.Walk(exportDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(exportDir, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		resources[ExportResourceFolder+filepath.ToSlash(relativePath)] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the exported configs: %v", err)
+	}
+	return resources, nil
+}
+
+/**
+ * Uploads the resources keyed by their resource URI to the service of keptnEvent in a single commit. Like
+ * UploadKeptnResource they are written to the local disk when running locally.
+ */
+func UploadKeptnResources(resources map[string]string, keptnEvent *BaseKeptnEvent) error {
+	resourceURIs := []string{}
+	for resourceURI := range resources {
+		resourceURIs = append(resourceURIs, resourceURI)
+	}
+	sort.Strings(resourceURIs)
+
+	if RunLocal || RunLocalTest {
+		for _, resourceURI := range resourceURIs {
+			if err := os.MkdirAll(filepath.Dir(resourceURI), 0755); err != nil {
+				return fmt.Errorf("Couldnt create local folder for %s: %v", resourceURI, err)
+			}
+			if err := ioutil.WriteFile(resourceURI, []byte(resources[resourceURI]), 0644); err != nil {
+				return fmt.Errorf("Couldnt write local file %s: %v", resourceURI, err)
+			}
+		}
+		log.Printf("Local files written: %d", len(resourceURIs))
+		return nil
+	}
+
+	uploads := []*keptnmodels.Resource{}
+	for i := range resourceURIs {
+		uploads = append(uploads, &keptnmodels.Resource{ResourceContent: resources[resourceURIs[i]], ResourceURI: &resourceURIs[i]})
+	}
+	resourceHandler := newResourceHandler("")
+	if _, err := resourceHandler.CreateResources(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, uploads); err != nil {
+		return fmt.Errorf("Couldnt upload %d remote resources: %s", len(uploads), *err.Message)
+	}
+	log.Printf("Uploaded %d files", len(uploads))
+	return nil
+}
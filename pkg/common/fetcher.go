@@ -0,0 +1,171 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
+)
+
+// Sources of the monaco files, selected via RESOURCE_SOURCE
+const ResourceSourceKeptn = "keptn"
+const ResourceSourceHTTP = "http"
+
+// ResourceIndexFilename lists the resources of an HTTP resource source, one path per line
+const ResourceIndexFilename = "index.txt"
+
+// ErrResourceNotFound is returned by ResourceFetcher.Fetch if there is no resource at the path
+var ErrResourceNotFound = errors.New("resource not found")
+
+// ResourceFetcher reads the monaco files of an event from a config source
+type ResourceFetcher interface {
+	// Fetch returns the content of the resource at path, e.g., dynatrace/monaco.zip
+	Fetch(path string) ([]byte, error)
+	// List returns the paths of all resources below prefix, e.g., /dynatrace/projects/
+	List(prefix string) ([]string, error)
+}
+
+var resourceSource = ResourceSourceKeptn
+var resourceSourceURL = ""
+
+/**
+ * Configures where the monaco files are fetched from: the Keptn configuration service (keptn) or a web server (http)
+ * below sourceURL. sourceURL may contain the Keptn placeholders, e.g., $PROJECT or $STAGE.
+ */
+func SetResourceSource(source string, sourceURL string) error {
+	switch source {
+	case ResourceSourceKeptn:
+	case ResourceSourceHTTP:
+		if sourceURL == "" {
+			return fmt.Errorf("resource source %s requires a URL", ResourceSourceHTTP)
+		}
+	default:
+		return fmt.Errorf("unsupported resource source '%s', must be one of %s, %s", source, ResourceSourceKeptn, ResourceSourceHTTP)
+	}
+	resourceSource = source
+	resourceSourceURL = sourceURL
+	return nil
+}
+
+// NewResourceFetcher returns the fetcher of the configured resource source for the event, cached if configured
+func NewResourceFetcher(keptnEvent *BaseKeptnEvent) ResourceFetcher {
+	var fetcher ResourceFetcher = &keptnResourceFetcher{keptnEvent: keptnEvent}
+	source := ResourceSourceKeptn
+	if resourceSource == ResourceSourceHTTP {
+		httpFetcher := &httpResourceFetcher{
+			baseURL: strings.TrimSuffix(ReplaceKeptnPlaceholders(resourceSourceURL, keptnEvent), "/"),
+			client:  &http.Client{Timeout: 30 * time.Second},
+		}
+		fetcher = httpFetcher
+		source = httpFetcher.baseURL
+	}
+
+	if resourceCache != nil {
+		return &cachingResourceFetcher{cache: resourceCache, key: resourceCacheKey(keptnEvent, source), next: fetcher}
+	}
+	return fetcher
+}
+
+/**
+ * Fetches a resource of the event from the configured resource source, returns an empty string if it doesn't exist
+ */
+func GetResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, error) {
+	content, err := NewResourceFetcher(keptnEvent).Fetch(resourceURI)
+	if errors.Is(err, ErrResourceNotFound) {
+		return "", nil
+	}
+	return string(content), err
+}
+
+// keptnResourceFetcher reads resources from the configuration service or, when running locally, from the disk
+type keptnResourceFetcher struct {
+	keptnEvent *BaseKeptnEvent
+}
+
+func (f *keptnResourceFetcher) Fetch(path string) ([]byte, error) {
+	content, err := GetKeptnResource(f.keptnEvent, path)
+	if err != nil && !errors.Is(err, keptnapi.ResourceNotFoundError) {
+		return nil, err
+	}
+	if content == "" {
+		return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, path)
+	}
+	return []byte(content), nil
+}
+
+func (f *keptnResourceFetcher) List(prefix string) ([]string, error) {
+	paths := []string{}
+	if RunLocal {
+		folder := strings.TrimPrefix(prefix, "/")
+		if !FileExists(folder) {
+			return paths, nil
+		}
+		err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				paths = append(paths, filepath.ToSlash(path))
+			}
+			return err
+		})
+		return paths, err
+	}
+
+	// service and project resources can't be listed yet, see GetAllKeptnResources
+	resources, err := newResourceHandler(f.keptnEvent.ConfigRef).GetAllStageResources(f.keptnEvent.Project, f.keptnEvent.Stage)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		if resource.ResourceURI != nil && strings.Contains(*resource.ResourceURI, prefix) {
+			paths = append(paths, *resource.ResourceURI)
+		}
+	}
+	return paths, nil
+}
+
+// httpResourceFetcher reads resources from a web server, e.g., a bucket of an object storage, that lists them in ResourceIndexFilename
+type httpResourceFetcher struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (f *httpResourceFetcher) Fetch(path string) ([]byte, error) {
+	resp, err := f.client.Get(f.baseURL + "/" + strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch %s: %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (f *httpResourceFetcher) List(prefix string) ([]string, error) {
+	index, err := f.Fetch(ResourceIndexFilename)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the resources: %w", err)
+	}
+
+	paths := []string{}
+	normalizedPrefix := strings.TrimPrefix(prefix, "/")
+	scanner := bufio.NewScanner(bytes.NewReader(index))
+	for scanner.Scan() {
+		path := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "/")
+		if path != "" && strings.HasPrefix(path, normalizedPrefix) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, scanner.Err()
+}
@@ -0,0 +1,218 @@
+package common
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeptnResourceFetcher(t *testing.T) {
+	resources := map[string]string{
+		"/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml": "config:\n",
+		"/dynatrace/monaco.conf.yaml":                         "dtCreds: dynatrace",
+	}
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stage/dev/resource") {
+			fmt.Fprint(w, `{"resources":[{"resourceURI":"/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml"},{"resourceURI":"/dynatrace/monaco.conf.yaml"}],"totalCount":2}`)
+			return
+		}
+		// only stage resources exist
+		if strings.Contains(r.URL.Path, "/service/") || !strings.Contains(r.URL.Path, "/stage/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resourceURI, _ := url.PathUnescape(r.URL.EscapedPath()[strings.Index(r.URL.EscapedPath(), "/resource/")+len("/resource/"):])
+		content, ok := resources["/"+strings.TrimPrefix(resourceURI, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"resourceURI":"%s","resourceContent":"%s"}`, resourceURI, base64.StdEncoding.EncodeToString([]byte(content)))
+	}))
+	defer configurationService.Close()
+
+	defer os.Setenv("CONFIGURATION_SERVICE", os.Getenv("CONFIGURATION_SERVICE"))
+	os.Setenv("CONFIGURATION_SERVICE", configurationService.URL)
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	fetcher := NewResourceFetcher(&BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"})
+	paths, err := fetcher.List("/dynatrace/projects/")
+	if err != nil || !reflect.DeepEqual(paths, []string{"/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml"}) {
+		t.Errorf("List() = %v, %v", paths, err)
+	}
+	content, err := fetcher.Fetch("/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml")
+	if err != nil || string(content) != "config:\n" {
+		t.Errorf("Fetch() = %q, %v", content, err)
+	}
+	if _, err := fetcher.Fetch("dynatrace/monaco.zip"); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("Fetch() of a missing resource error = %v, want ErrResourceNotFound", err)
+	}
+}
+
+func TestKeptnResourceFetcherRetries(t *testing.T) {
+	defer func(retries int, backoff time.Duration) { fetchMaxRetries, fetchRetryBackoff = retries, backoff }(fetchMaxRetries, fetchRetryBackoff)
+	fetchMaxRetries, fetchRetryBackoff = 3, time.Millisecond
+
+	var requests int32
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&requests, 1)
+		switch {
+		case strings.Contains(r.URL.Path, "monaco.zip"):
+			w.WriteHeader(http.StatusNotFound)
+		case strings.Contains(r.URL.Path, "broken.yaml"):
+			w.WriteHeader(http.StatusBadGateway)
+		case attempt <= 2:
+			// the configuration service is unavailable for the first two reads
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintf(w, `{"resourceURI":"/dynatrace/monaco.conf.yaml","resourceContent":"%s"}`, base64.StdEncoding.EncodeToString([]byte("dtCreds: dynatrace")))
+		}
+	}))
+	defer configurationService.Close()
+
+	defer os.Setenv("CONFIGURATION_SERVICE", os.Getenv("CONFIGURATION_SERVICE"))
+	os.Setenv("CONFIGURATION_SERVICE", configurationService.URL)
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	fetcher := NewResourceFetcher(&BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"})
+	content, err := fetcher.Fetch("dynatrace/monaco.conf.yaml")
+	if err != nil || string(content) != "dtCreds: dynatrace" {
+		t.Errorf("Fetch() = %q, %v", content, err)
+	}
+	if requests != 3 {
+		t.Errorf("expected the read to succeed with the third request, got %d requests", requests)
+	}
+
+	// the service, stage and project level are read once each
+	requests = 0
+	if _, err := fetcher.Fetch("dynatrace/monaco.zip"); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("Fetch() of a missing resource error = %v, want ErrResourceNotFound", err)
+	}
+	if requests != 3 {
+		t.Errorf("expected missing resources not to be retried, got %d requests", requests)
+	}
+
+	requests = 0
+	if _, err := fetcher.Fetch("dynatrace/broken.yaml"); err == nil || errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("expected reads failing after all retries to fail, got %v", err)
+	}
+	if requests != 3*4 {
+		t.Errorf("expected every level to be read once and retried 3 times, got %d requests", requests)
+	}
+}
+
+func TestHTTPResourceFetcher(t *testing.T) {
+	files := map[string]string{
+		"/sockshop/dev/index.txt":                                          "dynatrace/monaco.conf.yaml\n/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml\ndynatrace/projects/sockshop/auto-tag/tag.json\n",
+		"/sockshop/dev/dynatrace/monaco.conf.yaml":                         "dtCreds: dynatrace-http",
+		"/sockshop/dev/dynatrace/projects/sockshop/auto-tag/auto-tag.yaml": "config:\n  - tag: \"tag.json\"\n",
+		"/sockshop/dev/dynatrace/projects/sockshop/auto-tag/tag.json":      "{}",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sockshop/dev/dynatrace/broken.yaml" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	defer func(source string, sourceURL string) { resourceSource, resourceSourceURL = source, sourceURL }(resourceSource, resourceSourceURL)
+	if err := SetResourceSource(ResourceSourceHTTP, server.URL+"/$PROJECT/$STAGE/"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "http-source"}
+	if config, err := GetMonacoConfig(keptnEvent); err != nil || config == nil || config.DtCreds != "dynatrace-http" {
+		t.Errorf("expected monaco.conf.yaml of the http source, got %+v (%v)", config, err)
+	}
+	if content, err := GetResource(keptnEvent, "dynatrace/monaco.zip"); content != "" || err != nil {
+		t.Errorf("expected no content for a missing resource, got %q (%v)", content, err)
+	}
+	if _, err := GetResource(keptnEvent, "dynatrace/broken.yaml"); err == nil {
+		t.Error("expected an error if the http source fails")
+	}
+
+	workDir, err := ioutil.TempDir("", "monaco-http-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	os.Chdir(workDir)
+
+	if err := DownloadAllFilesFromSubfolder(keptnEvent, "/dynatrace/projects/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, file := range []string{"sockshop/auto-tag/auto-tag.yaml", "sockshop/auto-tag/tag.json"} {
+		if !FileExists(GetTempMonacoFolder(keptnEvent) + "/" + MonacoProjectsSubfolder + "/" + file) {
+			t.Errorf("expected %s to be downloaded from the http source", file)
+		}
+	}
+
+	if err := SetResourceSource(ResourceSourceHTTP, ""); err == nil {
+		t.Error("expected an error for the http source without URL")
+	}
+	if err := SetResourceSource("s3", ""); err == nil {
+		t.Error("expected an error for an unsupported source")
+	}
+}
+
+func TestDownloadAllFilesFromSubfolderRejectsPathsOutsideOfFolder(t *testing.T) {
+	for _, resourcePath := range []string{"dynatrace/projects/../../../escaped.json", "/dynatrace/projects//tmp/escaped.json"} {
+		t.Run(resourcePath, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/index.txt") {
+					fmt.Fprintln(w, resourcePath)
+					return
+				}
+				fmt.Fprint(w, "{}")
+			}))
+			defer server.Close()
+
+			defer func(source string, sourceURL string) { resourceSource, resourceSourceURL = source, sourceURL }(resourceSource, resourceSourceURL)
+			if err := SetResourceSource(ResourceSourceHTTP, server.URL+"/"); err != nil {
+				t.Fatal(err)
+			}
+			defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+			RunLocal = false
+
+			workDir, err := ioutil.TempDir("", "monaco-http-source")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(workDir)
+			originalDir, _ := os.Getwd()
+			defer os.Chdir(originalDir)
+			os.Chdir(workDir)
+
+			keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "crafted-index"}
+			if err := DownloadAllFilesFromSubfolder(keptnEvent, "/dynatrace/projects/"); err == nil {
+				t.Error("expected an error for a resource outside of the projects folder")
+			}
+			if FileExists("tmp/escaped.json") || FileExists("/tmp/escaped.json") {
+				t.Error("expected nothing to be written outside of the projects folder")
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MonacoEnvironmentsFile is the environments file passed to the monaco v1 CLI
+const MonacoEnvironmentsFile = "/environments.yaml"
+
+// RedactedSecret replaces secrets in everything reported about a run
+const RedactedSecret = "****"
+
+// references to environment variables in environments.yaml and manifest.yaml, e.g., {{ .Env.DT_ENVIRONMENT_URL }}
+var monacoEnvReferencePattern = regexp.MustCompile(`\{\{\s*\.Env\.(\w+)\s*\}\}`)
+
+// DeploymentManifest is what monaco is told to deploy against which Dynatrace environment, with secrets redacted
+type DeploymentManifest struct {
+	Environment string   `json:"environment"`
+	Command     []string `json:"command"`
+	// environments.yaml (v1) or manifest.yaml (v2) with the environment variables monaco resolves filled in
+	Files map[string]string `json:"files,omitempty"`
+}
+
+/**
+ * Renders the deployment manifest of a monaco run with the passed options. The Dynatrace API token, the OAuth client
+ * secret of account deployments and everything matching one of the secret patterns is replaced by RedactedSecret.
+ */
+func RenderDeploymentManifest(dtCredentials *DTCredentials, keptnEvent *BaseKeptnEvent, options MonacoCommandOptions, secretPatterns []SecretPattern) (*DeploymentManifest, error) {
+	// rendering doesn't execute monaco, the files don't need to be handed over to its user
+	options.User = nil
+	cmd, cleanup, err := NewMonacoCommand(context.Background(), dtCredentials, keptnEvent, options)
+	if err != nil {
+		return nil, err
+	}
+	cleanup()
+
+	redact := func(content string) string {
+		return RedactSecrets(content, secretPatterns, dtCredentials.ApiToken, options.Account.Secret())
+	}
+
+	manifest := &DeploymentManifest{
+		Environment: dtCredentials.Tenant,
+		Files:       map[string]string{},
+	}
+	for _, arg := range cmd.Args {
+		manifest.Command = append(manifest.Command, redact(arg))
+	}
+
+	manifestFile := MonacoEnvironmentsFile
+	if options.EnvironmentsFile != "" {
+		manifestFile = options.EnvironmentsFile
+	}
+	if options.CLIVersion == MonacoCLIVersion2 {
+		manifestFile = options.ManifestPath
+	}
+	content, err := ioutil.ReadFile(manifestFile)
+	if err == nil {
+		manifest.Files[filepath.Base(manifestFile)] = redact(renderMonacoEnvReferences(string(content), cmd.Env))
+	} else if manifestFile != MonacoEnvironmentsFile {
+		// the environments file is baked into the image and missing when running locally
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// fills in the environment variables referenced like monaco does, unknown variables are left as they are
+func renderMonacoEnvReferences(content string, environ []string) string {
+	values := map[string]string{}
+	for _, variable := range environ {
+		if i := strings.Index(variable, "="); i > 0 {
+			values[variable[:i]] = variable[i+1:]
+		}
+	}
+
+	return monacoEnvReferencePattern.ReplaceAllStringFunc(content, func(reference string) string {
+		if value, ok := values[monacoEnvReferencePattern.FindStringSubmatch(reference)[1]]; ok {
+			return value
+		}
+		return reference
+	})
+}
+
+// monacoManifestProjects is the part of a monaco v2 manifest.yaml listing its projects
+type monacoManifestProjects struct {
+	Projects []struct {
+		Name string `yaml:"name"`
+	} `yaml:"projects"`
+}
+
+/**
+ * Returns the names of the projects defined in the monaco v2 manifest, sorted
+ */
+func GetManifestProjects(manifestPath string) ([]string, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := monacoManifestProjects{}
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", MonacoManifestFilename, err)
+	}
+
+	projects := []string{}
+	for _, project := range manifest.Projects {
+		if project.Name != "" {
+			projects = append(projects, project.Name)
+		}
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// monacoManifestEnvironments are the environment groups of a monaco v2 manifest
+type monacoManifestEnvironments struct {
+	EnvironmentGroups []struct {
+		Name         string `yaml:"name"`
+		Environments []struct {
+			Name string `yaml:"name"`
+		} `yaml:"environments"`
+	} `yaml:"environmentGroups"`
+}
+
+/**
+ * Returns the names of the environments defined in the monaco v2 manifest in the order of the manifest, only the ones
+ * of group unless it is empty
+ */
+func GetManifestEnvironments(manifestPath string, group string) ([]string, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := monacoManifestEnvironments{}
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", MonacoManifestFilename, err)
+	}
+
+	environments := []string{}
+	for _, environmentGroup := range manifest.EnvironmentGroups {
+		if group != "" && environmentGroup.Name != group {
+			continue
+		}
+		for _, environment := range environmentGroup.Environments {
+			if environment.Name != "" {
+				environments = append(environments, environment.Name)
+			}
+		}
+	}
+	return environments, nil
+}
+
+// IsEnvironmentPattern returns whether environment is a glob matching several environments, e.g., prod-*
+func IsEnvironmentPattern(environment string) bool {
+	return strings.ContainsAny(environment, "*?[")
+}
+
+/**
+ * Returns the environments of the monaco v2 manifest matching the glob pattern in the order of the manifest, see
+ * path.Match for the syntax. The error lists the environments of the manifest if none matches.
+ */
+func ExpandEnvironmentPattern(manifestPath string, pattern string) ([]string, error) {
+	available, err := GetManifestEnvironments(manifestPath, "")
+	if err != nil {
+		return nil, err
+	}
+
+	environments := []string{}
+	for _, environment := range available {
+		matches, err := path.Match(pattern, environment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid environment pattern '%s': %v", pattern, err)
+		}
+		if matches {
+			environments = append(environments, environment)
+		}
+	}
+	if len(environments) == 0 {
+		return nil, fmt.Errorf("no environment of the %s matches '%s', available environments: %s", MonacoManifestFilename, pattern, strings.Join(available, ", "))
+	}
+	return environments, nil
+}
+
+/**
+ * Parses the comma separated projects of subset and verifies that the monaco v2 manifest defines all of them.
+ * The error lists the projects of the manifest.
+ */
+func ValidateProjectSubset(manifestPath string, subset string) ([]string, error) {
+	available, err := GetManifestProjects(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defined := map[string]bool{}
+	for _, project := range available {
+		defined[project] = true
+	}
+
+	projects := []string{}
+	unknown := []string{}
+	for _, project := range strings.Split(subset, ",") {
+		project = strings.TrimSpace(project)
+		if project == "" {
+			continue
+		}
+		if !defined[project] {
+			unknown = append(unknown, project)
+		}
+		projects = append(projects, project)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("the projects %s are not defined in %s, available projects: %s", strings.Join(unknown, ", "), MonacoManifestFilename, strings.Join(available, ", "))
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("no projects selected, available projects: %s", strings.Join(available, ", "))
+	}
+	return projects, nil
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configMountPath is the directory the monaco files are mounted to, e.g., from a ConfigMap, see CONFIG_MOUNT_PATH
+var configMountPath = ""
+
+// SetConfigMountPath makes PrepareFiles take the monaco files from path instead of fetching them, empty disables it
+func SetConfigMountPath(path string) {
+	configMountPath = path
+}
+
+/**
+ * Copies the monaco files mounted at mountPath to the monaco folder of the event, so they can be modified (e.g., by
+ * replacing the placeholders) without touching the read-only mount. Returns false if mountPath is empty or doesn't exist.
+ * The hidden ..data folders of ConfigMap volumes are skipped, the symlinks pointing into them are followed.
+ */
+func CopyMountedConfig(keptnEvent *BaseKeptnEvent, mountPath string) (bool, error) {
+	if mountPath == "" {
+		return false, nil
+	}
+	if info, err := os.Stat(mountPath); err != nil || !info.IsDir() {
+		return false, nil
+	}
+	return true, copyMountedDir(mountPath, GetMonacoFolder(keptnEvent), true)
+}
+
+// copyMountedDir copies src to dest, files that already exist in dest are only replaced if overwrite is set
+func copyMountedDir(src string, dest string, overwrite bool) error {
+	if err := os.MkdirAll(dest, WorkDirPermissions); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+		srcPath := filepath.Join(src, entry.Name())
+		destPath := filepath.Join(dest, entry.Name())
+
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			err = copyMountedDir(srcPath, destPath, overwrite)
+		} else if overwrite || !FileExists(destPath) {
+			err = copyMountedFile(srcPath, destPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyMountedFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
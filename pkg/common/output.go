@@ -0,0 +1,202 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lines of the monaco output naming the configs it deploys and the configs that failed
+var monacoConfigDeployingPattern = regexp.MustCompile(`Deploying config (\S+)`)
+var monacoConfigFailedPattern = regexp.MustCompile(`(?i)failed to (?:upload|deploy|validate) config (\S+?):?(?:\s|$)`)
+
+// summary lines at the end of a monaco run, e.g., "12 configs deployed, 1 config failed", and the environment it deploys to
+var monacoSummaryAppliedPattern = regexp.MustCompile(`(?i)(\d+)\s+configs?\s+(?:were\s+|have\s+been\s+)?(?:deployed|applied)`)
+var monacoSummaryFailedPattern = regexp.MustCompile(`(?i)(\d+)\s+configs?\s+(?:have\s+)?failed`)
+var monacoEnvironmentPattern = regexp.MustCompile(`(?i)(?:processing|deploying to)\s+environment\s+'?([\w-]+)`)
+
+// DefaultNoChangesPattern matches the output of monaco runs that found everything already up-to-date
+var DefaultNoChangesPattern = regexp.MustCompile(`(?i)(no changes|already up[- ]to[- ]date|nothing to deploy)`)
+
+// MonacoConfigResults counts the configs monaco deployed successfully and the ones that failed
+type MonacoConfigResults struct {
+	Succeeded     int      `json:"succeeded"`
+	Failed        int      `json:"failed"`
+	FailedConfigs []string `json:"failedConfigs,omitempty"`
+}
+
+/**
+ * Parses the output of a monaco run with --continue-on-error: every config is announced with "Deploying config <id>",
+ * the ones that could not be deployed are reported with "Failed to upload|deploy|validate config <id>"
+ */
+func ParseMonacoConfigResults(output string) *MonacoConfigResults {
+	configs := map[string]bool{}
+	for _, match := range monacoConfigDeployingPattern.FindAllStringSubmatch(output, -1) {
+		configs[match[1]] = true
+	}
+
+	failed := map[string]bool{}
+	for _, match := range monacoConfigFailedPattern.FindAllStringSubmatch(output, -1) {
+		failed[match[1]] = true
+		configs[match[1]] = true
+	}
+
+	results := &MonacoConfigResults{
+		Succeeded: len(configs) - len(failed),
+		Failed:    len(failed),
+	}
+	for config := range failed {
+		results.FailedConfigs = append(results.FailedConfigs, config)
+	}
+	sort.Strings(results.FailedConfigs)
+	return results
+}
+
+// MonacoSummary is the machine-readable result of a monaco run
+type MonacoSummary struct {
+	ConfigsApplied int
+	ConfigsFailed  int
+	// name of the environment in the monaco environments file, empty if monaco didn't report it
+	Environment string
+}
+
+/**
+ * Parses the summary of a monaco run: the counts of the summary lines ("12 configs deployed", "1 config failed") if
+ * monaco printed them, otherwise the configs announced one by one (see ParseMonacoConfigResults)
+ */
+func ParseMonacoSummary(output string) *MonacoSummary {
+	summary := &MonacoSummary{}
+	if match := monacoEnvironmentPattern.FindStringSubmatch(output); match != nil {
+		summary.Environment = match[1]
+	}
+
+	applied := monacoSummaryAppliedPattern.FindAllStringSubmatch(output, -1)
+	failed := monacoSummaryFailedPattern.FindAllStringSubmatch(output, -1)
+	if len(applied) == 0 && len(failed) == 0 {
+		results := ParseMonacoConfigResults(output)
+		summary.ConfigsApplied = results.Succeeded
+		summary.ConfigsFailed = results.Failed
+		return summary
+	}
+	// the last summary line wins, e.g., after the dry run output
+	if len(applied) > 0 {
+		summary.ConfigsApplied, _ = strconv.Atoi(applied[len(applied)-1][1])
+	}
+	if len(failed) > 0 {
+		summary.ConfigsFailed, _ = strconv.Atoi(failed[len(failed)-1][1])
+	}
+	return summary
+}
+
+// Actions of ConfigChange, monaco only tells whether a config gets created, updated or deleted if it logs it, configs
+// it just validates or deploys get ConfigActionDeploy
+const ConfigActionDeploy = "deploy"
+const ConfigActionCreate = "create"
+const ConfigActionUpdate = "update"
+const ConfigActionDelete = "delete"
+const ConfigActionUnchanged = "unchanged"
+
+// lines of the monaco (dry run) output announcing what happens to a config
+var monacoPlanDeployPattern = regexp.MustCompile(`(?i)\b(?:deploying|validating) config (\S+)(?: of api (\S+))?`)
+var monacoPlanChangePattern = regexp.MustCompile(`(?i)\b(creat|updat|delet)(?:e|es|ed|ing)\s+(config\s+)?(\S+)`)
+var monacoPlanUnchangedPattern = regexp.MustCompile(`(?i)\bconfig (\S+) is (?:already )?up[- ]to[- ]date`)
+
+// ConfigChange is a config a monaco run deploys and what happens to it
+type ConfigChange struct {
+	// API of the config, e.g., dashboard or auto-tag, empty if monaco didn't name it
+	Type   string `json:"type,omitempty"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+/**
+ * Parses the configs announced in the output of a monaco (dry) run, in the order monaco announced them:
+ * "Deploying config <type>/<name>", "Validating config <name> of api <type>", "Created|Updated|Deleted [config]
+ * <type>/<name>" and "Config <type>/<name> is already up-to-date". Configs can be identified as <type>/<name> or
+ * <project>:<type>:<name>; the most specific action logged for a config wins.
+ */
+func ParseMonacoPlan(output string) []ConfigChange {
+	changes := []ConfigChange{}
+	indexes := map[string]int{}
+	record := func(id string, configType string, action string) {
+		change := newConfigChange(id, configType, action)
+		key := change.Type + "/" + change.Name
+		if i, ok := indexes[key]; ok {
+			if action != ConfigActionDeploy {
+				changes[i].Action = action
+			}
+			return
+		}
+		indexes[key] = len(changes)
+		changes = append(changes, change)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if match := monacoPlanUnchangedPattern.FindStringSubmatch(line); match != nil {
+			record(match[1], "", ConfigActionUnchanged)
+		} else if match := monacoPlanDeployPattern.FindStringSubmatch(line); match != nil {
+			record(match[1], match[2], ConfigActionDeploy)
+		} else if match := monacoPlanChangePattern.FindStringSubmatch(line); match != nil {
+			// without the config keyword only identifiers naming the type count, e.g., not "Updated 3 configs"
+			if match[2] == "" && !strings.ContainsAny(match[3], "/:") {
+				continue
+			}
+			record(match[3], "", strings.ToLower(match[1])+"e")
+		}
+	}
+	return changes
+}
+
+// newConfigChange splits the config identifier of the monaco output into its type and name
+func newConfigChange(id string, configType string, action string) ConfigChange {
+	id = strings.Trim(id, `'"[]().,;:`)
+	parts := strings.FieldsFunc(id, func(r rune) bool { return r == '/' || r == ':' })
+	change := ConfigChange{Type: strings.Trim(configType, `'"().,;:`), Name: id, Action: action}
+	if len(parts) >= 2 {
+		change.Type = parts[len(parts)-2]
+		change.Name = parts[len(parts)-1]
+	}
+	return change
+}
+
+/**
+ * Parses WARNING_PATTERNS: one regular expression per line, empty lines are ignored.
+ * Returns no patterns if there is none, which disables the warning classification.
+ */
+func ParseWarningPatterns(patterns string) ([]*regexp.Regexp, error) {
+	result := []*regexp.Regexp{}
+	for _, pattern := range strings.Split(patterns, "\n") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid warning pattern '%s': %v", pattern, err)
+		}
+		result = append(result, compiled)
+	}
+	return result, nil
+}
+
+/**
+ * Returns the lines of the output of a successful monaco run matching one of the warning patterns. Returns nothing
+ * if monaco reported failed configs (see ParseMonacoConfigResults).
+ */
+func ParseMonacoWarnings(output string, patterns []*regexp.Regexp) []string {
+	if ParseMonacoConfigResults(output).Failed > 0 {
+		return nil
+	}
+	var warnings []string
+	for _, line := range strings.Split(output, "\n") {
+		for _, pattern := range patterns {
+			if pattern.MatchString(line) {
+				warnings = append(warnings, strings.TrimSpace(line))
+				break
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMonacoSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected MonacoSummary
+	}{
+		{
+			name:     "summary lines",
+			output:   "Processing environment production...\nDeploying config carts\nDeploying config orders\n12 configs deployed, 1 config failed\n",
+			expected: MonacoSummary{ConfigsApplied: 12, ConfigsFailed: 1, Environment: "production"},
+		},
+		{
+			name:     "last summary wins",
+			output:   "Deploying to environment 'dev-eu'\n3 configs applied\n5 configs have been deployed\n",
+			expected: MonacoSummary{ConfigsApplied: 5, Environment: "dev-eu"},
+		},
+		{
+			name:     "configs announced one by one",
+			output:   "Deploying config carts\nDeploying config orders\nFailed to upload config orders: 400\n",
+			expected: MonacoSummary{ConfigsApplied: 1, ConfigsFailed: 1},
+		},
+		{
+			name:     "no output",
+			expected: MonacoSummary{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if summary := ParseMonacoSummary(tt.output); *summary != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *summary)
+			}
+		})
+	}
+}
+
+func TestParseMonacoPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected []ConfigChange
+	}{
+		{
+			name: "monaco v1 dry run",
+			output: `2021-03-02 10:11:12 INFO  Processing environment dev...
+2021-03-02 10:11:12 INFO  	Processing project sockshop...
+2021-03-02 10:11:12 INFO  		Validating config carts of api auto-tag
+2021-03-02 10:11:12 INFO  		Validating config carts-overview of api dashboard
+2021-03-02 10:11:13 INFO  Validation finished without errors
+`,
+			expected: []ConfigChange{
+				{Type: "auto-tag", Name: "carts", Action: ConfigActionDeploy},
+				{Type: "dashboard", Name: "carts-overview", Action: ConfigActionDeploy},
+			},
+		},
+		{
+			name: "actions logged per config",
+			output: `INFO Deploying config auto-tag/tagging
+INFO Updated auto-tag/tagging
+INFO Deploying config management-zone/zone
+INFO Config management-zone/zone is already up-to-date
+INFO Would create config alerting-profile/profile
+INFO Deleting config 'sockshop:dashboard:old-dashboard'
+INFO Updated 3 configs
+`,
+			expected: []ConfigChange{
+				{Type: "auto-tag", Name: "tagging", Action: ConfigActionUpdate},
+				{Type: "management-zone", Name: "zone", Action: ConfigActionUnchanged},
+				{Type: "alerting-profile", Name: "profile", Action: ConfigActionCreate},
+				{Type: "dashboard", Name: "old-dashboard", Action: ConfigActionDelete},
+			},
+		},
+		{
+			name:     "no configs",
+			output:   "Nothing to deploy\n",
+			expected: []ConfigChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if changes := ParseMonacoPlan(tt.output); !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholders in monaco files, e.g., $PROJECT or $LABEL.owner
+var monacoPlaceholderPattern = regexp.MustCompile(`\$([A-Z][A-Z0-9_]*(?:\.[A-Za-z0-9_-]+)?)`)
+
+// characters of label values that would change the structure of the yaml or json file they are substituted into
+const unsafeLabelCharacters = "\":\n\r"
+
+/**
+ * Returns the values of the placeholders that can be used in monaco files:
+ * $PROJECT, $STAGE, $SERVICE, $CONTEXT, $IMAGE, $TAG and $LABEL.XXXX for the label XXXX
+ */
+func getMonacoPlaceholders(keptnEvent *BaseKeptnEvent) map[string]string {
+	placeholders := map[string]string{
+		"PROJECT": keptnEvent.Project,
+		"STAGE":   keptnEvent.Stage,
+		"SERVICE": keptnEvent.Service,
+		"CONTEXT": keptnEvent.Context,
+		"IMAGE":   keptnEvent.Image,
+		"TAG":     keptnEvent.Tag,
+	}
+	for key, value := range keptnEvent.Labels {
+		placeholders["LABEL."+key] = value
+	}
+	return placeholders
+}
+
+/**
+ * Replaces the Keptn placeholders (see getMonacoPlaceholders) in all yaml and json files below monacoFolder.
+ * Unlike ReplaceKeptnPlaceholders the values are not URL escaped. Unknown placeholders are left intact and returned.
+ * Labels are set by whoever triggers the event, a referenced label containing ", : or a line break is an error.
+ */
+func ReplaceMonacoPlaceholders(monacoFolder string, keptnEvent *BaseKeptnEvent) ([]string, error) {
+	placeholders := getMonacoPlaceholders(keptnEvent)
+	unknown := map[string]bool{}
+
+	err := filepath.Walk(monacoFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || (extension != ".yaml" && extension != ".yml" && extension != ".json") {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var unsafe error
+		replaced := monacoPlaceholderPattern.ReplaceAllStringFunc(string(content), func(placeholder string) string {
+			value, ok := placeholders[strings.TrimPrefix(placeholder, "$")]
+			if !ok {
+				unknown[placeholder] = true
+				return placeholder
+			}
+			if strings.HasPrefix(placeholder, "$LABEL.") && strings.ContainsAny(value, unsafeLabelCharacters) && unsafe == nil {
+				unsafe = fmt.Errorf("the value of %s used in %s must not contain \", : or line breaks", placeholder, path)
+			}
+			return value
+		})
+		if unsafe != nil {
+			return unsafe
+		}
+		if replaced == string(content) {
+			return nil
+		}
+		return ioutil.WriteFile(path, []byte(replaced), info.Mode().Perm())
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	result := []string{}
+	for placeholder := range unknown {
+		result = append(result, placeholder)
+	}
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resourceCache keeps the resources fetched by NewResourceFetcher, nil disables caching, see SetResourceCache
+var resourceCache *ResourceCache
+
+/**
+ * Caches the fetched resources for RESOURCE_CACHE_TTL so that repeated deployments of the same project, stage,
+ * service and config ref don't fetch all monaco files again, see SetResourceCache. Resources that don't exist are
+ * cached as well. Without a config ref, changes to the default branch are only picked up after the TTL.
+ */
+func SetResourceCache(ttl time.Duration, maxSets int) {
+	if ttl <= 0 {
+		resourceCache = nil
+		return
+	}
+	resourceCache = NewResourceCache(ttl, maxSets)
+}
+
+// ResourceCache holds up to maxSets resource sets, each of them expires ttl after it was created
+type ResourceCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSets int
+	sets    map[string]*cachedResourceSet
+	now     func() time.Time
+}
+
+// cachedResourceSet are the resources of one project, stage, service and config ref
+type cachedResourceSet struct {
+	expires time.Time
+	// content by path, nil for resources that don't exist
+	resources map[string][]byte
+	lists     map[string][]string
+}
+
+func NewResourceCache(ttl time.Duration, maxSets int) *ResourceCache {
+	return &ResourceCache{ttl: ttl, maxSets: maxSets, sets: map[string]*cachedResourceSet{}, now: time.Now}
+}
+
+// set returns the resource set of key, a new one if there is none or it expired. Must be called with mu held.
+func (c *ResourceCache) set(key string) *cachedResourceSet {
+	now := c.now()
+	for setKey, set := range c.sets {
+		if !now.Before(set.expires) {
+			delete(c.sets, setKey)
+		}
+	}
+	if set, ok := c.sets[key]; ok {
+		return set
+	}
+
+	// make room by dropping the set that expires first
+	for c.maxSets > 0 && len(c.sets) >= c.maxSets {
+		oldestKey := ""
+		for setKey, set := range c.sets {
+			if oldestKey == "" || set.expires.Before(c.sets[oldestKey].expires) {
+				oldestKey = setKey
+			}
+		}
+		delete(c.sets, oldestKey)
+	}
+	set := &cachedResourceSet{expires: now.Add(c.ttl), resources: map[string][]byte{}, lists: map[string][]string{}}
+	c.sets[key] = set
+	return set
+}
+
+func (c *ResourceCache) getResource(key string, path string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	content, ok := c.set(key).resources[path]
+	return content, ok
+}
+
+func (c *ResourceCache) putResource(key string, path string, content []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key).resources[path] = content
+}
+
+func (c *ResourceCache) getList(key string, prefix string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths, ok := c.set(key).lists[prefix]
+	return paths, ok
+}
+
+func (c *ResourceCache) putList(key string, prefix string, paths []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key).lists[prefix] = paths
+}
+
+// resourceCacheKey identifies the resource set of the event, source distinguishes the configured resource sources
+func resourceCacheKey(keptnEvent *BaseKeptnEvent, source string) string {
+	return strings.Join([]string{source, keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, keptnEvent.ConfigRef}, "|")
+}
+
+// cachingResourceFetcher answers reads from the cache and fetches the missing resources with next
+type cachingResourceFetcher struct {
+	cache *ResourceCache
+	key   string
+	next  ResourceFetcher
+}
+
+func (f *cachingResourceFetcher) Fetch(path string) ([]byte, error) {
+	if content, ok := f.cache.getResource(f.key, path); ok {
+		if content == nil {
+			return nil, fmt.Errorf("%w: %s", ErrResourceNotFound, path)
+		}
+		return append([]byte{}, content...), nil
+	}
+
+	content, err := f.next.Fetch(path)
+	if err == nil {
+		f.cache.putResource(f.key, path, append([]byte{}, content...))
+	} else if errors.Is(err, ErrResourceNotFound) {
+		f.cache.putResource(f.key, path, nil)
+	}
+	return content, err
+}
+
+func (f *cachingResourceFetcher) List(prefix string) ([]string, error) {
+	if paths, ok := f.cache.getList(f.key, prefix); ok {
+		return append([]string{}, paths...), nil
+	}
+
+	paths, err := f.next.List(prefix)
+	if err == nil {
+		f.cache.putList(f.key, prefix, append([]string{}, paths...))
+	}
+	return paths, err
+}
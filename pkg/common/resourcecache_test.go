@@ -0,0 +1,106 @@
+package common
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResourceCacheServesSecondFetch(t *testing.T) {
+	var requests int32
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.Contains(r.URL.Path, "monaco.conf.yaml") || strings.Contains(r.URL.Path, "/service/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"resourceURI":"/dynatrace/monaco.conf.yaml","resourceContent":"%s"}`, base64.StdEncoding.EncodeToString([]byte("dtCreds: dynatrace")))
+	}))
+	defer configurationService.Close()
+
+	defer os.Setenv("CONFIGURATION_SERVICE", os.Getenv("CONFIGURATION_SERVICE"))
+	os.Setenv("CONFIGURATION_SERVICE", configurationService.URL)
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+	defer SetResourceCache(0, 0)
+	SetResourceCache(time.Minute, 10)
+
+	event := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", ConfigRef: "release-1.2"}
+	for run := 1; run <= 2; run++ {
+		// every run creates its own fetcher, like the deployments of two events
+		fetcher := NewResourceFetcher(event)
+		content, err := fetcher.Fetch("dynatrace/monaco.conf.yaml")
+		if err != nil || string(content) != "dtCreds: dynatrace" {
+			t.Fatalf("run %d: Fetch() = %q, %v", run, content, err)
+		}
+		if _, err := fetcher.Fetch("dynatrace/monaco.zip"); !errors.Is(err, ErrResourceNotFound) {
+			t.Fatalf("run %d: Fetch() of a missing resource error = %v, want ErrResourceNotFound", run, err)
+		}
+	}
+	// the first run reads the service and stage level of monaco.conf.yaml and all three levels of monaco.zip
+	if requests != 5 {
+		t.Errorf("expected the second run to be served from the cache, got %d requests", requests)
+	}
+
+	requests = 0
+	if _, err := NewResourceFetcher(&BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", ConfigRef: "release-1.3"}).Fetch("dynatrace/monaco.conf.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if requests == 0 {
+		t.Errorf("expected another config ref not to be served from the cache")
+	}
+}
+
+// countingFetcher counts the reads that reach the resource source
+type countingFetcher struct {
+	fetches int32
+}
+
+func (f *countingFetcher) Fetch(path string) ([]byte, error) {
+	atomic.AddInt32(&f.fetches, 1)
+	return []byte("content of " + path), nil
+}
+
+func (f *countingFetcher) List(prefix string) ([]string, error) {
+	return []string{prefix + "a.yaml"}, nil
+}
+
+func TestResourceCacheExpiresAndEvicts(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewResourceCache(time.Minute, 2)
+	cache.now = func() time.Time { return now }
+	source := &countingFetcher{}
+	fetcherFor := func(stage string) ResourceFetcher {
+		return &cachingResourceFetcher{cache: cache, key: resourceCacheKey(&BaseKeptnEvent{Project: "sockshop", Stage: stage}, ResourceSourceKeptn), next: source}
+	}
+
+	fetcherFor("dev").Fetch("dynatrace/monaco.conf.yaml")
+	now = now.Add(30 * time.Second)
+	fetcherFor("dev").Fetch("dynatrace/monaco.conf.yaml")
+	if source.fetches != 1 {
+		t.Fatalf("expected the second read within the TTL to be cached, got %d fetches", source.fetches)
+	}
+
+	now = now.Add(31 * time.Second)
+	fetcherFor("dev").Fetch("dynatrace/monaco.conf.yaml")
+	if source.fetches != 2 {
+		t.Fatalf("expected the read after the TTL to fetch again, got %d fetches", source.fetches)
+	}
+
+	// dev expires first and is dropped for production
+	now = now.Add(time.Second)
+	fetcherFor("staging").Fetch("dynatrace/monaco.conf.yaml")
+	fetcherFor("production").Fetch("dynatrace/monaco.conf.yaml")
+	fetcherFor("staging").Fetch("dynatrace/monaco.conf.yaml")
+	fetcherFor("dev").Fetch("dynatrace/monaco.conf.yaml")
+	if source.fetches != 5 {
+		t.Errorf("expected the set expiring first to be evicted, got %d fetches", source.fetches)
+	}
+}
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
+)
+
+// ConfigRefQueryParameter is the query parameter the configuration service reads the git branch or tag of a request from
+const ConfigRefQueryParameter = "gitRef"
+
+// ErrConfigRefNotFound is returned when the git branch or tag requested for the monaco files doesn't exist
+var ErrConfigRefNotFound = errors.New("monaco config ref not found")
+
+// configRefTransport requests all configuration service resources at a git branch or tag
+type configRefTransport struct {
+	ref  string
+	next http.RoundTripper
+}
+
+func (t *configRefTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	query.Set(ConfigRefQueryParameter, t.ref)
+	req.URL.RawQuery = query.Encode()
+
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// how often failed reads from the configuration service are retried, see FETCH_MAX_RETRIES
+var fetchMaxRetries = 0
+
+// delay before the first retry, it doubles with every further retry
+var fetchRetryBackoff = 500 * time.Millisecond
+
+// SetFetchMaxRetries sets how often reads from the configuration service are retried after network errors and 5xx responses
+func SetFetchMaxRetries(retries int) {
+	fetchMaxRetries = retries
+}
+
+/**
+ * fetchRetryTransport retries reads from the configuration service that failed with a network error or a 5xx
+ * response with an exponential backoff. Other responses, e.g., 404 for resources that don't exist, are returned as
+ * they are, and writes are never retried.
+ */
+type fetchRetryTransport struct {
+	retries int
+	next    http.RoundTripper
+}
+
+func (t *fetchRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if req.Method != http.MethodGet {
+		return next.RoundTrip(req)
+	}
+
+	backoff := fetchRetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := next.RoundTrip(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if attempt >= t.retries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		reason := fmt.Sprintf("%v", err)
+		if err == nil {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		log.Printf("Reading %s from the configuration service failed (%s), retrying in %s (%d/%d)", req.URL.Path, reason, backoff, attempt+1, t.retries)
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+/**
+ * Returns a handler for the configuration service, all resources are requested at configRef if it is set.
+ * Requests are authenticated with the refreshable token if one is configured, failed reads are retried up to
+ * fetchMaxRetries times.
+ */
+func newResourceHandler(configRef string) *keptnapi.ResourceHandler {
+	resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
+	if tokenSource := getConfigServiceTokenSource(); tokenSource != nil {
+		resourceHandler.HTTPClient = &http.Client{Transport: &configServiceTokenTransport{source: tokenSource, next: resourceHandler.HTTPClient.Transport}}
+	}
+	if configRef != "" {
+		resourceHandler.HTTPClient = &http.Client{Transport: &configRefTransport{ref: configRef, next: resourceHandler.HTTPClient.Transport}}
+	}
+	if fetchMaxRetries > 0 {
+		resourceHandler.HTTPClient = &http.Client{Transport: &fetchRetryTransport{retries: fetchMaxRetries, next: resourceHandler.HTTPClient.Transport}}
+	}
+	return resourceHandler
+}
+
+/**
+ * Verifies that the git branch or tag requested for the monaco files exists by listing the stage resources at it
+ */
+func ValidateConfigRef(keptnEvent *BaseKeptnEvent) error {
+	if RunLocal || keptnEvent.ConfigRef == "" {
+		return nil
+	}
+
+	_, err := newResourceHandler(keptnEvent.ConfigRef).GetAllStageResources(keptnEvent.Project, keptnEvent.Stage)
+	if err != nil {
+		return fmt.Errorf("%w: '%s' in project %s: %v", ErrConfigRefNotFound, keptnEvent.ConfigRef, keptnEvent.Project, err)
+	}
+	return nil
+}
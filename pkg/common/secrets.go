@@ -0,0 +1,115 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SecretPattern detects one kind of hardcoded secret
+type SecretPattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// DefaultSecretPatterns are used to scan monaco files unless SECRET_PATTERNS is set
+var DefaultSecretPatterns = []SecretPattern{
+	{Name: "Dynatrace API token", Regexp: regexp.MustCompile(`dt0[a-z][0-9]{2}\.[A-Z0-9]{24}\.[A-Z0-9]{64}`)},
+	{Name: "AWS access key", Regexp: regexp.MustCompile(`(A3T[A-Z0-9]|AKIA|ASIA)[A-Z0-9]{16}`)},
+	{Name: "GitHub token", Regexp: regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36}`)},
+	{Name: "Slack token", Regexp: regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{Name: "private key", Regexp: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// SecretFinding is a line of a monaco file that matches a SecretPattern, it never contains the secret itself
+type SecretFinding struct {
+	File    string
+	Line    int
+	Pattern string
+}
+
+func (f SecretFinding) String() string {
+	return fmt.Sprintf("%s:%d (%s)", f.File, f.Line, f.Pattern)
+}
+
+/**
+ * Parses SECRET_PATTERNS: one regular expression per line, empty lines are ignored.
+ * Returns DefaultSecretPatterns if there is no pattern.
+ */
+func ParseSecretPatterns(patterns string) ([]SecretPattern, error) {
+	result := []SecretPattern{}
+	for _, pattern := range strings.Split(patterns, "\n") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern '%s': %v", pattern, err)
+		}
+		result = append(result, SecretPattern{Name: pattern, Regexp: compiled})
+	}
+
+	if len(result) == 0 {
+		return DefaultSecretPatterns, nil
+	}
+	return result, nil
+}
+
+/**
+ * Scans all files below folder for hardcoded secrets and returns where they were found
+ */
+func FindLeakedSecrets(folder string, patterns []SecretPattern) ([]SecretFinding, error) {
+	findings := []SecretFinding{}
+	if !FileExists(folder) {
+		return findings, nil
+	}
+
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// the monaco.zip the files were extracted from is not scanned
+		if !info.Mode().IsRegular() || strings.HasSuffix(path, ".zip") {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		relativePath, _ := filepath.Rel(folder, path)
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			for _, pattern := range patterns {
+				if pattern.Regexp.MatchString(scanner.Text()) {
+					findings = append(findings, SecretFinding{File: relativePath, Line: lineNumber, Pattern: pattern.Name})
+				}
+			}
+		}
+		return scanner.Err()
+	})
+
+	return findings, err
+}
+
+/**
+ * Replaces the passed secrets and everything matching one of the patterns by RedactedSecret
+ */
+func RedactSecrets(content string, patterns []SecretPattern, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			content = strings.ReplaceAll(content, secret, RedactedSecret)
+		}
+	}
+	for _, pattern := range patterns {
+		content = pattern.Regexp.ReplaceAllString(content, RedactedSecret)
+	}
+	return content
+}
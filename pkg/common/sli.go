@@ -0,0 +1,116 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SLIFilename is the resource with the SLI definitions the monaco-service serves for sh.keptn.event.get-sli.triggered
+const SLIFilename = "dynatrace/sli.yaml"
+
+// ErrSLIConfigNotFound is returned if the project has no SLI definitions
+var ErrSLIConfigNotFound = errors.New("no SLI definitions found")
+
+// SLIConfig is the content of dynatrace/sli.yaml, indicators maps the SLI names to Dynatrace metric queries
+type SLIConfig struct {
+	SpecVersion string            `yaml:"spec_version"`
+	Indicators  map[string]string `yaml:"indicators"`
+}
+
+/**
+ * Loads dynatrace/sli.yaml of the event (team specific if the event has a team) and replaces the Keptn placeholders,
+ * e.g., $SERVICE, in the queries
+ */
+func GetSLIConfig(keptnEvent *BaseKeptnEvent) (*SLIConfig, error) {
+	resourceURI := GetTeamResourceURI(keptnEvent, SLIFilename)
+	content, err := GetResource(keptnEvent, resourceURI)
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return nil, fmt.Errorf("%w: %s", ErrSLIConfigNotFound, resourceURI)
+	}
+
+	sliConfig := &SLIConfig{}
+	if err := yaml.Unmarshal([]byte(content), sliConfig); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", resourceURI, err)
+	}
+	for name, query := range sliConfig.Indicators {
+		sliConfig.Indicators[name] = ReplaceKeptnPlaceholders(query, keptnEvent)
+	}
+	return sliConfig, nil
+}
+
+// metricsQueryResult is the part of the response of the Dynatrace metrics API v2 the SLIs are read from
+type metricsQueryResult struct {
+	Result []struct {
+		MetricID string `json:"metricId"`
+		Data     []struct {
+			Values []*float64 `json:"values"`
+		} `json:"data"`
+	} `json:"result"`
+}
+
+/**
+ * Queries the value of an SLI between start and end via the Dynatrace metrics API v2 (/api/v2/metrics/query).
+ * query is either a metric selector, e.g., builtin:service.response.time:avg, or the parameters of the metrics API,
+ * e.g., metricSelector=builtin:service.response.time:avg&entitySelector=tag(keptn_service:carts).
+ * The metric is aggregated over the whole timeframe, the first value is returned.
+ */
+func QueryDynatraceMetric(dtCredentials *DTCredentials, query string, start time.Time, end time.Time) (float64, error) {
+	parameters := url.Values{}
+	if strings.HasPrefix(query, "metricSelector=") {
+		parsed, err := url.ParseQuery(query)
+		if err != nil {
+			return 0, fmt.Errorf("invalid query '%s': %v", query, err)
+		}
+		parameters = parsed
+	} else {
+		parameters.Set("metricSelector", query)
+	}
+	parameters.Set("from", fmt.Sprint(start.UnixNano()/int64(time.Millisecond)))
+	parameters.Set("to", fmt.Sprint(end.UnixNano()/int64(time.Millisecond)))
+	parameters.Set("resolution", "Inf")
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(dtCredentials.Tenant, "/")+"/api/v2/metrics/query?"+parameters.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Api-Token "+dtCredentials.ApiToken)
+
+	resp, err := getDynatraceHTTPClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not query Dynatrace: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the Dynatrace response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("Dynatrace responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	result := &metricsQueryResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return 0, fmt.Errorf("invalid Dynatrace response: %v", err)
+	}
+	for _, metric := range result.Result {
+		for _, data := range metric.Data {
+			for _, value := range data.Values {
+				if value != nil {
+					return *value, nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("Dynatrace returned no value for '%s'", parameters.Get("metricSelector"))
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MonacoTarballFilename is the resource holding the whole monaco project as gzipped tar archive
+const MonacoTarballFilename = "dynatrace/monaco.tar.gz"
+
+/**
+ * Fetches dynatrace/monaco.tar.gz and extracts it into the temp folder of the run. Returns false if there is no
+ * such resource; a failed fetch or an archive that can't be extracted safely is an error.
+ */
+func DownloadAndExtractMonacoTarball(keptnEvent *BaseKeptnEvent) (bool, error) {
+	tarball, err := GetResource(keptnEvent, GetTeamResourceURI(keptnEvent, MonacoTarballFilename))
+	if err != nil {
+		return false, fmt.Errorf("could not fetch %s: %w", MonacoTarballFilename, err)
+	}
+	if tarball == "" {
+		return false, nil
+	}
+
+	folder := GetTempMonacoFolder(keptnEvent)
+	file := folder + "/monaco.tar.gz"
+	if err := CopyFileContentToDestination(tarball, file); err != nil {
+		return true, err
+	}
+
+	files, err := Untar(file, folder)
+	if err != nil {
+		return true, fmt.Errorf("could not extract %s: %w", MonacoTarballFilename, err)
+	}
+	log.Printf("Successfully extracted %d files of %s to %s", len(files), MonacoTarballFilename, folder)
+	return true, nil
+}
+
+/**
+ * Extracts the gzipped tar archive src into dest and returns the extracted files. Archives with absolute paths,
+ * paths containing .. or links are rejected, so nothing can be written outside of dest.
+ */
+func Untar(src string, dest string) ([]string, error) {
+	var filenames []string
+
+	archive, err := os.Open(src)
+	if err != nil {
+		return filenames, err
+	}
+	defer archive.Close()
+
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return filenames, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return filenames, nil
+		}
+		if err != nil {
+			return filenames, err
+		}
+
+		fpath, err := containedPath(dest, header.Name)
+		if err != nil {
+			return filenames, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fpath, WorkDirPermissions); err != nil {
+				return filenames, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(fpath), WorkDirPermissions); err != nil {
+				return filenames, err
+			}
+			outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm()&WorkDirPermissions)
+			if err != nil {
+				return filenames, err
+			}
+			_, err = io.Copy(outFile, tarReader)
+			outFile.Close()
+			if err != nil {
+				return filenames, err
+			}
+			filenames = append(filenames, fpath)
+		default:
+			// links could point outside of dest
+			return filenames, fmt.Errorf("%s: unsupported entry type %c", header.Name, header.Typeflag)
+		}
+	}
+}
+
+/**
+ * Returns the path of name within dest. Absolute names and names containing .. are rejected, so nothing can be
+ * written outside of dest.
+ */
+func containedPath(dest string, name string) (string, error) {
+	slashed := filepath.ToSlash(name)
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) {
+		return "", fmt.Errorf("%s: illegal absolute file path", name)
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%s: illegal file path", name)
+		}
+	}
+	fpath := filepath.Join(dest, slashed)
+	if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s: illegal file path", name)
+	}
+	return fpath, nil
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+func writeTarball(t *testing.T, file string, entries []tarEntry) {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.content))
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		if err := tarWriter.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUntar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monaco-tarball")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "monaco.tar.gz")
+	writeTarball(t, archive, []tarEntry{
+		{header: tar.Header{Name: "projects/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "projects/p1/alerting-profile/profile.yaml", Typeflag: tar.TypeReg}, content: "config:\n"},
+	})
+
+	dest := filepath.Join(dir, "out")
+	files, err := Untar(archive, dest)
+	if err != nil {
+		t.Fatalf("Untar() error = %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Untar() extracted %v, want 1 file", files)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dest, "projects/p1/alerting-profile/profile.yaml"))
+	if err != nil || string(content) != "config:\n" {
+		t.Errorf("extracted content = %q, %v", content, err)
+	}
+}
+
+func TestUntarRejectsMaliciousArchives(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry tarEntry
+	}{
+		{"relative path traversal", tarEntry{header: tar.Header{Name: "../evil", Typeflag: tar.TypeReg}, content: "evil"}},
+		{"nested path traversal", tarEntry{header: tar.Header{Name: "projects/../../evil", Typeflag: tar.TypeReg}, content: "evil"}},
+		{"absolute path", tarEntry{header: tar.Header{Name: "/tmp/evil", Typeflag: tar.TypeReg}, content: "evil"}},
+		{"symlink", tarEntry{header: tar.Header{Name: "projects/link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "monaco-tarball")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			archive := filepath.Join(dir, "monaco.tar.gz")
+			writeTarball(t, archive, []tarEntry{
+				{header: tar.Header{Name: "projects/ok.yaml", Typeflag: tar.TypeReg}, content: "config:\n"},
+				tt.entry,
+			})
+
+			dest := filepath.Join(dir, "out")
+			if _, err := Untar(archive, dest); err == nil {
+				t.Fatal("Untar() expected an error for a malicious archive")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+				t.Error("Untar() wrote a file outside of the destination")
+			}
+			if _, err := os.Lstat(filepath.Join(dest, "projects/link")); !os.IsNotExist(err) {
+				t.Error("Untar() created a symlink")
+			}
+		})
+	}
+}
+
+func TestDownloadAndExtractMonacoTarballReturnsFetchErrors(t *testing.T) {
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing && strings.HasSuffix(r.URL.Path, "/monaco.tar.gz") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	defer func(source string, sourceURL string) { resourceSource, resourceSourceURL = source, sourceURL }(resourceSource, resourceSourceURL)
+	if err := SetResourceSource(ResourceSourceHTTP, server.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(runLocal bool) { RunLocal = runLocal }(RunLocal)
+	RunLocal = false
+
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "tarball-fetch"}
+	if found, err := DownloadAndExtractMonacoTarball(keptnEvent); found || err == nil {
+		t.Errorf("expected the fetch error, got %v (%v)", found, err)
+	}
+
+	// only a missing tarball falls back to the other sources
+	failing = false
+	if found, err := DownloadAndExtractMonacoTarball(keptnEvent); found || err != nil {
+		t.Errorf("expected no tarball and no error, got %v (%v)", found, err)
+	}
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TeamsSubfolder holds one folder per team with the same structure as the dynatrace folder, e.g., dynatrace/teams/payments/monaco.conf.yaml
+const TeamsSubfolder = "dynatrace/teams"
+
+var teamNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+/**
+ * Validates the team of the event, it becomes part of resource paths and secret names
+ */
+func ValidateTeam(team string) error {
+	if team != "" && !teamNamePattern.MatchString(team) {
+		return fmt.Errorf("invalid team '%s', only letters, digits, '-' and '_' are allowed", team)
+	}
+	return nil
+}
+
+/**
+ * Returns the URI of a resource below the dynatrace folder for the team of the event, e.g., dynatrace/monaco.zip
+ * becomes dynatrace/teams/payments/monaco.zip. Resources of events without team are returned as is.
+ */
+func GetTeamResourceURI(keptnEvent *BaseKeptnEvent, resourceURI string) string {
+	if keptnEvent.Team == "" {
+		return resourceURI
+	}
+
+	prefix := ""
+	if strings.HasPrefix(resourceURI, "/") {
+		prefix = "/"
+	}
+	relativeURI := strings.TrimPrefix(strings.TrimPrefix(resourceURI, "/"), "dynatrace/")
+	return prefix + TeamsSubfolder + "/" + keptnEvent.Team + "/" + relativeURI
+}
@@ -0,0 +1,26 @@
+package common
+
+import "testing"
+
+func TestGetTeamResourceURI(t *testing.T) {
+	tests := []struct {
+		team        string
+		resourceURI string
+		expected    string
+	}{
+		{"", MonacoConfigFilename, "dynatrace/monaco.conf.yaml"},
+		{"payments", MonacoConfigFilename, "dynatrace/teams/payments/monaco.conf.yaml"},
+		{"payments", "/dynatrace/projects/", "/dynatrace/teams/payments/projects/"},
+	}
+	for _, tt := range tests {
+		if uri := GetTeamResourceURI(&BaseKeptnEvent{Team: tt.team}, tt.resourceURI); uri != tt.expected {
+			t.Errorf("GetTeamResourceURI(%q, %q) = %s, want %s", tt.team, tt.resourceURI, uri, tt.expected)
+		}
+	}
+
+	for _, team := range []string{"../payments", "payments/x", ".hidden"} {
+		if err := ValidateTeam(team); err == nil {
+			t.Errorf("ValidateTeam(%q) expected an error", team)
+		}
+	}
+}
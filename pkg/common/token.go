@@ -0,0 +1,156 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigServiceTokenHeader carries the token authenticating at the configuration service
+const ConfigServiceTokenHeader = "x-token"
+
+/**
+ * configServiceTokenSource provides the short-lived token of the configuration service, read from
+ * CONFIGURATION_SERVICE_TOKEN_FILE or fetched from CONFIGURATION_SERVICE_TOKEN_URL. The token is cached
+ * until the configuration service rejects it.
+ */
+type configServiceTokenSource struct {
+	mu    sync.Mutex
+	token string
+	file  string
+	url   string
+}
+
+// configServiceToken is shared by all requests to the configuration service
+var configServiceToken = &configServiceTokenSource{}
+
+// configServiceTokenClient fetches the token from CONFIGURATION_SERVICE_TOKEN_URL, a hanging endpoint must not block the run
+var configServiceTokenClient = &http.Client{Timeout: 10 * time.Second}
+
+func (s *configServiceTokenSource) configure(file string, url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != file || s.url != url {
+		s.file, s.url, s.token = file, url, ""
+	}
+}
+
+func (s *configServiceTokenSource) enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file != "" || s.url != ""
+}
+
+// Token returns the cached token, loading it on first use
+func (s *configServiceTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token != "" {
+		return token, nil
+	}
+	return s.Refresh("")
+}
+
+/**
+ * Loads a new token unless another request already refreshed the rejected one in the meantime
+ */
+func (s *configServiceTokenSource) Refresh(rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.token != rejected {
+		return s.token, nil
+	}
+
+	var content []byte
+	var err error
+	if s.file != "" {
+		content, err = ioutil.ReadFile(s.file)
+	} else {
+		content, err = fetchConfigServiceToken(s.url)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not refresh configuration service token: %v", err)
+	}
+
+	s.token = strings.TrimSpace(string(content))
+	if s.token == "" {
+		return "", errors.New("could not refresh configuration service token: token is empty")
+	}
+	return s.token, nil
+}
+
+func fetchConfigServiceToken(url string) ([]byte, error) {
+	resp, err := configServiceTokenClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+/**
+ * configServiceTokenTransport authenticates requests at the configuration service. When a token expires mid-fetch
+ * and the configuration service answers 401, the token is refreshed and the request is retried once.
+ */
+type configServiceTokenTransport struct {
+	source *configServiceTokenSource
+	next   http.RoundTripper
+}
+
+func (t *configServiceTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	token, err := t.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := next.RoundTrip(withConfigServiceToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// requests with a body can only be retried if it can be read again
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	refreshed, err := t.source.Refresh(token)
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := withConfigServiceToken(req, refreshed)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return next.RoundTrip(retry)
+}
+
+func withConfigServiceToken(req *http.Request, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set(ConfigServiceTokenHeader, token)
+	return req
+}
+
+// configures the token source from CONFIGURATION_SERVICE_TOKEN_FILE and CONFIGURATION_SERVICE_TOKEN_URL
+func getConfigServiceTokenSource() *configServiceTokenSource {
+	configServiceToken.configure(os.Getenv("CONFIGURATION_SERVICE_TOKEN_FILE"), os.Getenv("CONFIGURATION_SERVICE_TOKEN_URL"))
+	if !configServiceToken.enabled() {
+		return nil
+	}
+	return configServiceToken
+}
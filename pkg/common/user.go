@@ -0,0 +1,116 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// MonacoUser is the OS user and group monaco runs as instead of the user of the monaco-service
+type MonacoUser struct {
+	UID uint32
+	GID uint32
+}
+
+/**
+ * Parses MONACO_UID and MONACO_GID, returns nil if neither is set. If only one of them is set, the other one is
+ * the uid or gid of the monaco-service process.
+ */
+func ParseMonacoUser(uid string, gid string) (*MonacoUser, error) {
+	if uid == "" && gid == "" {
+		return nil, nil
+	}
+	user := &MonacoUser{UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+	if uid != "" {
+		parsed, err := strconv.ParseUint(uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid '%s': %v", uid, err)
+		}
+		user.UID = uint32(parsed)
+	}
+	if gid != "" {
+		parsed, err := strconv.ParseUint(gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid '%s': %v", gid, err)
+		}
+		user.GID = uint32(parsed)
+	}
+	return user, nil
+}
+
+/**
+ * Returns an error if the monaco-service process is not allowed to run monaco as user: only root can switch to
+ * another user or group
+ */
+func CheckMonacoUser(user *MonacoUser) error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+	if user.UID != uint32(os.Geteuid()) || user.GID != uint32(os.Getegid()) {
+		return fmt.Errorf("cannot run monaco as uid %d and gid %d: the monaco-service runs as uid %d and needs to run as root to switch users", user.UID, user.GID, os.Geteuid())
+	}
+	return nil
+}
+
+/**
+ * Configures cmd to run as user and hands the files monaco reads over to it, they are only accessible by their
+ * owner (see WorkDirPermissions). The group of user may traverse the folders above them to reach them.
+ */
+func runAsMonacoUser(cmd *exec.Cmd, user *MonacoUser, paths ...string) error {
+	if err := CheckMonacoUser(user); err != nil {
+		return err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid: user.UID,
+			Gid: user.GID,
+			// only root may set the supplementary groups
+			NoSetGroups: os.Geteuid() != 0,
+		},
+	}
+
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(file, int(user.UID), int(user.GID))
+		})
+		if err != nil {
+			return fmt.Errorf("could not hand %s over to uid %d: %v", path, user.UID, err)
+		}
+		if err := allowTraverse(path, user.GID); err != nil {
+			return fmt.Errorf("could not let gid %d traverse to %s: %v", user.GID, path, err)
+		}
+	}
+	return nil
+}
+
+/**
+ * Lets the group gid traverse (but not list) the parent folders of a relative path, e.g., tmp/monaco/<project> above
+ * the folder of an event. Absolute paths, e.g., the token file in the system temp folder, are left as they are.
+ */
+func allowTraverse(path string, gid uint32) error {
+	if filepath.IsAbs(path) {
+		return nil
+	}
+	for parent := filepath.Dir(filepath.Clean(path)); parent != "." && parent != string(filepath.Separator); parent = filepath.Dir(parent) {
+		info, err := os.Stat(parent)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(parent, -1, int(gid)); err != nil {
+			return err
+		}
+		if err := os.Chmod(parent, info.Mode().Perm()|0010); err != nil {
+			return err
+		}
+	}
+	return nil
+}
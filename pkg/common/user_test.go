@@ -0,0 +1,108 @@
+package common
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestParseMonacoUser(t *testing.T) {
+	if user, err := ParseMonacoUser("", ""); err != nil || user != nil {
+		t.Errorf("expected no user without MONACO_UID and MONACO_GID, got %v, %v", user, err)
+	}
+
+	user, err := ParseMonacoUser("1000", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.UID != 1000 || user.GID != uint32(os.Getgid()) {
+		t.Errorf("expected uid 1000 and the gid of the process, got %+v", user)
+	}
+
+	if _, err := ParseMonacoUser("monaco", ""); err == nil {
+		t.Errorf("expected an error for a non-numeric uid")
+	}
+}
+
+func TestCheckMonacoUserWithoutRoot(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root may switch to any user")
+	}
+
+	if err := CheckMonacoUser(&MonacoUser{UID: uint32(os.Geteuid()), GID: uint32(os.Getegid())}); err != nil {
+		t.Errorf("expected the own user to be allowed: %v", err)
+	}
+	if err := CheckMonacoUser(&MonacoUser{UID: uint32(os.Geteuid()) + 1, GID: uint32(os.Getegid())}); err == nil {
+		t.Errorf("expected switching to another user to fail without root")
+	}
+}
+
+func TestNewMonacoCommandRunsAsMonacoUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+
+	workDir, err := ioutil.TempDir("", "monaco-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	os.Chdir(workDir)
+
+	keptnEvent := &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts", Context: "my-context"}
+	monacoFolder := GetMonacoFolder(keptnEvent)
+	os.MkdirAll(filepath.Join(monacoFolder, "projects", "sockshop"), WorkDirPermissions)
+	configFile := filepath.Join(monacoFolder, "projects", "sockshop", "dashboard.yaml")
+	ioutil.WriteFile(configFile, []byte("config:\n"), WorkFilePermissions)
+	// like the working directory of the container, the temp folder of the test is only accessible by root otherwise
+	os.Chmod(workDir, 0711)
+
+	user := &MonacoUser{UID: 1000, GID: 1000}
+	cmd, cleanup, err := NewMonacoCommand(context.Background(), &DTCredentials{Tenant: "https://abc12345.live.dynatrace.com", ApiToken: "dt0c01.TESTTOKEN"}, keptnEvent, MonacoCommandOptions{TokenDelivery: TokenDeliveryFile, User: user})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Credential == nil {
+		t.Fatalf("expected the credential to be set on the command")
+	}
+	if credential := cmd.SysProcAttr.Credential; credential.Uid != 1000 || credential.Gid != 1000 {
+		t.Errorf("expected monaco to run as 1000:1000, got %d:%d", credential.Uid, credential.Gid)
+	}
+
+	tokenFile, _ := getCmdEnv(cmd.Env, "DT_API_TOKEN_FILE")
+	for _, path := range []string{filepath.Join(monacoFolder, "projects", "sockshop"), tokenFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat := info.Sys().(*syscall.Stat_t); stat.Uid != 1000 || stat.Gid != 1000 {
+			t.Errorf("expected %s to be handed over to 1000:1000, got %d:%d", path, stat.Uid, stat.Gid)
+		}
+	}
+
+	// the parent work folders stay closed for everybody else
+	for parent := filepath.Dir(monacoFolder); parent != "."; parent = filepath.Dir(parent) {
+		info, err := os.Stat(parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode&0010 == 0 || mode&0007 != 0 {
+			t.Errorf("expected %s to be traversable by the group of the monaco user only, got %o", parent, mode)
+		}
+	}
+
+	// monaco can read its files as the non-root user
+	reader := exec.Command("cat", configFile)
+	reader.SysProcAttr = cmd.SysProcAttr
+	if output, err := reader.CombinedOutput(); err != nil {
+		t.Errorf("expected uid 1000 to read %s: %v: %s", configFile, err, output)
+	}
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * Parses all yaml files below folder before monaco applies them and returns the problems as <file>: <error>.
+ * Monaco config files are mappings (e.g., config: and the config names), so any other document is invalid too.
+ */
+func ValidateMonacoYAML(folder string) ([]string, error) {
+	problems := []string{}
+	if !FileExists(folder) {
+		return problems, nil
+	}
+
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := filepath.Ext(path)
+		if info.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal(content, &parsed); err != nil {
+			relativePath, _ := filepath.Rel(folder, path)
+			problems = append(problems, fmt.Sprintf("%s: %s", relativePath, strings.TrimPrefix(err.Error(), "yaml: ")))
+		}
+		return nil
+	})
+
+	return problems, err
+}
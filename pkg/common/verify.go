@@ -0,0 +1,123 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// lines of the monaco output naming the api and id of a created or updated config, e.g.,
+// "Upserted config carts of api auto-tag with id 3e4f5a6b"
+var monacoDeployedEntityPattern = regexp.MustCompile(`(?i)(?:created|updated|upserted)\b[^\n]*?\bapi:?\s+([\w.:-]+)[^\n]*?\bid:?\s+([\w.:-]+)`)
+
+// endpoints of the Dynatrace configuration API by monaco api id, configs of other apis can't be verified
+var monacoAPIEndpoints = map[string]string{
+	"alerting-profile":                      "/api/config/v1/alertingProfiles",
+	"anomaly-detection-metrics":             "/api/config/v1/anomalyDetection/metricEvents",
+	"app-detection-rule":                    "/api/config/v1/applicationDetectionRules",
+	"application":                           "/api/config/v1/applications/web",
+	"application-web":                       "/api/config/v1/applications/web",
+	"application-mobile":                    "/api/config/v1/applications/mobile",
+	"auto-tag":                              "/api/config/v1/autoTags",
+	"aws-credentials":                       "/api/config/v1/aws/credentials",
+	"azure-credentials":                     "/api/config/v1/azure/credentials",
+	"calculated-metrics-application-mobile": "/api/config/v1/calculatedMetrics/mobile",
+	"calculated-metrics-application-web":    "/api/config/v1/calculatedMetrics/rum",
+	"calculated-metrics-log":                "/api/config/v1/calculatedMetrics/log",
+	"calculated-metrics-service":            "/api/config/v1/calculatedMetrics/service",
+	"calculated-metrics-synthetic":          "/api/config/v1/calculatedMetrics/synthetic",
+	"conditional-naming-host":               "/api/config/v1/conditionalNaming/host",
+	"conditional-naming-processgroup":       "/api/config/v1/conditionalNaming/processGroup",
+	"conditional-naming-service":            "/api/config/v1/conditionalNaming/service",
+	"credential-vault":                      "/api/config/v1/credentials",
+	"custom-service-dotnet":                 "/api/config/v1/service/customServices/dotNet",
+	"custom-service-go":                     "/api/config/v1/service/customServices/go",
+	"custom-service-java":                   "/api/config/v1/service/customServices/java",
+	"custom-service-nodejs":                 "/api/config/v1/service/customServices/nodeJS",
+	"custom-service-php":                    "/api/config/v1/service/customServices/php",
+	"dashboard":                             "/api/config/v1/dashboards",
+	"extension":                             "/api/config/v1/extensions",
+	"failure-detection-parametersets":       "/api/config/v1/service/failureDetection/parameterSelection/parameterSets",
+	"failure-detection-rules":               "/api/config/v1/service/failureDetection/parameterSelection/rules",
+	"kubernetes-credentials":                "/api/config/v1/kubernetes/credentials",
+	"maintenance-window":                    "/api/config/v1/maintenanceWindows",
+	"management-zone":                       "/api/config/v1/managementZones",
+	"notification":                          "/api/config/v1/notifications",
+	"reports":                               "/api/config/v1/reports",
+	"request-attributes":                    "/api/config/v1/service/requestAttributes",
+	"request-naming-service":                "/api/config/v1/service/requestNaming",
+	"slo":                                   "/api/v2/slo",
+	"synthetic-location":                    "/api/v1/synthetic/locations",
+	"synthetic-monitor":                     "/api/v1/synthetic/monitors",
+}
+
+// DeployedEntity is a Dynatrace config monaco reported as created or updated
+type DeployedEntity struct {
+	API string `json:"api"`
+	ID  string `json:"id"`
+}
+
+// MonacoVerificationResult tells which of the deployed configs exist in Dynatrace, see the monaco.verify label
+type MonacoVerificationResult struct {
+	Verified int      `json:"verified"`
+	Missing  []string `json:"missing,omitempty"`
+	// configs of apis without a known endpoint (<api>/<id>), they are neither verified nor missing
+	Unverifiable []string `json:"unverifiable,omitempty"`
+}
+
+/**
+ * Parses the api and id of every config a monaco run created or updated, each config is returned once
+ */
+func ParseDeployedEntities(output string) []DeployedEntity {
+	seen := map[DeployedEntity]bool{}
+	entities := []DeployedEntity{}
+	for _, match := range monacoDeployedEntityPattern.FindAllStringSubmatch(output, -1) {
+		entity := DeployedEntity{API: match[1], ID: match[2]}
+		if !seen[entity] {
+			seen[entity] = true
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+/**
+ * Checks via the Dynatrace configuration API that every deployed config exists. Configs the API doesn't know are
+ * listed as missing (<api>/<id>), any other failing request aborts the verification with an error. Configs of apis
+ * that aren't in monacoAPIEndpoints are listed as unverifiable.
+ */
+func VerifyDeployedEntities(dtCredentials *DTCredentials, entities []DeployedEntity) (*MonacoVerificationResult, error) {
+	result := &MonacoVerificationResult{}
+	client := getDynatraceHTTPClient()
+
+	for _, entity := range entities {
+		endpoint, ok := monacoAPIEndpoints[entity.API]
+		if !ok {
+			result.Unverifiable = append(result.Unverifiable, entity.API+"/"+entity.ID)
+			continue
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s/%s", strings.TrimSuffix(dtCredentials.Tenant, "/"), endpoint, url.PathEscape(entity.ID)), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Api-Token "+dtCredentials.ApiToken)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("could not verify %s/%s: %v", entity.API, entity.ID, err)
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			result.Missing = append(result.Missing, entity.API+"/"+entity.ID)
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			result.Verified++
+		default:
+			return nil, fmt.Errorf("could not verify %s/%s: Dynatrace responded with %d", entity.API, entity.ID, resp.StatusCode)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDeployedEntitiesRequestsConfigAPIEndpoints(t *testing.T) {
+	requested := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath())
+		if r.URL.EscapedPath() == "/api/config/v1/managementZones/zone-1" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	result, err := VerifyDeployedEntities(&DTCredentials{Tenant: server.URL, ApiToken: "token"}, []DeployedEntity{
+		{API: "auto-tag", ID: "tag-1"},
+		{API: "management-zone", ID: "zone-1"},
+		{API: "custom-service-java", ID: "service 1"},
+		{API: "builtin:alerting.profile", ID: "vu9U3hXa"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPaths := []string{
+		"/api/config/v1/autoTags/tag-1",
+		"/api/config/v1/managementZones/zone-1",
+		"/api/config/v1/service/customServices/java/service%201",
+	}
+	if strings.Join(requested, ",") != strings.Join(expectedPaths, ",") {
+		t.Errorf("expected the requests %v, got %v", expectedPaths, requested)
+	}
+	if result.Verified != 2 || strings.Join(result.Missing, ",") != "management-zone/zone-1" || strings.Join(result.Unverifiable, ",") != "builtin:alerting.profile/vu9U3hXa" {
+		t.Errorf("unexpected verification result %+v", result)
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MonacoVersionFilename pins the monaco release used for the monaco files of a project, e.g., v1.5.0
+const MonacoVersionFilename = ".monaco-version"
+
+// ErrMonacoVersionNotInstalled is returned when no executable of a pinned monaco release is installed
+var ErrMonacoVersionNotInstalled = errors.New("monaco version is not installed")
+
+// versions are used in file paths, so they can't contain path separators
+var monacoVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+/**
+ * Returns the monaco release pinned for the run: the version of the monaco.version label if set, otherwise the
+ * content of the .monaco-version file of the monaco files. Empty if no version is pinned.
+ */
+func GetPinnedMonacoVersion(keptnEvent *BaseKeptnEvent, labelVersion string) (string, error) {
+	version := strings.TrimSpace(labelVersion)
+	if version == "" {
+		content, err := ioutil.ReadFile(GetMonacoFolder(keptnEvent) + "/" + MonacoVersionFilename)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read %s: %v", MonacoVersionFilename, err)
+		}
+		version = strings.TrimSpace(string(content))
+	}
+	if version != "" && !monacoVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid monaco version '%s'", version)
+	}
+	return version, nil
+}
+
+/**
+ * Returns the path of the executable of the monaco release version, pathTemplate with $VERSION replaced by version
+ * (e.g., /usr/local/bin/monaco-$VERSION). Returns ErrMonacoVersionNotInstalled if it doesn't exist.
+ */
+func GetMonacoVersionExecutable(pathTemplate string, version string) (string, error) {
+	executable := strings.ReplaceAll(pathTemplate, MonacoVersionPlaceholder, version)
+	info, err := os.Stat(executable)
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("%w: %s requires %s", ErrMonacoVersionNotInstalled, version, executable)
+	}
+	return executable, nil
+}
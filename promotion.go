@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// MonacoPromotionResult summarizes the monaco runs of all stages of a promotion, see the monaco.stages parameter
+type MonacoPromotionResult struct {
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Skipped   int                 `json:"skipped"`
+	Duration  string              `json:"duration"`
+	Stages    []MonacoStageResult `json:"stages"`
+}
+
+// MonacoStageResult is the outcome of the monaco run of one stage of a promotion
+type MonacoStageResult struct {
+	Stage    string             `json:"stage"`
+	Status   keptnv2.StatusType `json:"status,omitempty"`
+	Result   keptnv2.ResultType `json:"result,omitempty"`
+	Message  string             `json:"message,omitempty"`
+	Duration string             `json:"duration,omitempty"`
+	// stages after a failed stage are not deployed
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+/**
+ * stageEventSender collects the .finished event of the run of a single stage instead of sending it, .started
+ * events are dropped as the promotion sends its own, all other events are forwarded
+ */
+type stageEventSender struct {
+	next     keptn.EventSender
+	mu       sync.Mutex
+	finished *cloudevents.Event
+}
+
+func (s *stageEventSender) SendEvent(event cloudevents.Event) error {
+	switch {
+	case strings.HasSuffix(event.Type(), ".started"):
+		return nil
+	case strings.HasSuffix(event.Type(), ".finished"):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.finished = &event
+		return nil
+	}
+	return s.next.SendEvent(event)
+}
+
+/**
+ * Deploys the stages listed in monaco.stages one after another, each like a separate monaco.triggered event for
+ * that stage. A status.changed event reports the result of each stage; a single .finished event summarizes all of
+ * them. Stages after the first failed one are skipped.
+ */
+func handlePromotion(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *MonacoStartedEventData) error {
+	stages := data.Monaco.Stages
+
+	data.EventData.Message = fmt.Sprintf("Starting to promote monaco configuration through %s", strings.Join(stages, ", "))
+	if _, err := myKeptn.SendTaskStartedEvent(data, eventSource); err != nil {
+		return err
+	}
+
+	promotion := &MonacoPromotionResult{Stages: []MonacoStageResult{}}
+	promotionStart := time.Now()
+	var promotionErr error
+	failedStatus := keptnv2.StatusSucceeded
+
+	for i, stage := range stages {
+		if promotionErr != nil {
+			promotion.Skipped++
+			promotion.Stages = append(promotion.Stages, MonacoStageResult{Stage: stage, Skipped: true, Message: "not deployed, an earlier stage failed"})
+			continue
+		}
+
+		stageStart := time.Now()
+		stageResult, err := runPromotionStage(myKeptn, incomingEvent, data, stage)
+		stageResult.Duration = time.Since(stageStart).Round(time.Millisecond).String()
+		promotion.Stages = append(promotion.Stages, stageResult)
+
+		if stageResult.Result == keptnv2.ResultPass {
+			promotion.Succeeded++
+		} else {
+			promotion.Failed++
+			failedStatus = stageResult.Status
+			promotionErr = err
+			if promotionErr == nil {
+				promotionErr = newMonacoError(KindExecution, "stage %s failed: %s", stage, stageResult.Message)
+			}
+		}
+
+		statusMessage := fmt.Sprintf("Monaco deployed stage %s (%d of %d): %s", stage, i+1, len(stages), stageResult.Result)
+		if _, err := myKeptn.SendTaskStatusChangedEvent(&keptnv2.EventData{Message: statusMessage}, eventSource); err != nil {
+			log.Printf("Could not send status.changed event: %v", err)
+		}
+	}
+	promotion.Duration = time.Since(promotionStart).Round(time.Millisecond).String()
+
+	finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+		Status:  keptnv2.StatusSucceeded,
+		Result:  keptnv2.ResultPass,
+		Message: fmt.Sprintf("Successfully promoted monaco configuration through %d stages", len(stages)),
+	})
+	if promotionErr != nil {
+		finishedData.Status = failedStatus
+		finishedData.Result = keptnv2.ResultFailed
+		finishedData.Message = fmt.Sprintf("Monaco promotion failed: %d succeeded, %d failed, %d skipped stages", promotion.Succeeded, promotion.Failed, promotion.Skipped)
+	}
+	finishedData.Monaco.Promotion = promotion
+	if _, err := myKeptn.SendTaskFinishedEvent(finishedData, eventSource); err != nil {
+		return err
+	}
+	return promotionErr
+}
+
+// runs monaco for a single stage of a promotion and returns the result reported by its .finished event
+func runPromotionStage(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *MonacoStartedEventData, stage string) (MonacoStageResult, error) {
+	stageData := *data
+	stageData.Stage = stage
+	stageData.Monaco.Stages = nil
+	stageData.Labels = map[string]string{}
+	for key, value := range data.Labels {
+		stageData.Labels[key] = value
+	}
+
+	sender := &stageEventSender{next: myKeptn.EventSender}
+	stageKeptn := *myKeptn
+	stageKeptn.EventSender = sender
+	stageKeptn.Event = &keptnv2.EventData{Project: data.Project, Stage: stage, Service: data.Service, Labels: stageData.Labels}
+
+	// each stage is a run of its own, e.g., for the deduplication of events
+	stageEvent := incomingEvent.Clone()
+	stageEvent.SetID(incomingEvent.ID() + "-" + stage)
+
+	err := HandleMonacoTriggeredEvent(&stageKeptn, stageEvent, &stageData)
+
+	result := MonacoStageResult{Stage: stage, Status: keptnv2.StatusErrored, Result: keptnv2.ResultFailed}
+	if sender.finished == nil {
+		if err != nil {
+			result.Message = err.Error()
+		}
+		return result, err
+	}
+	stageFinished := &MonacoFinishedEventData{}
+	if decodeErr := sender.finished.DataAs(stageFinished); decodeErr != nil {
+		result.Message = decodeErr.Error()
+		return result, decodeErr
+	}
+	result.Status = stageFinished.Status
+	result.Result = stageFinished.Result
+	result.Message = stageFinished.Message
+	return result, err
+}
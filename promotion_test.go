@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func runPromotion(t *testing.T, stages []string) (*keptnv2.Keptn, error) {
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventData := &MonacoStartedEventData{}
+	if err := incomingEvent.DataAs(eventData); err != nil {
+		t.Fatal(err)
+	}
+	eventData.Monaco.Stages = stages
+	return myKeptn, HandleMonacoTriggeredEvent(myKeptn, *incomingEvent, eventData)
+}
+
+func TestHandlePromotionRollsUpStages(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+
+	myKeptn, err := runPromotion(t, []string{"dev", "staging", "production"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deployedStages := []string{}
+	for _, args := range runner.runs {
+		if !args.Options.DryRun {
+			deployedStages = append(deployedStages, args.Event.Stage)
+		}
+	}
+	if len(deployedStages) != 3 || deployedStages[0] != "dev" || deployedStages[1] != "staging" || deployedStages[2] != "production" {
+		t.Fatalf("expected the stages to be deployed in order, got %v", deployedStages)
+	}
+
+	counts := map[string]int{}
+	for _, event := range myKeptn.EventSender.(*fake.EventSender).SentEvents {
+		counts[event.Type()]++
+	}
+	if counts[keptnv2.GetStartedEventType(MonacoEvent)] != 1 || counts[keptnv2.GetFinishedEventType(MonacoEvent)] != 1 {
+		t.Errorf("expected a single started and finished event, got %v", counts)
+	}
+	if counts[keptnv2.GetStatusChangedEventType(MonacoEvent)] < 3 {
+		t.Errorf("expected a status.changed event per stage, got %v", counts)
+	}
+
+	finishedData := getFinishedEventData(t, myKeptn)
+	if finishedData.Result != keptnv2.ResultPass {
+		t.Errorf("expected the promotion to pass, got %s: %s", finishedData.Result, finishedData.Message)
+	}
+	promotion := finishedData.Monaco.Promotion
+	if promotion == nil {
+		t.Fatalf("expected a promotion rollup")
+	}
+	if promotion.Succeeded != 3 || promotion.Failed != 0 || promotion.Skipped != 0 || promotion.Duration == "" {
+		t.Errorf("unexpected rollup summary: %+v", promotion)
+	}
+	if len(promotion.Stages) != 3 {
+		t.Fatalf("expected a result per stage, got %+v", promotion.Stages)
+	}
+	for i, stage := range []string{"dev", "staging", "production"} {
+		result := promotion.Stages[i]
+		if result.Stage != stage || result.Result != keptnv2.ResultPass || result.Duration == "" {
+			t.Errorf("unexpected result of stage %s: %+v", stage, result)
+		}
+	}
+}
+
+func TestHandlePromotionSkipsStagesAfterFailure(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	defer useMonacoRunner(&fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+		if args.Event.Stage == "staging" {
+			return MonacoRunResult{Output: "deployment failed"}, errors.New("exit status 1")
+		}
+		return MonacoRunResult{}, nil
+	}})()
+
+	myKeptn, err := runPromotion(t, []string{"dev", "staging", "production"})
+	if err == nil {
+		t.Errorf("expected the failed stage to be reported")
+	}
+
+	finishedData := getFinishedEventData(t, myKeptn)
+	if finishedData.Result != keptnv2.ResultFailed {
+		t.Errorf("expected the promotion to fail, got %s", finishedData.Result)
+	}
+	promotion := finishedData.Monaco.Promotion
+	if promotion == nil || len(promotion.Stages) != 3 {
+		t.Fatalf("expected a result per stage, got %+v", promotion)
+	}
+	if promotion.Succeeded != 1 || promotion.Failed != 1 || promotion.Skipped != 1 {
+		t.Errorf("unexpected rollup summary: %+v", promotion)
+	}
+	if !promotion.Stages[2].Skipped {
+		t.Errorf("expected production to be skipped, got %+v", promotion.Stages[2])
+	}
+}
+
+func TestHandlePromotionDeploysAllStagesWithEventIDDedup(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+	defer func(original *eventIDCache) { processedEvents = original }(processedEvents)
+	processedEvents = newEventIDCache(10)
+
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventData := &MonacoStartedEventData{}
+	if err := incomingEvent.DataAs(eventData); err != nil {
+		t.Fatal(err)
+	}
+	eventData.Monaco.Stages = []string{"dev", "staging", "production"}
+	incomingEvent.SetData(cloudevents.ApplicationJSON, eventData)
+
+	if err := handleMonacoEvent(myKeptn, *incomingEvent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deployments := 0
+	for _, args := range runner.runs {
+		if !args.Options.DryRun {
+			deployments++
+		}
+	}
+	if deployments != 3 {
+		t.Errorf("expected every stage of the promotion to be deployed, got %d deployments", deployments)
+	}
+	if promotion := getFinishedEventData(t, myKeptn).Monaco.Promotion; promotion == nil || promotion.Succeeded != 3 || promotion.Skipped != 0 {
+		t.Errorf("expected all stages to succeed, got %+v", promotion)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventRateLimiter caps how many triggered events are processed, nil processes all of them (see MAX_EVENTS_PER_MINUTE)
+var eventRateLimiter *tokenBucket
+
+/**
+ * tokenBucket allows bursts of up to capacity events and refills at capacity tokens per minute
+ */
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	// tokens added per second
+	rate float64
+	last time.Time
+	now  func() time.Time
+}
+
+func newTokenBucket(eventsPerMinute int, now func() time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(eventsPerMinute),
+		tokens:   float64(eventsPerMinute),
+		rate:     float64(eventsPerMinute) / 60,
+		last:     now(),
+		now:      now,
+	}
+}
+
+// Allow takes a token from the bucket, it returns false if none is left
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// isRateLimitedEvent returns whether events of eventType count against MAX_EVENTS_PER_MINUTE: all triggered events that run monaco
+func isRateLimitedEvent(eventType string, handlers map[string]keptnEventHandler) bool {
+	_, handled := handlers[eventType]
+	return handled && strings.HasSuffix(eventType, ".triggered")
+}
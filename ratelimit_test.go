@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestTokenBucketRefills(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(60, func() time.Time { return now })
+
+	for i := 0; i < 60; i++ {
+		if !bucket.Allow() {
+			t.Fatalf("expected a burst of 60 events to be allowed, throttled event %d", i+1)
+		}
+	}
+	if bucket.Allow() {
+		t.Errorf("expected the 61st event to be throttled")
+	}
+
+	now = now.Add(time.Second)
+	if !bucket.Allow() {
+		t.Errorf("expected one event per second to be allowed again")
+	}
+	if bucket.Allow() {
+		t.Errorf("expected only one token to be refilled after a second")
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 60; i++ {
+		bucket.Allow()
+	}
+	if bucket.Allow() {
+		t.Errorf("expected the bucket not to fill beyond its capacity")
+	}
+}
+
+func TestHTTPReceiverThrottlesBursts(t *testing.T) {
+	defer func(limiter *tokenBucket, maxEvents int) {
+		eventRateLimiter = limiter
+		env.MaxEventsPerMinute = maxEvents
+	}(eventRateLimiter, env.MaxEventsPerMinute)
+	now := time.Now()
+	env.MaxEventsPerMinute = 3
+	eventRateLimiter = newTokenBucket(env.MaxEventsPerMinute, func() time.Time { return now })
+
+	var processed int32
+	defer func(handlers map[string]keptnEventHandler) { eventHandlers = handlers }(eventHandlers)
+	eventHandlers = map[string]keptnEventHandler{
+		keptnv2.GetTriggeredEventType(MonacoEvent): func(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			atomic.AddInt32(&processed, 1)
+			return nil
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newHTTPProtocol(cehttp.WithListener(listener), []string{"/"}, http.NewServeMux())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cloudevents.NewClient(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.StartReceiver(cloudevents.WithEncodingStructured(ctx), processKeptnCloudEvent)
+
+	triggeredEvent, err := ioutil.ReadFile(filepath.Join(testRootDir, "test-events/monaco.triggered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func() int {
+		resp, err := http.Post("http://"+listener.Addr().String()+"/", "application/cloudevents+json", bytes.NewReader(triggeredEvent))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	throttled := 0
+	for i := 0; i < 5; i++ {
+		if post() == http.StatusTooManyRequests {
+			throttled++
+		}
+	}
+	if throttled != 2 || atomic.LoadInt32(&processed) != 3 {
+		t.Errorf("expected 3 of a burst of 5 events to be processed and 2 to be throttled, got %d processed and %d throttled", processed, throttled)
+	}
+
+	// the bucket refills one token every 20 seconds
+	now = now.Add(20 * time.Second)
+	if status := post(); status == http.StatusTooManyRequests {
+		t.Errorf("expected the refilled bucket to accept the next event")
+	}
+	if atomic.LoadInt32(&processed) != 4 {
+		t.Errorf("expected the event after the refill to be processed, got %d processed events", processed)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// marker files next to the temp folders of a run, they only exist while the run is in progress
+const inProgressMarkerSuffix = ".inprogress.json"
+
+const serviceRestartedMessage = "monaco-service restarted while this monaco run was in progress"
+
+func getInProgressMarkerPath(keptnEvent *common.BaseKeptnEvent) string {
+	return common.GetTempMonacoFolder(keptnEvent) + inProgressMarkerSuffix
+}
+
+/**
+ * Stores the triggered event in the work directory so that an interrupted run can be finished after a restart.
+ * The returned function removes the marker once the run is finished.
+ */
+func writeInProgressMarker(incomingEvent cloudevents.Event, keptnEvent *common.BaseKeptnEvent) func() {
+	markerPath := getInProgressMarkerPath(keptnEvent)
+
+	eventJSON, err := json.Marshal(incomingEvent)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(markerPath), common.WorkDirPermissions)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(markerPath, eventJSON, common.WorkFilePermissions)
+	}
+	if err != nil {
+		log.Printf("Could not write in-progress marker %s: %v", markerPath, err)
+		return func() {}
+	}
+
+	return func() { os.Remove(markerPath) }
+}
+
+/**
+ * Sends an errored .finished event for every run that was still in progress when the service stopped,
+ * so the Keptn sequences waiting for them don't hang forever. Returns the number of recovered runs.
+ */
+func recoverInProgressRuns(workDir string, opts keptn.KeptnOpts) int {
+	recovered := 0
+	for _, markerPath := range findInProgressMarkers(workDir) {
+		if err := finishInterruptedRun(markerPath, opts); err != nil {
+			log.Printf("Could not recover in-progress run %s: %v", markerPath, err)
+			continue
+		}
+		os.Remove(markerPath)
+		recovered++
+	}
+
+	if recovered > 0 {
+		log.Printf("Recovered %d monaco runs that were interrupted by a restart", recovered)
+	}
+	return recovered
+}
+
+// findInProgressMarkers returns the in-progress markers next to the temp folders in the per project folders of workDir
+func findInProgressMarkers(workDir string) []string {
+	markers := []string{}
+	filepath.Walk(workDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && tempFolderNamePattern.MatchString(info.Name()) {
+			// the files of a run never contain markers
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), inProgressMarkerSuffix) {
+			markers = append(markers, path)
+		}
+		return nil
+	})
+	return markers
+}
+
+// temp folders of runs are named <keptncontext>-<stage>, see common.GetTempMonacoFolder
+var tempFolderNamePattern = regexp.MustCompile(`^[0-9a-zA-Z]{8}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{4}-[0-9a-zA-Z]{12}-.+$`)
+
+/**
+ * Removes the temp folders of runs below workDir (and its per project folders) that were last modified before
+ * now - maxAge, e.g., because the service crashed mid-deployment. Returns the number of removed folders.
+ */
+func cleanupOrphanedTempFolders(workDir string, maxAge time.Duration, now time.Time) int {
+	cleaned := 0
+	filepath.Walk(workDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || !tempFolderNamePattern.MatchString(info.Name()) {
+			return nil
+		}
+		if now.Sub(info.ModTime()) > maxAge {
+			if err := os.RemoveAll(path); err != nil {
+				log.Printf("Could not remove orphaned temp folder %s: %v", path, err)
+				return filepath.SkipDir
+			}
+			cleaned++
+		}
+		return filepath.SkipDir
+	})
+
+	log.Printf("Removed %d orphaned temp folders older than %s", cleaned, maxAge)
+	return cleaned
+}
+
+func finishInterruptedRun(markerPath string, opts keptn.KeptnOpts) error {
+	eventJSON, err := ioutil.ReadFile(markerPath)
+	if err != nil {
+		return err
+	}
+
+	incomingEvent := cloudevents.NewEvent()
+	if err := json.Unmarshal(eventJSON, &incomingEvent); err != nil {
+		return err
+	}
+
+	myKeptn, err := keptnv2.NewKeptn(&incomingEvent, opts)
+	if err != nil {
+		return err
+	}
+
+	finishedData := newMonacoFinishedEventData(&keptnv2.EventData{
+		Status:  keptnv2.StatusErrored,
+		Result:  keptnv2.ResultFailed,
+		Message: serviceRestartedMessage,
+	})
+	_, err = myKeptn.SendTaskFinishedEvent(finishedData, eventSource)
+	return err
+}
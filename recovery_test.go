@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func TestRecoverInProgressRuns(t *testing.T) {
+	workDir, _ := ioutil.TempDir("", "monaco-service-test")
+	defer os.RemoveAll(workDir)
+
+	triggeredEvent, err := ioutil.ReadFile(filepath.Join(testRootDir, "test-events/monaco.triggered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	markerPath := filepath.Join(workDir, "08735340-6f9e-4b32-97ff-3b6c292bc50h-dev"+inProgressMarkerSuffix)
+	ioutil.WriteFile(markerPath, triggeredEvent, 0600)
+	// temp folders of runs are left alone
+	os.Mkdir(filepath.Join(workDir, "08735340-6f9e-4b32-97ff-3b6c292bc50h-dev"), os.ModePerm)
+
+	eventSender := &fake.EventSender{}
+	recovered := recoverInProgressRuns(workDir, keptn.KeptnOpts{EventSender: eventSender})
+
+	if recovered != 1 {
+		t.Fatalf("expected 1 recovered run, got %d", recovered)
+	}
+	if err := eventSender.AssertSentEventTypes([]string{keptnv2.GetFinishedEventType(MonacoEvent)}); err != nil {
+		t.Fatal(err)
+	}
+
+	finishedData := &MonacoFinishedEventData{}
+	eventSender.SentEvents[0].DataAs(finishedData)
+	if finishedData.Status != keptnv2.StatusErrored || finishedData.Message != serviceRestartedMessage {
+		t.Errorf("expected an errored finished event about the restart, got %s: %s", finishedData.Status, finishedData.Message)
+	}
+	if finishedData.Project != "sockshop" || finishedData.Stage != "dev" {
+		t.Errorf("expected the finished event to reference the interrupted run, got %s/%s", finishedData.Project, finishedData.Stage)
+	}
+	if _, err := os.Stat(markerPath); !os.IsNotExist(err) {
+		t.Errorf("expected the marker to be removed")
+	}
+}
+
+func TestInProgressMarkerIsRemovedAfterRun(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+
+	runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+
+	markers, _ := filepath.Glob(filepath.Join("tmp/monaco", "*"+inProgressMarkerSuffix))
+	if len(markers) != 0 {
+		t.Errorf("expected no in-progress markers after the run, got %v", markers)
+	}
+}
+
+func TestCleanupOrphanedTempFolders(t *testing.T) {
+	workDir, _ := ioutil.TempDir("", "monaco-service-test")
+	defer os.RemoveAll(workDir)
+
+	now := time.Now()
+	oldFolder := filepath.Join(workDir, "08735340-6f9e-4b32-97ff-3b6c292bc50h-dev")
+	freshFolder := filepath.Join(workDir, "5c3a2e17-1b2f-4c8e-9d3a-0f6b7e8a9c1d-dev")
+	otherFolder := filepath.Join(workDir, "not-a-temp-folder")
+	for _, folder := range []string{oldFolder, freshFolder, otherFolder} {
+		os.MkdirAll(filepath.Join(folder, "projects"), os.ModePerm)
+	}
+	os.Chtimes(oldFolder, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+	os.Chtimes(otherFolder, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+
+	if cleaned := cleanupOrphanedTempFolders(workDir, 24*time.Hour, now); cleaned != 1 {
+		t.Errorf("expected one folder to be removed, got %d", cleaned)
+	}
+	if _, err := os.Stat(oldFolder); !os.IsNotExist(err) {
+		t.Errorf("expected the old temp folder to be removed")
+	}
+	for _, folder := range []string{freshFolder, otherFolder} {
+		if _, err := os.Stat(folder); err != nil {
+			t.Errorf("expected %s to be kept: %v", folder, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// prefix of the redis keys of deployment locks
+const redisLockPrefix = "monaco-service:lock:"
+
+// how often a waiting replica checks whether the lock is free again
+const redisLockRetryInterval = 100 * time.Millisecond
+
+// releases the lock only if it is still held by the token, so an expired lock taken over by another replica is kept
+var redisUnlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// extends the lock only if it is still held by the token
+var redisRefreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+/**
+ * redisLocker locks deployments across all replicas of the service that share the redis server. A lock expires
+ * after ttl unless its holder is still running and refreshes it, so a crashed replica doesn't block others forever.
+ */
+type redisLocker struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func newRedisLocker(redisURL string, ttl time.Duration) (*redisLocker, error) {
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("the lock TTL must be positive, got %s", ttl)
+	}
+	return &redisLocker{client: redis.NewClient(options), ttl: ttl}, nil
+}
+
+/**
+ * Lock waits at most timeout for the key to become free (0 waits forever) and returns the function releasing it.
+ * The returned context is cancelled if the lock can't be refreshed, another replica may have taken it over then.
+ */
+func (l *redisLocker) Lock(ctx context.Context, key string, timeout time.Duration) (context.Context, func(), error) {
+	token, err := newLockToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	redisKey := redisLockPrefix + key
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		acquired, err := l.client.SetNX(ctx, redisKey, token, l.ttl).Result()
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("stopped waiting for another deployment of %s to finish: %w", key, ctx.Err())
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not lock %s: %v", key, err)
+		}
+		if acquired {
+			break
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, nil, fmt.Errorf("timed out after %s waiting for another deployment of %s to finish", timeout, key)
+		}
+		select {
+		case <-time.After(redisLockRetryInterval):
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("stopped waiting for another deployment of %s to finish: %w", key, ctx.Err())
+		}
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	stopRefresh := make(chan struct{})
+	go l.refresh(redisKey, token, stopRefresh, cancel)
+	return lockCtx, func() {
+		close(stopRefresh)
+		cancel()
+		if err := redisUnlockScript.Run(context.Background(), l.client, []string{redisKey}, token).Err(); err != nil {
+			log.Printf("Could not release the deployment lock %s, it expires after %s: %v", key, l.ttl, err)
+		}
+	}, nil
+}
+
+// refresh extends the lock every third of its ttl until stop is closed, lost calls cancel once the lock is lost
+func (l *redisLocker) refresh(redisKey string, token string, stop chan struct{}, lost context.CancelFunc) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			refreshed, err := redisRefreshScript.Run(context.Background(), l.client, []string{redisKey}, token, l.ttl.Milliseconds()).Int()
+			if err == nil && refreshed == 0 {
+				err = errors.New("the lock is held by another replica")
+			}
+			if err != nil {
+				log.Printf("Could not refresh the deployment lock %s, cancelling the deployment: %v", redisKey, err)
+				lost()
+				return
+			}
+		}
+	}
+}
+
+// newLockToken identifies the holder of a lock
+func newLockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("could not create a lock token: %v", err)
+	}
+	return hex.EncodeToString(token), nil
+}
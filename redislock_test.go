@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisLockers returns two lockers sharing a miniredis server, like two replicas of the service
+func newTestRedisLockers(t *testing.T, ttl time.Duration) (*miniredis.Miniredis, *redisLocker, *redisLocker) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := newRedisLocker("redis://"+server.Addr(), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newRedisLocker("redis://"+server.Addr(), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, first, second
+}
+
+func TestRedisLockerMutualExclusion(t *testing.T) {
+	server, first, second := newTestRedisLockers(t, time.Minute)
+	defer server.Close()
+
+	_, unlock, err := first.Lock(context.Background(), "sockshop/dev/env", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := second.Lock(context.Background(), "sockshop/dev/env", 200*time.Millisecond); err == nil {
+		t.Errorf("expected the other replica to time out while the key is locked")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := second.Lock(ctx, "sockshop/dev/env", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the other replica to stop waiting when its context is done, got %v", err)
+	}
+	_, unlockOther, err := second.Lock(context.Background(), "sockshop/prod/env", 200*time.Millisecond)
+	if err != nil {
+		t.Errorf("expected a different key not to be blocked: %v", err)
+	} else {
+		unlockOther()
+	}
+
+	unlock()
+	_, unlock, err = second.Lock(context.Background(), "sockshop/dev/env", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected the key to be free again: %v", err)
+	}
+	unlock()
+
+	// deployments of both replicas never overlap
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(locker *redisLocker) {
+			defer wg.Done()
+			_, unlock, err := locker.Lock(context.Background(), "sockshop/dev/env", 10*time.Second)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			unlock()
+		}([]*redisLocker{first, second}[i%2])
+	}
+	wg.Wait()
+	if maxRunning != 1 {
+		t.Errorf("expected one deployment at a time, got %d", maxRunning)
+	}
+}
+
+func TestRedisLockerExpiresLockOfCrashedReplica(t *testing.T) {
+	server, first, second := newTestRedisLockers(t, time.Minute)
+	defer server.Close()
+
+	// a replica that crashed while holding the lock doesn't refresh it anymore
+	server.Set(redisLockPrefix+"sockshop/dev/env", "crashed-replica")
+	server.SetTTL(redisLockPrefix+"sockshop/dev/env", time.Minute)
+	if _, _, err := first.Lock(context.Background(), "sockshop/dev/env", 200*time.Millisecond); err == nil {
+		t.Fatalf("expected the key to be locked by the crashed replica")
+	}
+
+	server.FastForward(time.Minute)
+	_, unlock, err := first.Lock(context.Background(), "sockshop/dev/env", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected the lock to expire: %v", err)
+	}
+
+	// a late release of a lock that expired and was taken over keeps the lock of the new holder
+	server.FastForward(time.Minute)
+	_, unlockSecond, err := second.Lock(context.Background(), "sockshop/dev/env", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected the expired lock to be taken over: %v", err)
+	}
+	unlock()
+	if !server.Exists(redisLockPrefix + "sockshop/dev/env") {
+		t.Errorf("expected the lock of the new holder to be kept")
+	}
+	unlockSecond()
+	if server.Exists(redisLockPrefix + "sockshop/dev/env") {
+		t.Errorf("expected the lock to be released")
+	}
+}
+
+func TestRedisLockerCancelsContextOfLostLock(t *testing.T) {
+	server, first, _ := newTestRedisLockers(t, 300*time.Millisecond)
+	defer server.Close()
+
+	lockCtx, unlock, err := first.Lock(context.Background(), "sockshop/dev/env", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unlock()
+
+	// the lock expired and was taken over by another replica
+	server.Set(redisLockPrefix+"sockshop/dev/env", "other-replica")
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Errorf("expected the context of the lost lock to be cancelled")
+	}
+	if holder, _ := server.Get(redisLockPrefix + "sockshop/dev/env"); holder != "other-replica" {
+		t.Errorf("expected the lock of the other replica to be kept, got %s", holder)
+	}
+}
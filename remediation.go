@@ -0,0 +1,42 @@
+package main
+
+import "regexp"
+
+// monacoRemediationHintLabel is the label of the .finished event holding actionable guidance for a known failure
+const monacoRemediationHintLabel = "monaco.remediationHint"
+
+// remediationHint maps a known failure, detected in the error and the monaco output, to a hint how to fix it
+type remediationHint struct {
+	pattern *regexp.Regexp
+	hint    string
+}
+
+// hints of known failures, the first matching one is used
+var remediationHints = []remediationHint{
+	{
+		pattern: regexp.MustCompile(`(?i)\b401\b|unauthorized|invalid token|token (is )?(expired|missing required scope)|authentication failed`),
+		hint:    "Check that the API token of the Dynatrace secret (DT_API_TOKEN) is valid, not expired and has the scopes monaco needs to read and write configuration",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)\b429\b|too many requests|rate limit`),
+		hint:    "The Dynatrace API rate limit was exceeded: retry the sequence later, set DEPLOY_THROTTLE=true or lower MAX_PARALLEL_DEPLOYMENTS",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)yaml: |invalid character .* looking for|cannot unmarshal|unexpected end of json|failed to parse|malformed`),
+		hint:    "The monaco files contain malformed YAML or JSON: validate them, e.g., by running monaco with --dry-run locally",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)no such host|connection refused|i/o timeout|x509: `),
+		hint:    "The Dynatrace environment could not be reached: check DT_TENANT, HTTPS_PROXY_URL and DT_CA_CERT_PATH",
+	},
+}
+
+// getRemediationHint returns the hint of the first known failure found in text, empty if the failure is unknown
+func getRemediationHint(text string) string {
+	for _, remediation := range remediationHints {
+		if remediation.pattern.MatchString(text) {
+			return remediation.hint
+		}
+	}
+	return ""
+}
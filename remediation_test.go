@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHandleMonacoTriggeredEventAddsRemediationHint(t *testing.T) {
+	tests := []struct {
+		name         string
+		monacoScript string
+		expectedHint string
+	}{
+		{
+			name:         "invalid token",
+			monacoScript: "echo 'Failed to get existing configs: 401 Unauthorized: Token Authentication failed'; exit 1",
+			expectedHint: remediationHints[0].hint,
+		},
+		{
+			name:         "rate limit",
+			monacoScript: "echo 'Failed to upsert auto-tag tagging: 429 Too Many Requests'; exit 1",
+			expectedHint: remediationHints[1].hint,
+		},
+		{
+			name:         "malformed config",
+			monacoScript: "echo 'Error while parsing config: yaml: line 3: mapping values are not allowed in this context'; exit 1",
+			expectedHint: remediationHints[2].hint,
+		},
+		{
+			name:         "unknown failure",
+			monacoScript: "echo 'something went wrong'; exit 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, tt.monacoScript, nil)()
+
+			myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+			var monacoErr *MonacoError
+			if !errors.As(err, &monacoErr) || monacoErr.Kind != KindExecution {
+				t.Fatalf("expected an execution error, got %v", err)
+			}
+
+			finishedData := getFinishedEventData(t, myKeptn)
+			if hint := finishedData.Labels[monacoRemediationHintLabel]; hint != tt.expectedHint {
+				t.Errorf("expected the label %s=%q, got %q", monacoRemediationHintLabel, tt.expectedHint, hint)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// maximum size of a CloudEvent posted to /replay
+const maxReplayBodySize = 1 << 20
+
+// ReplayResult is returned by the /replay endpoint
+type ReplayResult struct {
+	ID     string `json:"id,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Status string `json:"status"`
+	// whether a handler is registered for the type of the event, events without one are ignored
+	Handled bool   `json:"handled"`
+	Error   string `json:"error,omitempty"`
+}
+
+/**
+ * Serves /replay: feeds the CloudEvent in the body of a POST request through processKeptnCloudEvent just like an event
+ * received from the distributor and returns the outcome. Requests have to authenticate with "Authorization: Bearer <token>".
+ */
+func newReplayHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeReplayResult(w, http.StatusMethodNotAllowed, ReplayResult{Status: "rejected", Error: "only POST is allowed"})
+			return
+		}
+		if !isAuthorizedReplay(r, token) {
+			writeReplayResult(w, http.StatusUnauthorized, ReplayResult{Status: "rejected", Error: "invalid or missing token"})
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReplayBodySize))
+		if err != nil {
+			writeReplayResult(w, http.StatusBadRequest, ReplayResult{Status: "rejected", Error: err.Error()})
+			return
+		}
+		event := cloudevents.NewEvent()
+		if err := json.Unmarshal(body, &event); err != nil {
+			writeReplayResult(w, http.StatusBadRequest, ReplayResult{Status: "rejected", Error: "invalid CloudEvent: " + err.Error()})
+			return
+		}
+		if err := event.Validate(); err != nil {
+			writeReplayResult(w, http.StatusBadRequest, ReplayResult{Status: "rejected", Error: "invalid CloudEvent: " + err.Error()})
+			return
+		}
+
+		log.Printf("Replaying %s event %s", event.Type(), event.ID())
+		// replayed events were usually processed before, they must not be skipped as duplicates (EVENT_ID_DEDUP)
+		if processedEvents != nil {
+			processedEvents.Forget(event.ID())
+		}
+		_, handled := eventHandlers[event.Type()]
+		result := ReplayResult{ID: event.ID(), Type: event.Type(), Status: "processed", Handled: handled}
+		if err := processKeptnCloudEvent(r.Context(), event); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		writeReplayResult(w, http.StatusOK, result)
+	}
+}
+
+// isAuthorizedReplay compares the bearer token of the request in constant time
+func isAuthorizedReplay(r *http.Request, token string) bool {
+	const prefix = "Bearer "
+	authorization := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(authorization, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, prefix)), []byte(token)) == 1
+}
+
+func writeReplayResult(w http.ResponseWriter, status int, result ReplayResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
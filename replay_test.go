@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func TestReplayProcessesEvent(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	handlers, err := newEventHandlers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(original map[string]keptnEventHandler) { eventHandlers = original }(eventHandlers)
+	eventHandlers = handlers
+
+	eventFile, err := ioutil.ReadFile(filepath.Join(testRootDir, "test-events/monaco.triggered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newReplayHandler("s3cr3t")
+
+	tests := []struct {
+		name           string
+		method         string
+		authorization  string
+		body           []byte
+		expectedStatus int
+		expectedRuns   int
+	}{
+		{name: "authorized", method: http.MethodPost, authorization: "Bearer s3cr3t", body: eventFile, expectedStatus: http.StatusOK, expectedRuns: 2},
+		{name: "missing token", method: http.MethodPost, body: eventFile, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, authorization: "Bearer guess", body: eventFile, expectedStatus: http.StatusUnauthorized},
+		{name: "not a POST", method: http.MethodGet, authorization: "Bearer s3cr3t", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "invalid event", method: http.MethodPost, authorization: "Bearer s3cr3t", body: []byte(`{"type": "sh.keptn.event.monaco.triggered"}`), expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{}
+			defer useMonacoRunner(runner)()
+			eventSender := &fake.EventSender{}
+			defer func() { keptnOptions.EventSender = nil }()
+			keptnOptions.EventSender = eventSender
+			// the replayed event was processed before, with the default EVENT_ID_DEDUP it would be a duplicate
+			defer func(original *eventIDCache) { processedEvents = original }(processedEvents)
+			processedEvents = newEventIDCache(10)
+			processedEvents.Seen("f2b878d3-03c0-4e8f-bc3f-454bc1b3d79b")
+			defer func(enabled bool) { env.EventIDDedup = enabled }(env.EventIDDedup)
+			env.EventIDDedup = true
+
+			request := httptest.NewRequest(tt.method, "/replay", bytes.NewReader(tt.body))
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+			result := ReplayResult{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+				t.Fatalf("expected a JSON result, got %s", recorder.Body.String())
+			}
+			if len(runner.runs) != tt.expectedRuns {
+				t.Errorf("expected %d monaco runs, got %d", tt.expectedRuns, len(runner.runs))
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if result.Status != "processed" || !result.Handled || result.Type != keptnv2.GetTriggeredEventType("monaco") {
+				t.Errorf("expected the monaco event to be processed, got %+v", result)
+			}
+			finished := false
+			for _, event := range eventSender.SentEvents {
+				finished = finished || event.Type() == keptnv2.GetFinishedEventType("monaco")
+			}
+			if !finished {
+				t.Errorf("expected the replayed event to be finished")
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// ResourceWriter writes files to the Keptn config repo
+type ResourceWriter interface {
+	WriteResources(keptnEvent *common.BaseKeptnEvent, resources map[string]string) error
+}
+
+// resourceWriter writes the exported configs and uploaded logs of the runs, tests replace it with a fake
+var resourceWriter ResourceWriter = keptnResourceWriter{}
+
+// keptnResourceWriter uploads the files to the service of the event via the Keptn resource API
+type keptnResourceWriter struct{}
+
+func (keptnResourceWriter) WriteResources(keptnEvent *common.BaseKeptnEvent, resources map[string]string) error {
+	return common.UploadKeptnResources(resources, keptnEvent)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// sh.keptn.event.service.delete.finished, sent by Keptn once a service was removed from a project
+var serviceDeleteFinishedEventType = keptnv2.GetFinishedEventType(keptnv2.ServiceDeleteTaskName)
+
+// label confirming that the Dynatrace configs of the delete.yaml are deleted together with the service
+const confirmDeleteLabel = "monaco.confirmDelete"
+
+/**
+ * Deletes the Dynatrace configs listed in the dynatrace/delete.yaml of the project once a service was deleted.
+ * Nothing is deleted unless the event has the label monaco.confirmDelete=true. As the event is the .finished event of
+ * another task, the outcome is only logged.
+ */
+func handleServiceDeleteEvent(myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+	eventData := &keptnv2.ServiceDeleteFinishedEventData{}
+	if err := parseKeptnCloudEventPayload(event, eventData); err != nil {
+		return err
+	}
+	logger := newEventLogger(event)
+
+	if eventData.Status != keptnv2.StatusSucceeded || eventData.Result == keptnv2.ResultFailed {
+		logger.Info(fmt.Sprintf("Ignoring %s, the service %s was not deleted: %s", event.ID(), eventData.GetService(), eventData.Message))
+		return nil
+	}
+	if confirmed, _ := strconv.ParseBool(eventData.GetLabels()[confirmDeleteLabel]); !confirmed {
+		logger.Info(fmt.Sprintf("Ignoring %s, deleting the Dynatrace configs of service %s requires the label %s=true", event.ID(), eventData.GetService(), confirmDeleteLabel))
+		return nil
+	}
+
+	var shkeptncontext string
+	event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
+	keptnEvent := &common.BaseKeptnEvent{
+		Project: eventData.GetProject(),
+		Stage:   eventData.GetStage(),
+		Service: eventData.GetService(),
+		Labels:  eventData.GetLabels(),
+		Context: shkeptncontext,
+	}
+
+	err := deleteServiceConfigs(keptnEvent, logger)
+	if errors.Is(err, common.ErrNoDeleteFile) {
+		logger.Info(fmt.Sprintf("Not deleting Dynatrace configs of service %s: %v", keptnEvent.Service, err))
+		return nil
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Deleting the Dynatrace configs of service %s failed: %v", keptnEvent.Service, err))
+		return err
+	}
+	logger.Info(fmt.Sprintf("Deleted the Dynatrace configs of service %s in project %s", keptnEvent.Service, keptnEvent.Project))
+	return nil
+}
+
+// deleteServiceConfigs runs monaco with the delete.yaml of the project of keptnEvent
+func deleteServiceConfigs(keptnEvent *common.BaseKeptnEvent, logger Logger) error {
+	defer cleanupTempFolder(keptnEvent, logger)
+
+	environment := keptnEvent.Labels[environmentLabel]
+	if common.IsEnvironmentPattern(environment) {
+		environment = ""
+	}
+	dtCredentials, err := getDynatraceCredentials("", keptnEvent.Project, "", environment)
+	if err != nil {
+		return fmt.Errorf("failed to fetch Dynatrace credentials: %w", err)
+	}
+	keptnEvent.Tenant = dtCredentials.Tenant
+
+	options := common.MonacoCommandOptions{
+		TokenDelivery:  env.TokenDelivery,
+		CLIVersion:     env.MonacoVersion,
+		Environment:    keptnEvent.Labels[environmentLabel],
+		User:           monacoUser,
+		SecretPatterns: secretPatterns,
+	}
+	options.DeleteFile, options.ManifestPath, err = common.PrepareDeleteFiles(keptnEvent, env.MonacoVersion)
+	if err != nil {
+		return err
+	}
+	if options.ManifestPath != "" && common.IsEnvironmentPattern(options.Environment) {
+		environments, err := common.ExpandEnvironmentPattern(options.ManifestPath, options.Environment)
+		if err != nil {
+			return fmt.Errorf("invalid label %s: %w", environmentLabel, err)
+		}
+		dtCredentials, err = getEnvironmentsCredentials("", keptnEvent.Project, "", environments)
+		if err != nil {
+			return fmt.Errorf("failed to fetch Dynatrace credentials: %w", err)
+		}
+		keptnEvent.Tenant = dtCredentials.Tenant
+		options.Environment = strings.Join(environments, ",")
+	}
+
+	// deployments to the project don't run concurrently with the deletion
+	lockCtx, unlock, err := deploymentLocks.Lock(context.Background(), getDeploymentLockKey(keptnEvent.Project, keptnEvent.Stage, dtCredentials.Tenant), env.DeploymentLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ctx, cancel := newMonacoContext(lockCtx)
+	defer cancel()
+	result, err := monacoRunner.Run(ctx, MonacoArgs{Credentials: dtCredentials, Event: keptnEvent, Options: options})
+	logger.Info(fmt.Sprintf("Monaco delete output:\n%s", redactMonacoOutput(result.Output, dtCredentials, options)))
+	if err != nil {
+		return classifyMonacoExecutionError(ctx, "delete", err)
+	}
+	return nil
+}
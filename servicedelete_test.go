@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// runs handleServiceDeleteEvent for the service-delete fixture with its labels replaced by labels
+func runServiceDeleteEvent(t *testing.T, labels map[string]string) error {
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/service.delete.finished.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels != nil {
+		eventData := &keptnv2.ServiceDeleteFinishedEventData{}
+		if err := incomingEvent.DataAs(eventData); err != nil {
+			t.Fatal(err)
+		}
+		eventData.Labels = labels
+		incomingEvent.SetData("application/json", eventData)
+	}
+	return handleServiceDeleteEvent(myKeptn, *incomingEvent)
+}
+
+func TestHandleServiceDeleteEvent(t *testing.T) {
+	const deleteFile = "delete:\n  - \"auto-tag/$SERVICE\"\n  - \"dashboard/$SERVICE-overview\"\n"
+
+	t.Run("monaco v1", func(t *testing.T) {
+		defer setupTestWorkDir(t, "", map[string]string{common.DeleteFilename: deleteFile})()
+		runner := &fakeRunner{}
+		defer useMonacoRunner(runner)()
+
+		if err := runServiceDeleteEvent(t, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(runner.runs) != 1 {
+			t.Fatalf("expected a single monaco run, got %d", len(runner.runs))
+		}
+		options := runner.runs[0].Options
+		if options.DeleteFile != "monaco-test/delete/delete.yaml" || options.DryRun {
+			t.Errorf("expected monaco to delete the configs of monaco-test/delete/delete.yaml, got %+v", options)
+		}
+		deleted, _ := ioutil.ReadFile(options.DeleteFile)
+		if string(deleted) != "delete:\n  - \"auto-tag/carts\"\n  - \"dashboard/carts-overview\"\n" {
+			t.Errorf("expected the placeholders of the delete file to be replaced, got:\n%s", deleted)
+		}
+		if runner.runs[0].Credentials.Tenant != "https://abc12345.live.dynatrace.com" {
+			t.Errorf("expected the configs to be deleted from the Dynatrace environment of the project, got %s", runner.runs[0].Credentials.Tenant)
+		}
+	})
+
+	t.Run("monaco v2", func(t *testing.T) {
+		defer func(version string) { env.MonacoVersion = version }(env.MonacoVersion)
+		env.MonacoVersion = common.MonacoCLIVersion2
+		defer setupTestWorkDir(t, "", map[string]string{
+			common.DeleteFilename:     deleteFile,
+			"dynatrace/manifest.yaml": "manifestVersion: 1.0\n",
+		})()
+		runner := &fakeRunner{}
+		defer useMonacoRunner(runner)()
+
+		if err := runServiceDeleteEvent(t, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(runner.runs) != 1 || runner.runs[0].Options.ManifestPath != "monaco-test/manifest.yaml" {
+			t.Fatalf("expected a single monaco run with the manifest of the project, got %+v", runner.runs)
+		}
+	})
+
+	t.Run("not confirmed", func(t *testing.T) {
+		defer setupTestWorkDir(t, "", map[string]string{common.DeleteFilename: deleteFile})()
+		runner := &fakeRunner{}
+		defer useMonacoRunner(runner)()
+
+		if err := runServiceDeleteEvent(t, map[string]string{confirmDeleteLabel: "false"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(runner.runs) != 0 {
+			t.Errorf("expected nothing to be deleted without %s=true, got %d runs", confirmDeleteLabel, len(runner.runs))
+		}
+	})
+
+	t.Run("no delete file", func(t *testing.T) {
+		defer setupTestWorkDir(t, "", nil)()
+		runner := &fakeRunner{}
+		defer useMonacoRunner(runner)()
+
+		if err := runServiceDeleteEvent(t, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(runner.runs) != 0 {
+			t.Errorf("expected monaco not to run, got %d runs", len(runner.runs))
+		}
+	})
+}
+
+func TestNewEventHandlersHandleServiceDelete(t *testing.T) {
+	handlers, err := newEventHandlers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := handlers["sh.keptn.event.service.delete.finished"]; !ok {
+		t.Errorf("expected sh.keptn.event.service.delete.finished to be handled")
+	}
+	if isRateLimitedEvent("sh.keptn.event.service.delete.finished", handlers) {
+		t.Errorf("expected service deletions not to count against the event rate limit")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Layouts of the payload of the monaco.triggered event, selected by its specVersion:
+ * 1.0 (legacy, the default without specVersion) has the git branch next to the Keptn fields as gitBranch,
+ * 2.0 keeps all monaco specific parameters in the monaco block, including monaco.gitBranch.
+ */
+const MonacoSpecVersionLegacy = "1.0"
+const MonacoSpecVersion2 = "2.0"
+
+// supportedMonacoSpecVersions are listed in the error about unsupported versions
+var supportedMonacoSpecVersions = []string{MonacoSpecVersionLegacy, MonacoSpecVersion2}
+
+/**
+ * Moves the parameters of the payload layout of data.SpecVersion to where the handlers expect them and sets the
+ * version explicitly. Payloads without specVersion are legacy payloads, future versions are rejected with an error.
+ */
+func applyMonacoSpecVersion(data *MonacoStartedEventData) error {
+	switch strings.TrimSpace(data.SpecVersion) {
+	case "", "1", MonacoSpecVersionLegacy:
+		// monaco.gitBranch is not part of the legacy layout
+		data.SpecVersion = MonacoSpecVersionLegacy
+		data.Monaco.GitBranch = ""
+	case "2", MonacoSpecVersion2:
+		data.SpecVersion = MonacoSpecVersion2
+		data.GitBranch = data.Monaco.GitBranch
+	default:
+		return fmt.Errorf("unsupported specVersion '%s' of the %s payload, supported versions are %s", data.SpecVersion, MonacoEvent, strings.Join(supportedMonacoSpecVersions, ", "))
+	}
+	return nil
+}
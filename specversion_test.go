@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestApplyMonacoSpecVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		payload         string
+		wantSpecVersion string
+		wantGitBranch   string
+		wantErr         string
+	}{
+		{name: "legacy without specVersion", payload: `{"gitBranch":"release-1","monaco":{"gitBranch":"ignored"}}`, wantSpecVersion: MonacoSpecVersionLegacy, wantGitBranch: "release-1"},
+		{name: "legacy", payload: `{"specVersion":"1.0","gitBranch":"release-1"}`, wantSpecVersion: MonacoSpecVersionLegacy, wantGitBranch: "release-1"},
+		{name: "2.0", payload: `{"specVersion":"2.0","gitBranch":"ignored","monaco":{"gitBranch":"release-2"}}`, wantSpecVersion: MonacoSpecVersion2, wantGitBranch: "release-2"},
+		{name: "2.0 without branch", payload: `{"specVersion":"2","gitBranch":"ignored"}`, wantSpecVersion: MonacoSpecVersion2, wantGitBranch: ""},
+		{name: "future version", payload: `{"specVersion":"3.0","gitBranch":"release-1"}`, wantErr: "unsupported specVersion '3.0'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := cloudevents.NewEvent()
+			event.SetData(cloudevents.ApplicationJSON, json.RawMessage(tt.payload))
+			data := &MonacoStartedEventData{}
+			if err := parseKeptnCloudEventPayload(event, data); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyMonacoSpecVersion(data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data.SpecVersion != tt.wantSpecVersion || getConfigRef(data) != tt.wantGitBranch {
+				t.Errorf("expected specVersion %s and branch '%s', got %s and '%s'", tt.wantSpecVersion, tt.wantGitBranch, data.SpecVersion, getConfigRef(data))
+			}
+		})
+	}
+}
+
+func TestHandleMonacoEventRejectsUnsupportedSpecVersion(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	runner := &fakeRunner{}
+	defer useMonacoRunner(runner)()
+
+	myKeptn, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]interface{}{}
+	if err := incomingEvent.DataAs(&payload); err != nil {
+		t.Fatal(err)
+	}
+	payload["specVersion"] = "3.0"
+	incomingEvent.SetData(cloudevents.ApplicationJSON, payload)
+
+	if err := handleMonacoEvent(myKeptn, *incomingEvent); err != nil {
+		t.Fatalf("expected the delivery to be acknowledged, got %v", err)
+	}
+	if len(runner.runs) != 0 {
+		t.Errorf("expected monaco not to run, got %d runs", len(runner.runs))
+	}
+	finished := getFinishedEventData(t, myKeptn)
+	if finished.Result != keptnv2.ResultFailed || !strings.Contains(finished.Message, "supported versions are 1.0, 2.0") {
+		t.Errorf("expected a failed .finished event naming the supported versions, got %s: %s", finished.Result, finished.Message)
+	}
+}
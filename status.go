@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+/**
+ * statusReporter sends a status.changed event every STATUS_INTERVAL while monaco is running,
+ * reporting how long the run takes so far and what it is deploying
+ */
+type statusReporter struct {
+	mu       sync.Mutex
+	phase    string
+	projects string
+	started  time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+/**
+ * Starts reporting the progress of the run handled by myKeptn, returns nil if interval is 0.
+ * Stop has to be called before sending the .finished event, deferring it as well makes sure that a panicking run
+ * stops reporting too.
+ */
+func startStatusReporter(myKeptn *keptnv2.Keptn, projects string, interval time.Duration) *statusReporter {
+	if interval <= 0 {
+		return nil
+	}
+
+	r := &statusReporter{
+		projects: projects,
+		started:  time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				_, err := myKeptn.SendTaskStatusChangedEvent(&keptnv2.EventData{Message: r.message()}, eventSource)
+				if err != nil {
+					log.Printf("Could not send status.changed event: %v", err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+
+	return r
+}
+
+func (r *statusReporter) message() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message := fmt.Sprintf("Monaco is deploying %s for %s", r.projects, time.Since(r.started).Round(time.Second))
+	if r.phase != "" {
+		message += fmt.Sprintf(" (%s)", r.phase)
+	}
+	return message
+}
+
+// SetPhase updates the phase of the run (e.g., dry run) included in the following status updates
+func (r *statusReporter) SetPhase(phase string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phase = phase
+}
+
+// Stop stops the status updates and waits until no more are sent, it can be called more than once
+func (r *statusReporter) Stop() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.stopped
+}
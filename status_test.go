@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+func TestHandleMonacoTriggeredEventSendsStatusChangedEvents(t *testing.T) {
+	defer setupTestWorkDir(t, "sleep 0.3", nil)()
+	defer func(interval time.Duration) { env.StatusInterval = interval }(env.StatusInterval)
+	env.StatusInterval = 100 * time.Millisecond
+
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	eventSender := myKeptn.EventSender.(*fake.EventSender)
+	statusChanged := 0
+	for i, event := range eventSender.SentEvents {
+		if event.Type() != keptnv2.GetStatusChangedEventType(MonacoEvent) {
+			continue
+		}
+		statusChanged++
+		if i == len(eventSender.SentEvents)-1 {
+			t.Errorf("expected no status.changed event after the finished event")
+		}
+
+		statusData := &keptnv2.EventData{}
+		event.DataAs(statusData)
+		if !strings.HasPrefix(statusData.Message, "Monaco is deploying sockshop for ") {
+			t.Errorf("expected the status to name the deployed project, got %s", statusData.Message)
+		}
+	}
+	if statusChanged == 0 {
+		t.Errorf("expected at least one status.changed event, got %d events", len(eventSender.SentEvents))
+	}
+}
+
+func TestStatusReporterDisabled(t *testing.T) {
+	status := startStatusReporter(nil, "sockshop", 0)
+	if status != nil {
+		t.Errorf("expected no status reporter for interval 0")
+	}
+	// a disabled reporter can be used like an active one
+	status.SetPhase("dry run")
+	status.Stop()
+}
+
+func TestStatusReporterStopsAfterPanic(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	defer func(interval time.Duration) { env.StatusInterval = interval }(env.StatusInterval)
+	env.StatusInterval = 20 * time.Millisecond
+	defer useMonacoRunner(&fakeRunner{run: func(args MonacoArgs) (MonacoRunResult, error) {
+		time.Sleep(50 * time.Millisecond)
+		var configs map[string]int
+		configs["carts"]++
+		return MonacoRunResult{}, nil
+	}})()
+
+	eventSender := &fake.EventSender{}
+	keptnOptions.EventSender = eventSender
+	defer func() { keptnOptions.EventSender = nil }()
+
+	_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	sent := len(eventSender.SentEvents)
+	time.Sleep(100 * time.Millisecond)
+
+	if len(eventSender.SentEvents) != sent {
+		t.Errorf("expected no status.changed event after the panic, got %d more events", len(eventSender.SentEvents)-sent)
+	}
+	if last := eventSender.SentEvents[sent-1]; last.Type() != keptnv2.GetFinishedEventType(MonacoEvent) {
+		t.Errorf("expected the finished event to be the last event, got %s", last.Type())
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// deploymentTelemetry describes a finished monaco run for the telemetry backends
+type deploymentTelemetry struct {
+	Project string
+	Stage   string
+	Tenant  string
+	Result  string
+	// deployed or no-changes, empty if the run failed
+	Outcome  string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// telemetryExporter sends deployment telemetry to a metrics, tracing or webhook backend
+type telemetryExporter interface {
+	Name() string
+	Export(ctx context.Context, telemetry deploymentTelemetry) error
+}
+
+// telemetryExporters receive every finished monaco run, see exportDeploymentTelemetry
+var telemetryExporters = []telemetryExporter{prometheusExporter{}}
+
+// telemetryBreakers stop calling exporters whose backend keeps failing
+var telemetryBreakers = newCircuitBreakers()
+
+/**
+ * Sends the telemetry of a run to all exporters. Telemetry must never fail or block a deployment: errors and panics
+ * of an exporter are logged and swallowed, each export is bounded by TELEMETRY_TIMEOUT, and exporters that failed
+ * TELEMETRY_BREAKER_THRESHOLD times in a row are skipped for TELEMETRY_BREAKER_COOLDOWN.
+ */
+func exportDeploymentTelemetry(telemetry deploymentTelemetry) {
+	for _, exporter := range telemetryExporters {
+		breaker := telemetryBreakers.Get(exporter.Name())
+		if !breaker.Allow(time.Now()) {
+			continue
+		}
+
+		err := callWithTimeout(env.TelemetryTimeout, func(ctx context.Context) error {
+			return exporter.Export(ctx, telemetry)
+		})
+		if err != nil {
+			log.Printf("Could not export deployment telemetry to %s: %v", exporter.Name(), err)
+		}
+		if breaker.Record(err == nil, time.Now(), env.TelemetryBreakerThreshold, env.TelemetryBreakerCooldown) {
+			log.Printf("Telemetry backend %s failed %d times in a row, skipping it for %s", exporter.Name(), env.TelemetryBreakerThreshold, env.TelemetryBreakerCooldown)
+		}
+	}
+}
+
+// callWithTimeout runs fn and returns its error, a panic or, if fn doesn't return in time, a timeout error
+func callWithTimeout(timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/**
+ * circuitBreaker opens after threshold consecutive failures and lets a single call through once the cooldown passed,
+ * a successful call closes it again
+ */
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// Allow returns whether the backend may be called
+func (b *circuitBreaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// OpenUntil returns when the cooldown of an open breaker ends
+func (b *circuitBreaker) OpenUntil() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openUntil
+}
+
+// Record counts the result of a call and returns true if the breaker opened
+func (b *circuitBreaker) Record(success bool, now time.Time, threshold int, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if threshold <= 0 || b.failures < threshold {
+		return false
+	}
+	// after the cooldown a single failing call opens the breaker again
+	b.failures = threshold - 1
+	b.openUntil = now.Add(cooldown)
+	return true
+}
+
+type circuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{breakers: map[string]*circuitBreaker{}}
+}
+
+// Get returns the breaker of the backend name, creating it on first use
+func (b *circuitBreakers) Get(name string) *circuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker, ok := b.breakers[name]
+	if !ok {
+		breaker = &circuitBreaker{}
+		b.breakers[name] = breaker
+	}
+	return breaker
+}
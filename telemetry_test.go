@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// failingExporter fails every export, or blocks until it is cancelled
+type failingExporter struct {
+	name  string
+	block bool
+	mu    sync.Mutex
+	calls int
+}
+
+func (e *failingExporter) Name() string {
+	return e.name
+}
+
+func (e *failingExporter) Export(ctx context.Context, telemetry deploymentTelemetry) error {
+	e.mu.Lock()
+	e.calls++
+	e.mu.Unlock()
+	if e.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if e.name == "tracing" {
+		panic("tracing exporter crashed")
+	}
+	return errors.New(e.name + " backend unavailable")
+}
+
+func (e *failingExporter) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func TestDeploySucceedsWhenTelemetryBackendsFail(t *testing.T) {
+	defer setupTestWorkDir(t, "", nil)()
+	defer useMonacoRunner(&fakeRunner{})()
+
+	metrics := &failingExporter{name: "metrics"}
+	tracing := &failingExporter{name: "tracing"}
+	webhook := &failingExporter{name: "webhook", block: true}
+	defer func(exporters []telemetryExporter, breakers *circuitBreakers, timeout time.Duration) {
+		telemetryExporters = exporters
+		telemetryBreakers = breakers
+		env.TelemetryTimeout = timeout
+	}(telemetryExporters, telemetryBreakers, env.TelemetryTimeout)
+	telemetryExporters = []telemetryExporter{metrics, tracing, webhook}
+	telemetryBreakers = newCircuitBreakers()
+	env.TelemetryTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	myKeptn, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json")
+	if err != nil {
+		t.Fatalf("expected failing telemetry backends not to fail the deployment: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected a hanging telemetry backend not to block the deployment, took %s", elapsed)
+	}
+
+	finishedData := getFinishedEventData(t, myKeptn)
+	if finishedData.Result != keptnv2.ResultPass {
+		t.Errorf("expected the deployment to pass, got %s: %s", finishedData.Result, finishedData.Message)
+	}
+	for _, exporter := range []*failingExporter{metrics, tracing, webhook} {
+		if exporter.Calls() != 1 {
+			t.Errorf("expected the %s exporter to be called once, got %d", exporter.name, exporter.Calls())
+		}
+	}
+}
+
+func TestTelemetryCircuitBreakerSkipsDeadBackend(t *testing.T) {
+	metrics := &failingExporter{name: "metrics"}
+	defer func(exporters []telemetryExporter, breakers *circuitBreakers, threshold int, cooldown time.Duration) {
+		telemetryExporters = exporters
+		telemetryBreakers = breakers
+		env.TelemetryBreakerThreshold = threshold
+		env.TelemetryBreakerCooldown = cooldown
+	}(telemetryExporters, telemetryBreakers, env.TelemetryBreakerThreshold, env.TelemetryBreakerCooldown)
+	telemetryExporters = []telemetryExporter{metrics}
+	telemetryBreakers = newCircuitBreakers()
+	env.TelemetryBreakerThreshold = 3
+	env.TelemetryBreakerCooldown = time.Hour
+
+	for i := 0; i < 10; i++ {
+		exportDeploymentTelemetry(deploymentTelemetry{Project: "sockshop", Result: "pass"})
+	}
+	if metrics.Calls() != 3 {
+		t.Errorf("expected the backend to be skipped after 3 failures, got %d calls", metrics.Calls())
+	}
+}
+
+func TestCircuitBreakerRecovers(t *testing.T) {
+	breaker := &circuitBreaker{}
+	now := time.Now()
+
+	if breaker.Record(false, now, 2, time.Minute) {
+		t.Errorf("expected the breaker to stay closed after the first failure")
+	}
+	if !breaker.Record(false, now, 2, time.Minute) {
+		t.Errorf("expected the breaker to open after the second failure")
+	}
+	if breaker.Allow(now.Add(30 * time.Second)) {
+		t.Errorf("expected the breaker to be open during the cooldown")
+	}
+
+	// after the cooldown a single failure opens it again, a success closes it
+	now = now.Add(time.Minute)
+	if !breaker.Allow(now) {
+		t.Fatalf("expected a call to be allowed after the cooldown")
+	}
+	if !breaker.Record(false, now, 2, time.Minute) {
+		t.Errorf("expected a failure after the cooldown to open the breaker again")
+	}
+	now = now.Add(time.Minute)
+	breaker.Record(true, now, 2, time.Minute)
+	if breaker.Record(false, now, 2, time.Minute) {
+		t.Errorf("expected a success to reset the failures")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// once less than this share of the rate limit is left, deployments are spread over the remaining reset window
+const throttleRemainingThreshold = 0.1
+
+/**
+ * Calculates how long to wait before the next deployment so that monaco stays within the Dynatrace rate limit.
+ * The delay grows as the remaining calls shrink and never exceeds maxDelay.
+ */
+func getThrottleDelay(rateLimit *common.DTRateLimit, now time.Time, maxDelay time.Duration) time.Duration {
+	delay := time.Duration(0)
+
+	switch {
+	case rateLimit.RetryAfter > 0:
+		delay = rateLimit.RetryAfter
+	case rateLimit.Limit > 0 && rateLimit.Remaining >= 0 && !rateLimit.Reset.IsZero():
+		untilReset := rateLimit.Reset.Sub(now)
+		if untilReset <= 0 {
+			break
+		}
+		if rateLimit.Remaining == 0 {
+			delay = untilReset
+		} else if float64(rateLimit.Remaining) < float64(rateLimit.Limit)*throttleRemainingThreshold {
+			delay = untilReset / time.Duration(rateLimit.Remaining+1)
+		}
+	}
+
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+/**
+ * Checks the rate limit of the Dynatrace environment and waits accordingly before monaco gets executed.
+ * A failing preflight never blocks the deployment. The wait ends early with an error once ctx is done, e.g., when
+ * the run is aborted or its deadline passes.
+ */
+func throttleDeployment(ctx context.Context, dtCredentials *common.DTCredentials) *MonacoError {
+	if !env.DeployThrottle {
+		return nil
+	}
+
+	rateLimit, err := common.GetDTRateLimit(dtCredentials)
+	if err != nil {
+		log.Printf("Could not determine Dynatrace rate limit, not throttling: %v", err)
+		return nil
+	}
+
+	delay := getThrottleDelay(rateLimit, time.Now(), env.DeployThrottleMaxDelay)
+	if delay <= 0 {
+		return nil
+	}
+	log.Printf("Throttling deployment to %s for %s (remaining calls: %d of %d)", dtCredentials.Tenant, delay, rateLimit.Remaining, rateLimit.Limit)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return classifyMonacoExecutionError(ctx, "deployment", fmt.Errorf("interrupted while throttling for %s: %w", delay, ctx.Err()))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+func TestThrottleAdjustsToRateLimitHeaders(t *testing.T) {
+	now := time.Now()
+	reset := now.Add(10 * time.Second)
+
+	tests := []struct {
+		name       string
+		remaining  string
+		retryAfter string
+		expected   time.Duration
+	}{
+		{name: "plenty of calls left", remaining: "900", expected: 0},
+		{name: "few calls left", remaining: "49", expected: 200 * time.Millisecond},
+		{name: "limit exhausted", remaining: "0", expected: 10 * time.Second},
+		{name: "too many requests", remaining: "0", retryAfter: "3", expected: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Api-Token dt0c01.TESTTOKEN" {
+					t.Errorf("expected the API token to be sent, got %s", r.Header.Get("Authorization"))
+				}
+				w.Header().Set("X-RateLimit-Limit", "1000")
+				w.Header().Set("X-RateLimit-Remaining", tt.remaining)
+				w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", reset.UnixNano()/int64(time.Microsecond)))
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+				}
+			}))
+			defer server.Close()
+
+			rateLimit, err := common.GetDTRateLimit(&common.DTCredentials{Tenant: server.URL, ApiToken: "dt0c01.TESTTOKEN"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			delay := getThrottleDelay(rateLimit, now, time.Minute)
+			if delay < tt.expected-time.Millisecond || delay > tt.expected+time.Millisecond {
+				t.Errorf("expected a delay of %s, got %s", tt.expected, delay)
+			}
+		})
+	}
+}
+
+func TestThrottleDelayIsCapped(t *testing.T) {
+	now := time.Now()
+	rateLimit := &common.DTRateLimit{Limit: 1000, Remaining: 0, Reset: now.Add(time.Hour)}
+
+	if delay := getThrottleDelay(rateLimit, now, time.Minute); delay != time.Minute {
+		t.Errorf("expected the delay to be capped at 1m, got %s", delay)
+	}
+}
+
+func TestThrottleDeploymentIsInterruptedByContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	defer func(throttle bool, maxDelay time.Duration) {
+		env.DeployThrottle, env.DeployThrottleMaxDelay = throttle, maxDelay
+	}(env.DeployThrottle, env.DeployThrottleMaxDelay)
+	env.DeployThrottle = true
+	env.DeployThrottleMaxDelay = time.Minute
+
+	tests := []struct {
+		name         string
+		ctx          func() (context.Context, context.CancelFunc)
+		expectedKind ErrorKind
+	}{
+		{name: "aborted", ctx: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+			return ctx, cancel
+		}, expectedKind: KindAborted},
+		{name: "deadline of the event", ctx: func() (context.Context, context.CancelFunc) {
+			return withEventDeadline(context.Background(), time.Now().Add(100*time.Millisecond))
+		}, expectedKind: KindTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			monacoErr := throttleDeployment(ctx, &common.DTCredentials{Tenant: server.URL, ApiToken: "dt0c01.TESTTOKEN"})
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the throttling to be interrupted, took %s", elapsed)
+			}
+			if monacoErr == nil || monacoErr.Kind != tt.expectedKind {
+				t.Errorf("expected a %s error, got %v", tt.expectedKind, monacoErr)
+			}
+		})
+	}
+}
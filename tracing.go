@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// extensions of the CloudEvents distributed tracing extension carrying the W3C trace context
+const traceParentExtension = "traceparent"
+const traceStateExtension = "tracestate"
+
+// tracer creates the spans of the event processing, spans are dropped unless OTEL_EXPORTER_OTLP_ENDPOINT is set
+var tracer = otel.Tracer(ServiceName)
+
+var traceContextPropagator = propagation.TraceContext{}
+
+/**
+ * Exports the spans via OTLP/HTTP to endpoint. The exporter is configured by the standard OTEL_EXPORTER_OTLP_*
+ * environment variables. Returns a function flushing the spans on shutdown, nothing is exported if endpoint is empty.
+ */
+func initTracing(endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName), semconv.ServiceVersionKey.String(version))),
+	)
+	tracer = provider.Tracer(ServiceName)
+	return provider.Shutdown, nil
+}
+
+// cloudEventCarrier reads and writes the trace context of a CloudEvent's extensions
+type cloudEventCarrier struct {
+	event *cloudevents.Event
+}
+
+func (c cloudEventCarrier) Get(key string) string {
+	var value string
+	c.event.Context.ExtensionAs(key, &value)
+	return value
+}
+
+func (c cloudEventCarrier) Set(key string, value string) {
+	c.event.SetExtension(key, value)
+}
+
+func (c cloudEventCarrier) Keys() []string {
+	return []string{traceParentExtension, traceStateExtension}
+}
+
+/**
+ * Starts a span for processing the event. It continues the trace of the event's traceparent extension if present,
+ * otherwise it starts a new trace.
+ */
+func startEventSpan(event *cloudevents.Event, name string) (context.Context, trace.Span) {
+	ctx := traceContextPropagator.Extract(context.Background(), cloudEventCarrier{event: event})
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("keptn.event.type", event.Type()),
+		attribute.String("keptn.event.id", event.ID()),
+		attribute.String("keptn.context", cloudEventCarrier{event: event}.Get("shkeptncontext")),
+	))
+}
+
+// injectTraceContext writes the span of ctx to the event's extensions, so handlers of the event continue the trace
+func injectTraceContext(ctx context.Context, event *cloudevents.Event) {
+	traceContextPropagator.Inject(ctx, cloudEventCarrier{event: event})
+}
+
+// endSpan marks the span as failed if err is set and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+/**
+ * phaseTracer covers the consecutive phases of a monaco run (fetch, validate, execute) with child spans of ctx.
+ * Starting a phase ends the previous one, End ends the current one.
+ */
+type phaseTracer struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+func (p *phaseTracer) Start(phase string) {
+	p.End()
+	_, p.span = tracer.Start(p.ctx, phase)
+}
+
+func (p *phaseTracer) End() {
+	if p.span != nil {
+		p.span.End()
+		p.span = nil
+	}
+}
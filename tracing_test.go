@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// records the spans of the test in memory, the returned function restores the tracer
+func useInMemoryTracer() (*tracetest.InMemoryExporter, func()) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	original := tracer
+	tracer = provider.Tracer(ServiceName)
+	return exporter, func() { tracer = original }
+}
+
+func TestProcessKeptnCloudEventCreatesSpans(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentSpanID = "00f067aa0ba902b7"
+
+	tests := []struct {
+		name        string
+		traceParent string
+	}{
+		{name: "trace context of the event", traceParent: "00-" + traceID + "-" + parentSpanID + "-01"},
+		{name: "root span"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setupTestWorkDir(t, "exit 0", nil)()
+			exporter, restore := useInMemoryTracer()
+			defer restore()
+
+			handlers, err := newEventHandlers(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func(original map[string]keptnEventHandler) { eventHandlers = original }(eventHandlers)
+			eventHandlers = handlers
+			defer func() { keptnOptions.EventSender = nil }()
+			keptnOptions.EventSender = &fake.EventSender{}
+
+			_, incomingEvent, err := initializeTestObjects("test-events/monaco.triggered.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.traceParent != "" {
+				incomingEvent.SetExtension(traceParentExtension, tt.traceParent)
+			}
+
+			if err := processKeptnCloudEvent(context.Background(), *incomingEvent); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			spans := map[string]tracetest.SpanStub{}
+			for _, span := range exporter.GetSpans() {
+				spans[span.Name] = span
+			}
+			for _, name := range []string{"processKeptnCloudEvent", "HandleMonacoTriggeredEvent", "fetch", "validate", "execute"} {
+				if _, ok := spans[name]; !ok {
+					t.Fatalf("expected a span %s, got %v", name, exporter.GetSpans())
+				}
+			}
+
+			process := spans["processKeptnCloudEvent"]
+			if tt.traceParent != "" {
+				if process.SpanContext.TraceID().String() != traceID || process.Parent.SpanID().String() != parentSpanID {
+					t.Errorf("expected the span to continue the trace of the event, got trace %s with parent %s", process.SpanContext.TraceID(), process.Parent.SpanID())
+				}
+			} else if process.Parent.IsValid() {
+				t.Errorf("expected a root span, got parent %s", process.Parent.SpanID())
+			}
+
+			handler := spans["HandleMonacoTriggeredEvent"]
+			assertChildSpan(t, process, handler)
+			for _, phase := range []string{"fetch", "validate", "execute"} {
+				assertChildSpan(t, handler, spans[phase])
+			}
+		})
+	}
+}
+
+func assertChildSpan(t *testing.T, parent tracetest.SpanStub, child tracetest.SpanStub) {
+	if child.SpanContext.TraceID() != parent.SpanContext.TraceID() || child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("expected %s to be a child of %s", child.Name, parent.Name)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/keptn-sandbox/monaco-service/pkg/common"
+)
+
+// folder of the config repo the logs of the runs are uploaded to, see UPLOAD_LOGS
+const uploadedLogFolder = "monaco-logs/"
+
+// runLogBuffer collects the log of a run, parallel monaco runs write to it concurrently
+type runLogBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *runLogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *runLogBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+/**
+ * Returns the writer the log of a run goes to: the deploy log file and, with upload, a buffer that is uploaded to
+ * the config repo after the deployment. Returns nil writers if there is neither.
+ */
+func newRunLog(deployLog *os.File, upload bool) (io.Writer, *runLogBuffer) {
+	var uploadedLog *runLogBuffer
+	writers := []io.Writer{}
+	if deployLog != nil {
+		writers = append(writers, deployLog)
+	}
+	if upload {
+		uploadedLog = &runLogBuffer{}
+		writers = append(writers, uploadedLog)
+	}
+	switch len(writers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return writers[0], uploadedLog
+	}
+	return io.MultiWriter(writers...), uploadedLog
+}
+
+/**
+ * Writes the log of the run to monaco-logs/<keptncontext>.log of the service in the config repo for auditing. A failed
+ * upload is logged, it doesn't change the result of the run.
+ */
+func uploadRunLog(keptnEvent *common.BaseKeptnEvent, uploadedLog *runLogBuffer) {
+	if uploadedLog == nil {
+		return
+	}
+	resourceURI := uploadedLogFolder + keptnEvent.Context + ".log"
+	if err := resourceWriter.WriteResources(keptnEvent, map[string]string{resourceURI: uploadedLog.String()}); err != nil {
+		log.Printf("Could not upload the log of %s to %s: %v", keptnEvent.Context, resourceURI, err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleMonacoTriggeredEventUploadsLog(t *testing.T) {
+	defer setupTestWorkDir(t, "echo 'INFO Deploying config auto-tag/tagging'", nil)()
+	defer func(upload bool) { env.UploadLogs = upload }(env.UploadLogs)
+	env.UploadLogs = true
+	writer := &fakeResourceWriter{}
+	defer useResourceWriter(writer)()
+
+	if _, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	uploaded, ok := writer.written["monaco-logs/08735340-6f9e-4b32-97ff-3b6c292bc50h.log"]
+	if !ok || len(writer.written) != 1 {
+		t.Fatalf("expected the log to be uploaded as monaco-logs/<keptncontext>.log, got %v", writer.written)
+	}
+	if !strings.Contains(uploaded, "Starting monaco run for sockshop.dev.carts") || !strings.Contains(uploaded, "Successfully ran monaco") {
+		t.Errorf("expected the log of the run, got %s", uploaded)
+	}
+	if strings.Count(uploaded, "INFO Deploying config auto-tag/tagging") != 2 {
+		t.Errorf("expected the output of the dry run and the deployment, got %s", uploaded)
+	}
+}
+
+func TestHandleMonacoTriggeredEventDoesNotUploadLogByDefault(t *testing.T) {
+	defer setupTestWorkDir(t, "exit 0", nil)()
+	writer := &fakeResourceWriter{}
+	defer useResourceWriter(writer)()
+
+	if _, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(writer.written) != 0 {
+		t.Errorf("expected no upload without UPLOAD_LOGS, got %v", writer.written)
+	}
+}
+
+func TestHandleMonacoTriggeredEventUploadsLogOfFailedValidation(t *testing.T) {
+	defer setupTestWorkDir(t, "touch ran", map[string]string{
+		"monaco-test/projects/sockshop/management-zone/zone.yaml": "config:\n  - zone: [\"zone.json\"\n",
+		"monaco-test/projects/sockshop/management-zone/zone.json": "{}",
+	})()
+	defer func(upload bool) { env.UploadLogs = upload }(env.UploadLogs)
+	env.UploadLogs = true
+	writer := &fakeResourceWriter{}
+	defer useResourceWriter(writer)()
+
+	if _, err := runMonacoTriggeredEvent(t, "test-events/monaco.triggered.json"); err == nil {
+		t.Fatal("expected the validation to fail")
+	}
+
+	uploaded, ok := writer.written["monaco-logs/08735340-6f9e-4b32-97ff-3b6c292bc50h.log"]
+	if !ok {
+		t.Fatalf("expected the log of the failed run to be uploaded, got %v", writer.written)
+	}
+	if !strings.Contains(uploaded, "Monaco run aborted, invalid yaml files") {
+		t.Errorf("expected the log to name the validation error, got %s", uploaded)
+	}
+}
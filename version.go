@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// build info of the service, set at build time via -ldflags "-X main.version=... -X main.gitCommit=... -X main.buildDate=..."
+var (
+	version   = "develop"
+	gitCommit = "unknown"
+	buildDate = "unknown"
+)
+
+// BuildInfo is returned by the /version endpoint
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+func getBuildInfo() BuildInfo {
+	return BuildInfo{Version: version, Commit: gitCommit, BuildDate: buildDate, GoVersion: runtime.Version()}
+}
+
+/**
+ * Serves /version: the version, git commit and build date of the running service
+ */
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getBuildInfo())
+}
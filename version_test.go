@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	defer func(v string, c string, d string) { version, gitCommit, buildDate = v, c, d }(version, gitCommit, buildDate)
+	version, gitCommit, buildDate = "0.9.1", "4f3b2a1c", "2021-05-04T10:00:00Z"
+
+	recorder := httptest.NewRecorder()
+	handleVersion(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected 200 with a JSON body, got %d (%s)", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	fields := map[string]string{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("could not parse version response: %v", err)
+	}
+	expected := map[string]string{"version": "0.9.1", "commit": "4f3b2a1c", "buildDate": "2021-05-04T10:00:00Z", "goVersion": runtime.Version()}
+	for field, value := range expected {
+		if fields[field] != value {
+			t.Errorf("expected %s %s, got %s", field, value, fields[field])
+		}
+	}
+}